@@ -1,18 +1,38 @@
 package config
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+
+	"AI-PROXY/model"
 )
 
 // Config 系统配置结构
 type Config struct {
-	Server   ServerConfig         `json:"server"`
-	Database DatabaseConfig       `json:"database"`
-	Log      LogConfig            `json:"log"`
-	APIs     map[string]APIConfig `json:"apis"`
-	Auth     AuthConfig           `json:"auth"`
+	Server    ServerConfig         `json:"server"`
+	Database  DatabaseConfig       `json:"database"`
+	Log       LogConfig            `json:"log"`
+	APIs      map[string]APIConfig `json:"apis"`
+	Auth      AuthConfig           `json:"auth"`
+	CORS      CORSConfig           `json:"cors"`
+	RateLimit RateLimitConfig      `json:"rate_limit"`
+	APISync   APISyncConfig        `json:"api_sync"`
+	Cache     CacheConfig          `json:"cache"`
+	Cluster   ClusterConfig        `json:"cluster"`
+	Egress    EgressConfig         `json:"egress"`
+	Proxy     ProxyConfig          `json:"proxy"`
+	// KeyPolicies 绑定到客户端API Key的参数策略，与API的request_policy同时生效
+	KeyPolicies []KeyPolicyConfig `json:"key_policies"`
+}
+
+// KeyPolicyConfig 客户端API Key的参数策略，按Key的SHA-256匹配，配置中不保存明文Key
+type KeyPolicyConfig struct {
+	Name      string              `json:"name"`       // 备注，如使用方名称
+	KeySHA256 string              `json:"key_sha256"` // 客户端API Key的SHA-256（十六进制）
+	Policy    model.RequestPolicy `json:"policy"`
 }
 
 // ServerConfig 服务器配置
@@ -25,38 +45,116 @@ type ServerConfig struct {
 
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
-	Driver   string `json:"driver"`
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Database string `json:"database"`
+	Driver          string `json:"driver"` // mysql/postgres/sqlite，默认mysql
+	Host            string `json:"host"`
+	Port            int    `json:"port"`
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	Database        string `json:"database"`          // 数据库名，sqlite为数据库文件路径
+	SSLMode         string `json:"ssl_mode"`          // postgres的sslmode，默认disable
+	MaxOpenConns    int    `json:"max_open_conns"`    // 最大打开连接数，0表示不限制
+	MaxIdleConns    int    `json:"max_idle_conns"`    // 最大空闲连接数，0使用驱动默认值
+	ConnMaxLifetime int    `json:"conn_max_lifetime"` // 连接最长存活时间（秒），0表示不限制
 }
 
 // LogConfig 日志配置
 type LogConfig struct {
-	Level      string `json:"level"`
-	FilePath   string `json:"file_path"`
-	MaxSize    int    `json:"max_size"`
-	MaxBackups int    `json:"max_backups"`
-	MaxAge     int    `json:"max_age"`
-	Compress   bool   `json:"compress"`
+	Level       string     `json:"level"`
+	FilePath    string     `json:"file_path"`
+	MaxSize     int        `json:"max_size"`     // 单个日志文件最大尺寸（MB），超过后轮转
+	MaxBackups  int        `json:"max_backups"`  // 最多保留的历史文件数，0表示不限制
+	MaxAge      int        `json:"max_age"`      // 历史文件最多保留天数，0表示不限制
+	Compress    bool       `json:"compress"`     // 是否gzip压缩历史文件
+	Format      string     `json:"format"`       // 日志格式 text/json，默认json
+	RotateHours int        `json:"rotate_hours"` // 按时间轮转的间隔（小时），0表示只按大小轮转
+	Access      *LogConfig `json:"access"`       // 访问日志单独输出配置，为空时与应用日志共用
 }
 
 // APIConfig API配置
 type APIConfig struct {
-	BaseURL     string            `json:"base_url"`
-	Headers     map[string]string `json:"headers"`
-	AuthType    string            `json:"auth_type"`
-	AuthValue   string            `json:"auth_value"`
-	Timeout     int               `json:"timeout"`
-	RateLimit   int               `json:"rate_limit"`
-	Description string            `json:"description"`
+	BaseURL         string                `json:"base_url"`
+	Headers         map[string]string     `json:"headers"`
+	AuthType        string                `json:"auth_type"`  // 上游认证方式 bearer/basic，同步时转换为Authorization请求头
+	AuthValue       string                `json:"auth_value"` // bearer为令牌，basic为user:password
+	Timeout         int                   `json:"timeout"`    // 已不再支持，同步时忽略并给出警告
+	RateLimit       int                   `json:"rate_limit"` // 已不再支持，同步时忽略并给出警告
+	Description     string                `json:"description"`
+	Provider        string                `json:"provider"`         // 上游供应商类型，为空表示通用
+	AllowInternal   bool                  `json:"allow_internal"`   // 是否允许访问内网地址，不受出站策略的地址段限制
+	AccessRules     []model.AccessRule    `json:"access_rules"`     // 按方法和路径放行或拒绝请求的规则
+	RequestPolicy   model.RequestPolicy   `json:"request_policy"`   // 请求体中model和参数的限制
+	Rewrite         model.RewriteRules    `json:"rewrite"`          // 转发时的改写规则，headers会合并到rewrite.request_headers.set
+	ProviderOptions model.ProviderOptions `json:"provider_options"` // 供应商专属配置，如Azure的部署映射
+	Secret          string                `json:"secret"`           // 供应商凭据，保存时加密，如Bedrock的Secret Access Key
+	MaxBodySize     int                   `json:"max_body_size"`    // 请求体大小上限（MB），0表示使用proxy.max_body_size
+	Active          *bool                 `json:"active"`           // 是否启用，未设置时默认启用
+}
+
+// APISyncConfig 启动时将apis同步到数据库的配置
+type APISyncConfig struct {
+	OnStartup bool   `json:"on_startup"` // 启动时是否同步
+	Mode      string `json:"mode"`       // 同步模式 create/upsert/mirror，默认create
 }
 
 // AuthConfig 管理员认证配置
 type AuthConfig struct {
-	Token string `json:"token"`
+	Token         string `json:"token"`          // 静态令牌，作为应急凭据拥有admin权限，为空时禁用
+	SessionSecret string `json:"session_secret"` // 会话令牌签名密钥，多实例部署时必须一致
+	SessionTTL    int    `json:"session_ttl"`    // 会话有效期（分钟），默认720
+	EncryptionKey string `json:"encryption_key"` // API凭据（如Bedrock密钥）的加密密钥，为空时不能保存凭据，设置后不能随意更换
+}
+
+// CORSConfig 跨域配置，字段为空时使用默认值
+type CORSConfig struct {
+	AllowOrigins []string `json:"allow_origins"`
+	AllowMethods []string `json:"allow_methods"`
+	AllowHeaders []string `json:"allow_headers"`
+}
+
+// RateLimitConfig 代理请求限流配置，按客户端IP计算
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requests_per_minute"` // 每分钟允许的请求数，0表示不限流
+	Burst             int `json:"burst"`               // 允许的突发请求数，默认等于RequestsPerMinute
+}
+
+// CacheConfig API配置缓存
+type CacheConfig struct {
+	RefreshInterval int `json:"refresh_interval"` // 按updated_at刷新缓存的间隔（秒），默认30
+}
+
+// ClusterConfig 多实例配置同步
+type ClusterConfig struct {
+	PollInterval int `json:"poll_interval"` // 轮询配置变更日志的间隔（秒），默认2
+}
+
+// EgressConfig 代理访问上游的出站策略，防止通过API配置访问内网（SSRF）
+type EgressConfig struct {
+	AllowPrivate bool     `json:"allow_private"` // 是否允许访问内网、回环、链路本地等地址，默认禁止
+	AllowedHosts []string `json:"allowed_hosts"` // 允许的上游主机，支持*.example.com通配，为空表示不限制
+	AllowedPorts []int    `json:"allowed_ports"` // 允许的上游端口，为空表示不限制
+}
+
+// 上游Set-Cookie的处理方式
+const (
+	SetCookiePass    = "pass"    // 原样返回给客户端
+	SetCookieStrip   = "strip"   // 删除
+	SetCookieRewrite = "rewrite" // 去掉Domain，Path加上/API名称前缀，使cookie只对该API生效
+)
+
+// ProxyConfig 代理转发配置
+type ProxyConfig struct {
+	DisableForwardedHeaders bool            `json:"disable_forwarded_headers"` // 不向上游发送X-Forwarded-For/Proto/Host，避免泄露客户端IP
+	SetCookie               string          `json:"set_cookie"`                // 上游Set-Cookie的处理方式 pass/strip/rewrite，默认pass
+	WebSocket               WebSocketConfig `json:"websocket"`                 // WebSocket转发配置
+	MaxBodySize             int             `json:"max_body_size"`             // 请求体大小上限（MB），默认100，可被API配置覆盖
+	Retries                 int             `json:"retries"`                   // 连接上游失败时的重试次数，默认0；需要重试时请求体会被缓存
+	ModelList               bool            `json:"model_list"`                // 开放GET /v1/models汇总本地模型列表，该接口无需认证，默认关闭
+}
+
+// WebSocketConfig WebSocket会话限制
+type WebSocketConfig struct {
+	IdleTimeout int `json:"idle_timeout"` // 双向都没有消息时断开的时间（秒），默认300
+	MaxDuration int `json:"max_duration"` // 单个会话最长持续时间（秒），默认3600
 }
 
 // LoadConfig 加载配置文件
@@ -73,8 +171,71 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
-// 全局配置变量，供全项目访问
-var GlobalConfig *Config
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("服务器端口无效: %d", c.Server.Port)
+	}
+	if c.Log.Format != "" && c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("日志格式无效: %s", c.Log.Format)
+	}
+	if c.Log.Access != nil && c.Log.Access.Format != "" && c.Log.Access.Format != "text" && c.Log.Access.Format != "json" {
+		return fmt.Errorf("访问日志格式无效: %s", c.Log.Access.Format)
+	}
+	switch c.Database.Driver {
+	case "", "mysql", "postgres", "sqlite":
+	default:
+		return fmt.Errorf("不支持的数据库驱动: %s", c.Database.Driver)
+	}
+	switch c.APISync.Mode {
+	case "", "create", "upsert", "mirror":
+	default:
+		return fmt.Errorf("API同步模式无效: %s", c.APISync.Mode)
+	}
+	for name, api := range c.APIs {
+		if name == "" || api.BaseURL == "" {
+			return fmt.Errorf("apis中的API名称和基础url不能为空: %q", name)
+		}
+	}
+	if c.RateLimit.RequestsPerMinute < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("限流配置不能为负数")
+	}
+	switch c.Proxy.SetCookie {
+	case "", SetCookiePass, SetCookieStrip, SetCookieRewrite:
+	default:
+		return fmt.Errorf("Set-Cookie处理方式无效: %s", c.Proxy.SetCookie)
+	}
+	if c.Proxy.MaxBodySize < 0 || c.Proxy.Retries < 0 {
+		return fmt.Errorf("请求体大小上限和重试次数不能为负数")
+	}
+	if c.Proxy.WebSocket.IdleTimeout < 0 || c.Proxy.WebSocket.MaxDuration < 0 {
+		return fmt.Errorf("WebSocket会话限制不能为负数")
+	}
+	for _, port := range c.Egress.AllowedPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("出站策略端口无效: %d", port)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, p := range c.KeyPolicies {
+		hash := strings.ToLower(p.KeySHA256)
+		if len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "" {
+			return fmt.Errorf("key_policies[%d].key_sha256 必须是64位十六进制的SHA-256", i)
+		}
+		if seen[hash] {
+			return fmt.Errorf("key_policies[%d].key_sha256 重复", i)
+		}
+		seen[hash] = true
+		if p.Policy.MaxTokens < 0 || p.Policy.MaxCompletionTokens < 0 || p.Policy.MaxN < 0 {
+			return fmt.Errorf("key_policies[%d] 的参数上限不能为负数", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// current 当前生效的配置，通过原子指针整体替换，读取无需加锁
+var current atomic.Pointer[Config]
+
+var (
+	reloadMu   sync.Mutex
+	configPath string
+	listeners  []func(old, new *Config)
+)
+
+// ReloadResult 配置重载结果
+type ReloadResult struct {
+	Applied         []string `json:"applied"`          // 已立即生效的配置项
+	RestartRequired []string `json:"restart_required"` // 已修改但需要重启才能生效的配置项
+	Manual          []string `json:"manual"`           // 已修改但不会自动生效、需要手动执行sync子命令的配置项
+}
+
+// Init 加载配置文件并设为当前配置，记录路径供后续重载使用
+func Init(path string) (*Config, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	reloadMu.Lock()
+	configPath = path
+	reloadMu.Unlock()
+	current.Store(cfg)
+	return cfg, nil
+}
+
+// Get 获取当前配置
+func Get() *Config {
+	return current.Load()
+}
+
+// Set 直接替换当前配置，主要用于测试或嵌入场景
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
+
+// OnReload 注册配置重载回调，在新配置生效后调用
+func OnReload(fn func(old, new *Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Reload 重新读取配置文件，校验通过后原子替换并通知回调
+func Reload() (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	old := current.Load()
+	result := diff(old, cfg)
+	current.Store(cfg)
+	for _, fn := range listeners {
+		fn(old, cfg)
+	}
+	return result, nil
+}
+
+// diff 比较新旧配置，区分可热更新和需要重启的配置项
+func diff(old, new *Config) *ReloadResult {
+	result := &ReloadResult{Applied: []string{}, RestartRequired: []string{}, Manual: []string{}}
+	if old == nil {
+		return result
+	}
+
+	// 日志文件路径和轮转参数在启动时确定，只有级别可以热更新
+	oldLog, newLog := old.Log, new.Log
+	if oldLog.Level != newLog.Level || !sameAccessLevel(oldLog.Access, newLog.Access) {
+		result.Applied = append(result.Applied, "log.level")
+	}
+	oldLog.Level, newLog.Level = "", ""
+	oldLog.Access, newLog.Access = withoutLevel(oldLog.Access), withoutLevel(newLog.Access)
+
+	changes := []struct {
+		name    string
+		changed bool
+		restart bool
+	}{
+		{"server", !reflect.DeepEqual(old.Server, new.Server), true},
+		{"database", !reflect.DeepEqual(old.Database, new.Database), true},
+		{"log", !reflect.DeepEqual(oldLog, newLog), true},
+		{"auth", !reflect.DeepEqual(old.Auth, new.Auth), false},
+		{"cors", !reflect.DeepEqual(old.CORS, new.CORS), false},
+		{"rate_limit", !reflect.DeepEqual(old.RateLimit, new.RateLimit), false},
+		{"api_sync", !reflect.DeepEqual(old.APISync, new.APISync), false},
+		{"egress", !reflect.DeepEqual(old.Egress, new.Egress), false},
+		{"proxy", !reflect.DeepEqual(old.Proxy, new.Proxy), false},
+		{"key_policies", !reflect.DeepEqual(old.KeyPolicies, new.KeyPolicies), false},
+	}
+	// apis只在开启api_sync.on_startup时由重载回调同步到数据库，否则需要手动执行sync子命令
+	if !reflect.DeepEqual(old.APIs, new.APIs) {
+		if new.APISync.OnStartup {
+			result.Applied = append(result.Applied, "apis")
+		} else {
+			result.Manual = append(result.Manual, "apis")
+		}
+	}
+	for _, c := range changes {
+		if !c.changed {
+			continue
+		}
+		if c.restart {
+			result.RestartRequired = append(result.RestartRequired, c.name)
+		} else {
+			result.Applied = append(result.Applied, c.name)
+		}
+	}
+	return result
+}
+
+func sameAccessLevel(a, b *LogConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Level == b.Level
+}
+
+func withoutLevel(c *LogConfig) *LogConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.Level = ""
+	return &cp
+}
+
+// Watch 轮询配置文件修改时间，发生变化时自动重载，stop关闭后退出
+func Watch(interval time.Duration, stop <-chan struct{}, onReload func(*ReloadResult, error)) {
+	reloadMu.Lock()
+	path := configPath
+	reloadMu.Unlock()
+
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			result, err := Reload()
+			onReload(result, err)
+		case <-stop:
+			return
+		}
+	}
+}
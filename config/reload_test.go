@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffAPIs(t *testing.T) {
+	old := &Config{APIs: map[string]APIConfig{"openai": {BaseURL: "https://api.openai.com"}}}
+	tests := []struct {
+		name       string
+		onStartup  bool
+		wantApply  []string
+		wantManual []string
+	}{
+		{"开启自动同步时重载后生效", true, []string{"api_sync", "apis"}, []string{}},
+		{"未开启自动同步时需要手动同步", false, []string{}, []string{"apis"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			new := &Config{
+				APIs:    map[string]APIConfig{"openai": {BaseURL: "https://example.com"}},
+				APISync: APISyncConfig{OnStartup: tt.onStartup},
+			}
+			result := diff(old, new)
+			if !sameItems(result.Applied, tt.wantApply) || !reflect.DeepEqual(result.Manual, tt.wantManual) {
+				t.Errorf("Applied = %v, Manual = %v", result.Applied, result.Manual)
+			}
+			if len(result.RestartRequired) != 0 {
+				t.Errorf("RestartRequired = %v", result.RestartRequired)
+			}
+		})
+	}
+}
+
+func sameItems(a, b []string) bool {
+	seen := make(map[string]int)
+	for _, s := range a {
+		seen[s]++
+	}
+	for _, s := range b {
+		seen[s]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
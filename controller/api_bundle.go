@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// 导入包的最大尺寸
+const maxBundleSize = 10 << 20
+
+// 传递凭据加密口令的请求头，避免口令出现在URL和访问日志中
+const bundlePassphraseHeader = "X-Bundle-Passphrase"
+
+// 导出API配置，format为json/yaml，secrets为omit/encrypt
+func (ctl *APIConfigController) ExportAPIConfigs(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		util.BadRequestResponse(c, "不支持的导出格式: "+format)
+		return
+	}
+	bundle, err := ctl.svc.ExportAPIConfigs(c.Query("secrets"), c.GetHeader(bundlePassphraseHeader))
+	if err != nil {
+		util.BadRequestResponse(c, err.Error())
+		return
+	}
+
+	var data []byte
+	contentType := "application/json; charset=utf-8"
+	if format == "yaml" {
+		data, err = yaml.Marshal(bundle)
+		contentType = "application/yaml; charset=utf-8"
+	} else {
+		data, err = json.MarshalIndent(bundle, "", "  ")
+	}
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="api-configs.`+format+`"`)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// 导入API配置，mode为merge/replace，dry_run=true时只返回将要发生的变更
+func (ctl *APIConfigController) ImportAPIConfigs(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBundleSize))
+	if err != nil {
+		util.BadRequestResponse(c, "读取导入包失败: "+err.Error())
+		return
+	}
+	format := c.Query("format")
+	if format == "" && strings.Contains(c.ContentType(), "yaml") {
+		format = "yaml"
+	}
+	var bundle service.APIConfigBundle
+	if format == "yaml" {
+		err = yaml.Unmarshal(data, &bundle)
+	} else {
+		err = json.Unmarshal(data, &bundle)
+	}
+	if err != nil {
+		util.BadRequestResponse(c, "解析导入包失败: "+err.Error())
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	result, err := ctl.svc.ImportAPIConfigs(actorFrom(c), &bundle, c.Query("mode"), c.GetHeader(bundlePassphraseHeader), dryRun)
+	if err != nil {
+		status := http.StatusBadRequest
+		if result != nil && !hasInvalidEntry(result) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, util.Response{Code: status, Message: err.Error(), Data: result})
+		return
+	}
+	util.SuccessResponse(c, result)
+}
+
+// hasInvalidEntry 判断导入结果中是否有校验失败的条目
+func hasInvalidEntry(result *service.SyncResult) bool {
+	for _, change := range result.Changes {
+		if change.Action == service.SyncActionError {
+			return true
+		}
+	}
+	return false
+}
@@ -1,82 +1,233 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
+	"AI-PROXY/middleware"
 	"AI-PROXY/model"
+	"AI-PROXY/repository"
 	"AI-PROXY/service"
 	"AI-PROXY/util"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 获取所有API配置
-func GetAllAPIConfigs(c *gin.Context) {
-	configs, err := service.GetAllAPIConfigs()
+// APIConfigController API配置管理接口
+type APIConfigController struct {
+	svc *service.APIConfigService
+}
+
+// NewAPIConfigController 创建API配置管理接口
+func NewAPIConfigController(svc *service.APIConfigService) *APIConfigController {
+	return &APIConfigController{svc: svc}
+}
+
+// 查询API配置列表，支持q/active/test_status/provider/deleted过滤，sort排序（前缀-表示倒序），
+// limit/offset分页，summary=true时只返回摘要字段
+func (ctl *APIConfigController) GetAllAPIConfigs(c *gin.Context) {
+	filter := repository.APIConfigFilter{
+		Query:      c.Query("q"),
+		TestStatus: c.Query("test_status"),
+		Provider:   c.Query("provider"),
+		Deleted:    c.Query("deleted") == "true",
+	}
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			util.BadRequestResponse(c, "active应为true或false")
+			return
+		}
+		filter.Active = &active
+	}
+	filter.Sort = c.Query("sort")
+	if strings.HasPrefix(filter.Sort, "-") {
+		filter.Sort, filter.Desc = filter.Sort[1:], true
+	}
+	if filter.Sort != "" && !repository.APIConfigSortColumns[filter.Sort] {
+		util.BadRequestResponse(c, "不支持的排序字段: "+filter.Sort)
+		return
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	configs, total, err := ctl.svc.FindAPIConfigs(filter)
 	if err != nil {
-		util.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		util.InternalServerErrorResponse(c, err.Error())
 		return
 	}
-	util.SuccessResponse(c, configs)
+	var items interface{} = configs
+	if c.Query("summary") == "true" {
+		items = service.SummarizeAPIConfigs(configs)
+	}
+	util.SuccessResponse(c, gin.H{
+		"total": total,
+		"items": items,
+	})
 }
 
 // 获取单个API配置
-func GetAPIConfig(c *gin.Context) {
+func (ctl *APIConfigController) GetAPIConfig(c *gin.Context) {
 	name := c.Param("name")
-	config, err := service.GetAPIConfigByName(name)
+	config, err := ctl.svc.GetAPIConfigByName(name)
 	if err != nil {
 		util.ErrorResponse(c, http.StatusNotFound, err.Error())
 		return
 	}
+	c.Header("ETag", etagOf(config))
 	util.SuccessResponse(c, config)
 }
 
 // 创建API配置
-func CreateAPIConfig(c *gin.Context) {
+func (ctl *APIConfigController) CreateAPIConfig(c *gin.Context) {
 	var config model.APIConfig
 	if err := c.ShouldBindJSON(&config); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
 		return
 	}
-	if config.Name == "" || config.BaseURL == "" {
-		util.ErrorResponse(c, http.StatusBadRequest, "API名称和基址URL为必填项")
-		return
-	}
-	if err := service.CreateAPIConfig(&config); err != nil {
-		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := ctl.svc.CreateAPIConfig(actorFrom(c), &config); err != nil {
+		writeUpdateError(c, err)
 		return
 	}
 	util.SuccessResponse(c, "API配置创建成功")
 }
 
-// 更新API配置
-func UpdateAPIConfig(c *gin.Context) {
+// 更新API配置，零值字段不修改，支持If-Match版本校验
+func (ctl *APIConfigController) UpdateAPIConfig(c *gin.Context) {
 	name := c.Param("name")
 	var config model.APIConfig
 	if err := c.ShouldBindJSON(&config); err != nil {
 		util.BadRequestResponse(c, "参数格式错误："+err.Error())
 		return
 	}
-	if err := service.UpdateAPIConfig(name, &config); err != nil {
-		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if err := ctl.svc.UpdateAPIConfig(actorFrom(c), name, &config, version); err != nil {
+		writeUpdateError(c, err)
 		return
 	}
 	util.SuccessResponse(c, "API配置更新成功")
 }
 
+// 按JSON Merge Patch部分更新API配置，支持If-Match版本校验
+func (ctl *APIConfigController) PatchAPIConfig(c *gin.Context) {
+	var patch map[string]interface{}
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		util.BadRequestResponse(c, "参数格式错误："+err.Error())
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	config, err := ctl.svc.PatchAPIConfig(actorFrom(c), c.Param("name"), patch, version)
+	if err != nil {
+		writeUpdateError(c, err)
+		return
+	}
+	c.Header("ETag", etagOf(config))
+	util.SuccessResponse(c, config)
+}
+
+// etagOf 由配置版本号生成ETag
+func etagOf(config *model.APIConfig) string {
+	return `"` + strconv.Itoa(config.Version) + `"`
+}
+
+// ifMatchVersion 解析If-Match请求头中的版本号，未提供或为*时返回0表示不校验
+func ifMatchVersion(c *gin.Context) (int, bool) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, true
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		util.BadRequestResponse(c, "If-Match格式错误")
+		return 0, false
+	}
+	return version, true
+}
+
+// writeUpdateError 按错误类型返回404/409/400，校验错误在data.fields中列出每个字段
+func writeUpdateError(c *gin.Context, err error) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusBadRequest, util.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Data:    gin.H{"fields": verr.Fields},
+		})
+	case errors.Is(err, service.ErrNotFound):
+		util.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrVersionConflict):
+		util.ErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+}
+
 // 删API配置
-func DeleteAPIConfig(c *gin.Context) {
+func (ctl *APIConfigController) DeleteAPIConfig(c *gin.Context) {
 	name := c.Param("name")
-	if err := service.DeleteAPIConfig(name); err != nil {
+	if err := ctl.svc.DeleteAPIConfig(actorFrom(c), name); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 	util.SuccessResponse(c, "API配置删除成功")
 }
 
+// 获取API配置历史版本
+func (ctl *APIConfigController) GetAPIConfigHistory(c *gin.Context) {
+	revisions, err := ctl.svc.GetAPIConfigHistory(c.Param("name"))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	util.SuccessResponse(c, revisions)
+}
+
+// 回滚API配置到指定版本
+func (ctl *APIConfigController) RollbackAPIConfig(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		util.BadRequestResponse(c, "版本号无效")
+		return
+	}
+	config, err := ctl.svc.RollbackAPIConfig(actorFrom(c), c.Param("name"), version)
+	if errors.Is(err, service.ErrNotFound) {
+		util.ErrorResponse(c, http.StatusNotFound, "历史版本不存在")
+		return
+	}
+	if err != nil {
+		writeUpdateError(c, err)
+		return
+	}
+	util.SuccessResponse(c, config)
+}
+
+// 恢复已删除的API配置
+func (ctl *APIConfigController) RestoreAPIConfig(c *gin.Context) {
+	config, err := ctl.svc.RestoreAPIConfig(actorFrom(c), c.Param("name"))
+	if errors.Is(err, service.ErrNotFound) {
+		util.ErrorResponse(c, http.StatusNotFound, "没有可恢复的已删除配置")
+		return
+	}
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	util.SuccessResponse(c, config)
+}
+
 // API测试请求体结构
 type APITestRequest struct {
 	Name string `json:"name"`
@@ -91,7 +242,7 @@ type APITestResponse struct {
 	Message      string `json:"message"`
 }
 
-func TestAPIConfig(c *gin.Context) {
+func (ctl *APIConfigController) TestAPIConfig(c *gin.Context) {
 	var req struct {
 		Name string `json:"name"`
 	}
@@ -101,7 +252,7 @@ func TestAPIConfig(c *gin.Context) {
 	}
 
 	// 查找API配置
-	apiConfig, err := service.GetAPIConfigByName(req.Name)
+	apiConfig, err := ctl.svc.GetAPIConfigByName(req.Name)
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, "API配置不存在: "+err.Error())
 		return
@@ -124,6 +275,13 @@ func TestAPIConfig(c *gin.Context) {
 	// 执行ping命令
 	cmd := exec.Command("ping", "-c", "1", host)
 	output, err := cmd.CombinedOutput()
+	status := "success"
+	if err != nil {
+		status = "fail"
+	}
+	if updateErr := ctl.svc.UpdateAPITestStatus(actorFrom(c), apiConfig.Name, status, time.Now().UnixMilli()); updateErr != nil {
+		util.Logger.Warnf("更新API测试状态失败: %v", updateErr)
+	}
 	if err == nil {
 		// ping通
 		util.SuccessResponse(c, gin.H{
@@ -146,3 +304,12 @@ func TestAPIConfig(c *gin.Context) {
 		return
 	}
 }
+
+// actorFrom 从请求中获取操作者，用于审计日志
+func actorFrom(c *gin.Context) service.Actor {
+	actor := service.Actor{IP: c.ClientIP()}
+	if p := middleware.CurrentPrincipal(c); p != nil {
+		actor.Name = p.Username
+	}
+	return actor
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController 审计日志接口
+type AuditController struct {
+	svc *service.AuditService
+}
+
+// NewAuditController 创建审计日志接口
+func NewAuditController(svc *service.AuditService) *AuditController {
+	return &AuditController{svc: svc}
+}
+
+// 查询审计日志，支持actor/action/entity/name/since/until/limit/offset过滤，时间为RFC3339格式
+func (ctl *AuditController) GetAuditLogs(c *gin.Context) {
+	filter := repository.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		Entity:     c.Query("entity"),
+		EntityName: c.Query("name"),
+	}
+	var err error
+	if v := c.Query("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			util.BadRequestResponse(c, "since格式错误，应为RFC3339")
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			util.BadRequestResponse(c, "until格式错误，应为RFC3339")
+			return
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	logs, total, err := ctl.svc.Find(filter)
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, gin.H{
+		"total": total,
+		"items": logs,
+	})
+}
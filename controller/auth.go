@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"AI-PROXY/middleware"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthController 管理员登录与账号管理接口
+type AuthController struct {
+	svc *service.AuthService
+}
+
+// NewAuthController 创建管理员认证接口
+func NewAuthController(svc *service.AuthService) *AuthController {
+	return &AuthController{svc: svc}
+}
+
+// 登录请求体
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// 登录
+func (ctl *AuthController) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestResponse(c, "参数格式错误: "+err.Error())
+		return
+	}
+	result, err := ctl.svc.Login(req.Username, req.Password, c.ClientIP())
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		util.UnauthorizedResponse(c, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrLoginLocked) {
+		util.ErrorResponse(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, result)
+}
+
+// 登出
+func (ctl *AuthController) Logout(c *gin.Context) {
+	if err := ctl.svc.Logout(middleware.CurrentPrincipal(c)); err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, "已退出登录")
+}
+
+// 获取当前登录身份
+func (ctl *AuthController) Me(c *gin.Context) {
+	util.SuccessResponse(c, middleware.CurrentPrincipal(c))
+}
+
+// 获取所有管理员
+func (ctl *AuthController) GetUsers(c *gin.Context) {
+	users, err := ctl.svc.ListUsers()
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, users)
+}
+
+// 创建管理员请求体
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// 创建管理员
+func (ctl *AuthController) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestResponse(c, "参数格式错误: "+err.Error())
+		return
+	}
+	user, err := ctl.svc.CreateUser(actorFrom(c), req.Username, req.Password, req.Role)
+	if err != nil {
+		util.BadRequestResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, user)
+}
+
+// 修改管理员
+func (ctl *AuthController) UpdateUser(c *gin.Context) {
+	var req service.UserUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestResponse(c, "参数格式错误: "+err.Error())
+		return
+	}
+	user, err := ctl.svc.UpdateUser(actorFrom(c), c.Param("username"), &req)
+	if errors.Is(err, service.ErrNotFound) {
+		util.ErrorResponse(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if err != nil {
+		util.BadRequestResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, user)
+}
+
+// 删除管理员
+func (ctl *AuthController) DeleteUser(c *gin.Context) {
+	err := ctl.svc.DeleteUser(actorFrom(c), c.Param("username"))
+	if errors.Is(err, service.ErrNotFound) {
+		util.ErrorResponse(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if errors.Is(err, service.ErrLastAdmin) {
+		util.BadRequestResponse(c, err.Error())
+		return
+	}
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, "管理员删除成功")
+}
@@ -2,140 +2,200 @@ package controller
 
 import (
 	"bytes"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 
+	"AI-PROXY/model"
 	"AI-PROXY/service"
 	"AI-PROXY/util"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ForwardRequest 代理转发请求
-func ForwardRequest(c *gin.Context) {
-	fmt.Printf("=== 代理转发被调用 ===\n")
-	fmt.Printf("完整请求路径: %s\n", c.Request.URL.Path)
-	fmt.Printf("请求方法: %s\n", c.Request.Method)
+// ProxyController 代理转发接口
+type ProxyController struct {
+	svc            *service.APIConfigService
+	logs           *service.RequestLogService // 保存WebSocket会话统计
+	client         *http.Client               // 受出站策略约束的客户端
+	internalClient *http.Client               // 设置了allow_internal的API使用的客户端
+}
 
-	// 获取 API 名称和路径
-	apiName := c.Param("apiName")
-	path := c.Param("path")
-	
-	// 重要：保留原始查询参数
-	if c.Request.URL.RawQuery != "" {
-		path = path + "?" + c.Request.URL.RawQuery
+// NewProxyController 创建代理转发接口，client为空时使用受出站策略约束的客户端，
+// 传入client时所有API都使用该客户端
+func NewProxyController(svc *service.APIConfigService, logs *service.RequestLogService, client *http.Client) *ProxyController {
+	if client != nil {
+		return &ProxyController{svc: svc, logs: logs, client: client, internalClient: client}
 	}
+	return &ProxyController{
+		svc:            svc,
+		logs:           logs,
+		client:         &http.Client{Transport: util.NewEgressTransport(false)},
+		internalClient: &http.Client{Transport: util.NewEgressTransport(true)},
+	}
+}
 
-	fmt.Printf("解析的API名称: %s\n", apiName)
-	fmt.Printf("解析的路径: %s\n", path)
-	fmt.Printf("原始查询参数: %s\n", c.Request.URL.RawQuery)
+// ForwardRequest 代理转发请求
+func (ctl *ProxyController) ForwardRequest(c *gin.Context) {
+	// 获取 API 名称和路径
+	apiName := c.Param("apiName")
+	// 规范化路径，去掉..等片段，与访问规则判定使用的路径保持一致
+	requestPath := service.CleanProxyPath(c.Param("path"))
 
-	// 移除requestLog相关的定义、赋值、所有service.SaveRequestLog调用及相关逻辑
+	util.Logger.Debugf("代理转发: API=%s 方法=%s 路径=%s 查询参数=%s", apiName, c.Request.Method, requestPath, util.RedactQuery(c.Request.URL.RawQuery))
 
 	// 获取 API 配置
-	apiConfig, err := service.GetAPIConfigByName(apiName)
-	if err != nil {
+	apiConfig, err := ctl.svc.GetAPIConfigByName(apiName)
+	if errors.Is(err, service.ErrNotFound) {
 		util.ErrorResponse(c, http.StatusNotFound, "API配置不存在: "+apiName)
 		return
 	}
+	if err != nil {
+		util.ErrorResponse(c, http.StatusServiceUnavailable, "读取API配置失败: "+err.Error())
+		return
+	}
 	// 新增：未启用的API禁止访问
 	if !apiConfig.Active {
 		util.ErrorResponse(c, http.StatusForbidden, "该API已被禁用")
 		return
 	}
-
-	// 控制台调试输出
-	fmt.Printf("代理请求 - API名称: %s\n", apiName)
-	fmt.Printf("代理请求 - 原始路径: %s\n", path)
-	fmt.Printf("代理请求 - 方法: %s\n", c.Request.Method)
-	fmt.Printf("代理请求 - 完整URL: %s\n", apiConfig.BaseURL+path)
-
-	// 构建目标 URL（只做base_url和path原样拼接，不做任何补全）
-	targetURL := strings.TrimRight(apiConfig.BaseURL, "/") + path
-	// 自动补全协议，优先https
-	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
-		targetURL = "https://" + targetURL
-	}
-
-	// 特殊处理Gemini API的认证方式
-	if apiName == "gemini" {
-		fmt.Printf("🔍 Gemini特殊处理 - 原始targetURL: %s\n", targetURL)
-		
-		// 检查URL中是否已经包含key参数
-		if !strings.Contains(targetURL, "key=") {
-			fmt.Printf("🔍 URL中未包含key参数，尝试从Authorization头提取\n")
-			// 从Authorization头中提取API Key并添加到URL查询参数
-			authHeader := c.GetHeader("Authorization")
-			fmt.Printf("🔍 Authorization头: %s\n", authHeader)
-			
-			if authHeader != "" {
-				// 支持 "Bearer API_KEY" 或 "API_KEY" 格式
-				apiKey := strings.TrimPrefix(authHeader, "Bearer ")
-				apiKey = strings.TrimSpace(apiKey)
-				fmt.Printf("🔍 提取的API Key: %s\n", apiKey)
-				
-				// 添加key参数到URL
-				separator := "?"
-				if strings.Contains(targetURL, "?") {
-					separator = "&"
-				}
-				targetURL = targetURL + separator + "key=" + apiKey
-				fmt.Printf("🔍 添加key后的targetURL: %s\n", targetURL)
-			} else {
-				fmt.Printf("❌ 未找到Authorization头\n")
-			}
-		} else {
-			fmt.Printf("✅ URL中已包含key参数，直接使用\n")
-		}
+	// 按访问规则检查请求方法和路径
+	if decision := service.EvaluateAccessRules(apiConfig.AccessRules, c.Request.Method, requestPath); !decision.Allowed {
+		c.JSON(http.StatusForbidden, util.Response{
+			Code:    http.StatusForbidden,
+			Message: "请求被访问规则拒绝: " + decision.Rule,
+			Data: gin.H{
+				"rule":   decision.Rule,
+				"method": c.Request.Method,
+				"path":   requestPath,
+			},
+		})
+		return
 	}
 
-	// 添加调试日志
-	fmt.Printf("代理请求 - API名称: %s\n", apiName)
-	fmt.Printf("代理请求 - 原始路径: %s\n", path)
-	fmt.Printf("代理请求 - 目标URL: %s\n", targetURL)
-	fmt.Printf("代理请求 - 方法: %s\n", c.Request.Method)
-
-	// 读取请求体
-	body, err := io.ReadAll(c.Request.Body)
+	// 构建目标 URL，base_url保存时已规范化，这里再规范化一次兼容旧数据
+	baseURL, err := service.NormalizeBaseURL(apiConfig.BaseURL)
 	if err != nil {
-		util.ErrorResponse(c, http.StatusBadRequest, "读取请求体失败")
+		util.ErrorResponse(c, http.StatusBadGateway, "API配置的基础url无效: "+err.Error())
+		return
+	}
+	rewriter := service.NewRewriter(apiConfig, service.RewriteContext{
+		ClientKey: service.ClientKey(c.Request),
+		RequestID: requestID(c),
+	})
+	// Vertex使用服务账号换取的访问令牌认证，转发前先准备好令牌和项目
+	if apiConfig.Provider == service.ProviderVertex && !ctl.prepareVertex(c, apiConfig, rewriter) {
 		return
 	}
 
-	// 构建请求头
-	headers := make(map[string]string)
-	for key, values := range c.Request.Header {
-		if len(values) > 0 {
-			// 对于Gemini API，跳过Authorization头，因为我们已经将其转换为URL参数
-			if apiName == "gemini" && strings.ToLower(key) == "authorization" {
-				continue
-			}
-			headers[key] = values[0]
-		}
+	// WebSocket升级请求没有请求体，单独转发
+	if isWebSocketUpgrade(c.Request) {
+		ctl.forwardWebSocket(c, apiConfig, rewriter, upstreamURL(c, baseURL, rewriter, requestPath))
+		return
 	}
 
-	// 创建 HTTP 客户端（使用默认超时）
-	client := &http.Client{}
+	// 限制请求体大小，声明的长度超限时直接拒绝，未声明长度时在读取过程中检查
+	settings := proxySettings()
+	limit := maxBodySize(apiConfig, settings)
+	if c.Request.ContentLength > limit {
+		bodyTooLarge(c, limit)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 
-	// 创建请求
-	req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewReader(body))
+	// Bedrock需要转换请求体并签名，单独转发
+	if apiConfig.Provider == service.ProviderBedrock {
+		ctl.forwardBedrock(c, apiConfig, rewriter, baseURL, requestPath, limit, settings)
+		return
+	}
+	// Ollama原生接口的对话和模型列表与OpenAI格式不同，转换后转发，其余请求转发到Ollama的OpenAI兼容接口
+	if service.IsOllama(apiConfig) && service.OllamaTranslates(c.Request.Method, requestPath) {
+		ctl.forwardOllama(c, apiConfig, rewriter, baseURL, requestPath, limit, settings)
+		return
+	}
+
+	// 创建请求：需要执行参数策略时读取完整请求体，需要重试或从表单中读取模型名时缓存请求体（较大时写入临时文件），
+	// 否则直接把客户端的请求体流式转发给上游
+	var body io.Reader = c.Request.Body
+	contentLength := c.Request.ContentLength
+	var getBody func() (io.ReadCloser, error)
+	// 对JSON请求体执行参数策略，未声明类型或声明为纯文本的请求体同样按JSON检查；配置了参数策略时
+	// 拒绝其他类型的请求体，避免通过修改Content-Type绕过。Azure等按模型选择上游路径的API也需要读取请求体中的模型名
+	ct := c.ContentType()
+	jsonBody := strings.Contains(ct, "json") || ct == "" || ct == "text/plain"
+	hasPolicy := len(requestPolicies(c, apiConfig)) > 0
+	if hasPolicy && !jsonBody && c.Request.ContentLength != 0 {
+		util.OpenAIErrorResponse(c, http.StatusUnsupportedMediaType, "invalid_request_error", "unsupported_media_type", "",
+			"该API或客户端Key配置了请求参数策略，只接受JSON请求体，不支持 "+ct)
+		return
+	}
+	needsModel := rewriter.NeedsModel(requestPath)
+	if (hasPolicy || needsModel) && jsonBody {
+		data, ok := readPolicyBody(c, apiConfig, limit)
+		if !ok {
+			return
+		}
+		body, contentLength = bytes.NewReader(data), int64(len(data))
+		if needsModel {
+			rewriter.SetModel(service.RequestModel(data))
+		}
+	} else if (needsModel && ct == "multipart/form-data") || (settings.Retries > 0 && c.Request.ContentLength != 0) {
+		spooled, err := spoolBody(c.Request.Body)
+		if isBodyTooLarge(err) {
+			bodyTooLarge(c, limit)
+			return
+		}
+		if err != nil {
+			util.ErrorResponse(c, http.StatusBadRequest, "读取请求体失败")
+			return
+		}
+		defer spooled.Close()
+		// 音频转写等接口以表单上传文件，模型名在model字段中，文件部分可能在它之前，需要缓存整个请求体
+		if needsModel {
+			form, _ := spooled.Open()
+			rewriter.SetModel(service.MultipartModel(form, c.GetHeader("Content-Type")))
+		}
+		body, _ = spooled.Open()
+		contentLength, getBody = spooled.size, spooled.Open
+	}
+	if rewriter.ModelMissing(requestPath) {
+		util.OpenAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "missing_model", "model", "缺少model参数，无法确定上游部署")
+		return
+	}
+	targetURL := upstreamURL(c, baseURL, rewriter, requestPath)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, body)
 	if err != nil {
 		util.ErrorResponse(c, http.StatusInternalServerError, "创建请求失败")
 		return
 	}
+	req.ContentLength = contentLength
+	if getBody != nil {
+		req.GetBody = getBody
+	}
+	if contentLength == 0 {
+		req.Body, req.GetBody = http.NoBody, nil
+	}
 
 	// 设置请求头
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
+	req.Header = upstreamRequestHeader(c, settings)
+	rewriter.RequestHeaders(req.Header)
 
-	// 打印请求头调试信息
-	fmt.Printf("代理请求 - 请求头: %+v\n", req.Header)
+	util.Logger.Debugf("代理请求头: %v", util.RedactHeader(req.Header))
 
 	// 发送请求
-	resp, err := client.Do(req)
+	resp, err := doWithRetry(ctl.upstreamClient(apiConfig), req, settings.Retries)
+	if isBodyTooLarge(err) {
+		bodyTooLarge(c, limit)
+		return
+	}
+	if util.IsEgressDenied(err) {
+		util.Logger.Warnf("API %s 的上游地址被出站策略拒绝: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "上游地址被出站策略拒绝")
+		return
+	}
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadGateway, "请求失败: "+err.Error())
 		return
@@ -150,12 +210,47 @@ func ForwardRequest(c *gin.Context) {
 	}
 
 	// 设置响应头
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
-	}
+	copyResponseHeader(c.Writer.Header(), resp.Header, apiName, settings)
+	rewriter.ResponseHeaders(c.Writer.Header())
 
 	// 返回响应
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 }
+
+// upstreamURL 按改写规则调整路径和查询参数，返回上游地址，保留原始查询参数
+func upstreamURL(c *gin.Context, baseURL string, rewriter *service.Rewriter, requestPath string) string {
+	path := rewriter.Path(requestPath)
+	if query := rewriter.Query(c.Request.URL.RawQuery); query != "" {
+		path = path + "?" + query
+	}
+	util.Logger.Debugf("代理目标: API=%s 方法=%s URL=%s%s", c.Param("apiName"), c.Request.Method, baseURL, redactURLPath(path))
+	return baseURL + path
+}
+
+// redactURLPath 隐藏路径中查询参数里的凭据，用于日志输出
+func redactURLPath(p string) string {
+	if path, query, ok := strings.Cut(p, "?"); ok {
+		return path + "?" + util.RedactQuery(query)
+	}
+	return p
+}
+
+// upstreamClient 返回API使用的客户端，设置了allow_internal的API不受内网地址限制
+func (ctl *ProxyController) upstreamClient(apiConfig *model.APIConfig) *http.Client {
+	if apiConfig.AllowInternal {
+		return ctl.internalClient
+	}
+	return ctl.client
+}
+
+// requestID 返回客户端传入的X-Request-ID，没有时生成一个，并在响应头中返回
+func requestID(c *gin.Context) string {
+	id := c.GetHeader("X-Request-ID")
+	if id == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		id = hex.EncodeToString(buf)
+	}
+	c.Header("X-Request-ID", id)
+	return id
+}
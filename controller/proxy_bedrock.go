@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardBedrock 把Anthropic Messages请求转换为Bedrock调用并使用SigV4签名，
+// 流式响应的AWS事件流转为Anthropic的SSE事件
+func (ctl *ProxyController) forwardBedrock(c *gin.Context, apiConfig *model.APIConfig, rewriter *service.Rewriter, baseURL, requestPath string, limit int64, settings config.ProxyConfig) {
+	apiName := apiConfig.Name
+	opts := apiConfig.ProviderOptions.Bedrock
+	if opts == nil {
+		util.ErrorResponse(c, http.StatusBadGateway, "API配置缺少provider_options.bedrock")
+		return
+	}
+	if c.Request.Method != http.MethodPost || requestPath != "/v1/messages" {
+		util.ErrorResponse(c, http.StatusNotFound, "Bedrock只支持POST /v1/messages")
+		return
+	}
+	secret, err := service.OpenSecret(apiConfig.Secret)
+	if err != nil {
+		util.Logger.Errorf("API %s 解密凭据失败: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "解密API凭据失败")
+		return
+	}
+
+	data, ok := readPolicyBody(c, apiConfig, limit)
+	if !ok {
+		return
+	}
+	invocation, err := service.ConvertBedrockRequest(opts, data, c.Request.Header)
+	if err != nil {
+		util.OpenAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "", err.Error())
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, baseURL+invocation.Path, bytes.NewReader(invocation.Body))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusInternalServerError, "创建请求失败")
+		return
+	}
+	// 客户端的Anthropic认证头和版本头对Bedrock无效；不转发Accept-Encoding，保证能解析事件流
+	req.Header = upstreamRequestHeader(c, settings)
+	for _, name := range []string{"Authorization", "X-Api-Key", "Anthropic-Version", "Anthropic-Beta", "Accept-Encoding"} {
+		req.Header.Del(name)
+	}
+	rewriter.RequestHeaders(req.Header)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if invocation.Stream {
+		req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	}
+	util.SignV4(req, invocation.Body, util.AWSCredentials{
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: secret,
+	}, opts.Region, "bedrock", time.Now())
+
+	resp, err := doWithRetry(ctl.upstreamClient(apiConfig), req, settings.Retries)
+	if util.IsEgressDenied(err) {
+		util.Logger.Warnf("API %s 的上游地址被出站策略拒绝: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "上游地址被出站策略拒绝")
+		return
+	}
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadGateway, "请求失败: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if !invocation.Stream || resp.StatusCode != http.StatusOK {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			util.ErrorResponse(c, http.StatusInternalServerError, "读取响应体失败")
+			return
+		}
+		copyResponseHeader(c.Writer.Header(), resp.Header, apiName, settings)
+		rewriter.ResponseHeaders(c.Writer.Header())
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+		return
+	}
+
+	// 流式响应：每个事件写出后立即刷新
+	copyResponseHeader(c.Writer.Header(), resp.Header, apiName, settings)
+	rewriter.ResponseHeaders(c.Writer.Header())
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	err = service.DecodeBedrockStream(resp.Body, func(event string, data []byte) error {
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		util.Logger.Warnf("API %s 转换Bedrock事件流失败: %v", apiName, err)
+		data, _ := json.Marshal(gin.H{"type": "error", "error": gin.H{"type": "api_error", "message": err.Error()}})
+		fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", data)
+		c.Writer.Flush()
+	}
+}
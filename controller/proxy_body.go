@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxBodySize = 100     // 默认请求体大小上限（MB）
+	bodyMemoryLimit    = 1 << 20 // 需要缓存的请求体超过1MB时写入临时文件
+)
+
+// maxBodySize 返回API的请求体大小上限（字节），API配置优先于全局配置
+func maxBodySize(apiConfig *model.APIConfig, settings config.ProxyConfig) int64 {
+	mb := defaultMaxBodySize
+	if apiConfig.MaxBodySize > 0 {
+		mb = apiConfig.MaxBodySize
+	} else if settings.MaxBodySize > 0 {
+		mb = settings.MaxBodySize
+	}
+	return int64(mb) << 20
+}
+
+// isBodyTooLarge 判断错误是否由请求体超过大小上限引起
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// spooledBody 可重复读取的请求体，不超过bodyMemoryLimit时保存在内存，超过后写入临时文件，
+// 用于重试时重新发送请求体
+type spooledBody struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+// spoolBody 读取完整请求体
+func spoolBody(r io.Reader) (*spooledBody, error) {
+	head, err := io.ReadAll(io.LimitReader(r, bodyMemoryLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) <= bodyMemoryLimit {
+		return &spooledBody{mem: head, size: int64(len(head))}, nil
+	}
+
+	file, err := os.CreateTemp("", "ai-proxy-body-*")
+	if err != nil {
+		return nil, err
+	}
+	b := &spooledBody{file: file}
+	n, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.size = n
+	return b, nil
+}
+
+// Open 返回从头读取请求体的Reader，可以多次调用
+func (b *spooledBody) Open() (io.ReadCloser, error) {
+	if b.file == nil {
+		return io.NopCloser(bytes.NewReader(b.mem)), nil
+	}
+	return io.NopCloser(io.NewSectionReader(b.file, 0, b.size)), nil
+}
+
+// Close 删除临时文件
+func (b *spooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// doWithRetry 发送请求，连接上游失败时最多重试retries次。只有请求体可以重新读取时才重试，
+// 非幂等请求只在连接建立前失败时重试，避免上游重复处理
+func doWithRetry(client *http.Client, req *http.Request, retries int) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err == nil || attempt >= retries || !shouldRetry(req, err) {
+			return resp, err
+		}
+		util.Logger.Warnf("请求上游失败，第%d次重试: %v", attempt+1, err)
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = next
+	}
+}
+
+func shouldRetry(req *http.Request, err error) bool {
+	if util.IsEgressDenied(err) || isBodyTooLarge(err) || errors.Is(err, context.Canceled) || req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// readPolicyBody 读取完整的JSON请求体并执行客户端Key和API的参数策略，失败时已写出错误响应
+func readPolicyBody(c *gin.Context, apiConfig *model.APIConfig, limit int64) ([]byte, bool) {
+	data, err := io.ReadAll(c.Request.Body)
+	if isBodyTooLarge(err) {
+		bodyTooLarge(c, limit)
+		return nil, false
+	}
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, "读取请求体失败")
+		return nil, false
+	}
+	for _, policy := range requestPolicies(c, apiConfig) {
+		var violation *service.PolicyViolation
+		if data, violation = service.ApplyRequestPolicy(policy, data); violation != nil {
+			util.OpenAIErrorResponse(c, violation.Status, "invalid_request_error", violation.Code, violation.Param, violation.Message)
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// requestPolicies 返回请求需要执行的参数策略：先执行客户端Key绑定的策略，再执行API的策略，
+// 两者的限制都要满足，force冲突时以API的策略为准
+func requestPolicies(c *gin.Context, apiConfig *model.APIConfig) []model.RequestPolicy {
+	var policies []model.RequestPolicy
+	if policy := service.KeyRequestPolicy(service.ClientKey(c.Request)); !policy.IsEmpty() {
+		policies = append(policies, policy)
+	}
+	if !apiConfig.RequestPolicy.IsEmpty() {
+		policies = append(policies, apiConfig.RequestPolicy)
+	}
+	return policies
+}
+
+// bodyTooLarge 返回413
+func bodyTooLarge(c *gin.Context, limit int64) {
+	util.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体超过大小上限 %dMB", limit>>20))
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"AI-PROXY/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hopByHopHeaders RFC 7230 第6.1节规定的逐跳头，只对单个连接有效，代理不能转发
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// proxySettings 读取当前代理转发配置，未加载配置时使用默认值
+func proxySettings() config.ProxyConfig {
+	if cfg := config.Get(); cfg != nil {
+		return cfg.Proxy
+	}
+	return config.ProxyConfig{}
+}
+
+// removeHopByHopHeaders 删除逐跳头，包括Connection头中列出的头
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// upstreamRequestHeader 构造发往上游的请求头：保留多值头，删除逐跳头和Content-Length（由请求体决定），
+// 追加X-Forwarded-For并设置X-Forwarded-Proto/Host。客户端的Accept-Encoding原样转发，上游压缩的响应直接透传
+func upstreamRequestHeader(c *gin.Context, settings config.ProxyConfig) http.Header {
+	h := c.Request.Header.Clone()
+	removeHopByHopHeaders(h)
+	h.Del("Content-Length")
+
+	if settings.DisableForwardedHeaders {
+		h.Del("X-Forwarded-For")
+		h.Del("X-Forwarded-Proto")
+		h.Del("X-Forwarded-Host")
+		h.Del("Forwarded")
+		return h
+	}
+	clientIP, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		clientIP = c.Request.RemoteAddr
+	}
+	if prior := h.Values("X-Forwarded-For"); len(prior) > 0 {
+		clientIP = strings.Join(prior, ", ") + ", " + clientIP
+	}
+	h.Set("X-Forwarded-For", clientIP)
+	proto := "http"
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+	h.Set("X-Forwarded-Proto", proto)
+	h.Set("X-Forwarded-Host", c.Request.Host)
+	return h
+}
+
+// copyResponseHeader 将上游响应头复制给客户端：删除逐跳头和Content-Length（由实际写出的响应体决定），
+// 删除上游的CORS头（以本服务的CORS配置为准），按配置处理Set-Cookie，多值头全部保留
+func copyResponseHeader(dst, src http.Header, apiName string, settings config.ProxyConfig) {
+	h := src.Clone()
+	removeHopByHopHeaders(h)
+	h.Del("Content-Length")
+	for key := range h {
+		if strings.HasPrefix(key, "Access-Control-") {
+			delete(h, key)
+		}
+	}
+	applySetCookiePolicy(h, apiName, settings.SetCookie)
+
+	for key, values := range h {
+		dst.Del(key)
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+// applySetCookiePolicy 按配置处理上游返回的Set-Cookie
+func applySetCookiePolicy(h http.Header, apiName, policy string) {
+	switch policy {
+	case config.SetCookieStrip:
+		h.Del("Set-Cookie")
+	case config.SetCookieRewrite:
+		cookies := (&http.Response{Header: h}).Cookies()
+		h.Del("Set-Cookie")
+		for _, cookie := range cookies {
+			cookie.Domain = ""
+			cookie.Path = "/" + apiName + "/" + strings.TrimLeft(cookie.Path, "/")
+			if v := cookie.String(); v != "" {
+				h.Add("Set-Cookie", v)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 汇总模型列表时单个API的超时时间，避免个别离线的本地服务拖慢整个列表
+const localModelsTimeout = 10 * time.Second
+
+// 模型列表响应体的长度上限
+const localModelsMaxSize = 16 << 20
+
+// forwardOllama 把OpenAI的对话和模型列表请求转换为Ollama原生接口，流式响应的NDJSON转为SSE
+func (ctl *ProxyController) forwardOllama(c *gin.Context, apiConfig *model.APIConfig, rewriter *service.Rewriter, baseURL, requestPath string, limit int64, settings config.ProxyConfig) {
+	apiName := apiConfig.Name
+	if requestPath != "/v1/chat/completions" {
+		header := upstreamRequestHeader(c, settings)
+		models, err := ctl.fetchLocalModels(c.Request.Context(), apiConfig, rewriter, baseURL, header)
+		if err != nil {
+			localUpstreamError(c, apiName, err)
+			return
+		}
+		c.JSON(http.StatusOK, service.ModelList{Object: "list", Data: models})
+		return
+	}
+
+	data, ok := readPolicyBody(c, apiConfig, limit)
+	if !ok {
+		return
+	}
+	chat, err := service.ConvertOllamaChatRequest(data)
+	if err != nil {
+		util.OpenAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "", err.Error())
+		return
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, upstreamURL(c, baseURL, rewriter, "/api/chat"), bytes.NewReader(chat.Body))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusInternalServerError, "创建请求失败")
+		return
+	}
+	// 不转发Accept-Encoding，保证能逐行解析流式响应
+	req.Header = upstreamRequestHeader(c, settings)
+	req.Header.Del("Accept-Encoding")
+	rewriter.RequestHeaders(req.Header)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithRetry(ctl.upstreamClient(apiConfig), req, settings.Retries)
+	if err != nil {
+		localUpstreamError(c, apiName, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	id := requestID(c)
+	if !chat.Stream || resp.StatusCode != http.StatusOK {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			util.ErrorResponse(c, http.StatusInternalServerError, "读取响应体失败")
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			errType := "invalid_request_error"
+			if resp.StatusCode >= http.StatusInternalServerError {
+				errType = "api_error"
+			}
+			util.OpenAIErrorResponse(c, resp.StatusCode, errType, "", "", service.OllamaError(respBody))
+			return
+		}
+		out, err := service.ConvertOllamaChatResponse(respBody, id)
+		if err != nil {
+			util.OpenAIErrorResponse(c, http.StatusBadGateway, "api_error", "", "", err.Error())
+			return
+		}
+		rewriter.ResponseHeaders(c.Writer.Header())
+		c.Data(http.StatusOK, "application/json", out)
+		return
+	}
+
+	// 流式响应：每行转换为一个SSE事件并立即刷新
+	rewriter.ResponseHeaders(c.Writer.Header())
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	err = service.DecodeOllamaStream(resp.Body, chat, id, func(data []byte) error {
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		util.Logger.Warnf("API %s 转换Ollama流式响应失败: %v", apiName, err)
+		data, _ := json.Marshal(gin.H{"error": gin.H{"type": "api_error", "message": err.Error()}})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+}
+
+// ListModels 汇总所有启用的本地模型服务的模型列表，每个模型的api字段为提供该模型的API名称；
+// 访问规则不允许GET /v1/models的API和请求失败的API不计入。该接口无需认证且会请求所有本地服务，
+// 需开启proxy.model_list
+func (ctl *ProxyController) ListModels(c *gin.Context) {
+	if !proxySettings().ModelList {
+		util.OpenAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", "not_found", "", "模型列表未开启")
+		return
+	}
+	active := true
+	configs, _, err := ctl.svc.FindAPIConfigs(repository.APIConfigFilter{Provider: service.ProviderLocal, Active: &active, Limit: 500})
+	if err != nil {
+		util.ErrorResponse(c, http.StatusServiceUnavailable, "读取API配置失败: "+err.Error())
+		return
+	}
+
+	rewriteCtx := service.RewriteContext{RequestID: requestID(c)}
+	results := make([][]service.ModelInfo, len(configs))
+	var wg sync.WaitGroup
+	for i := range configs {
+		apiConfig := &configs[i]
+		if !service.EvaluateAccessRules(apiConfig.AccessRules, http.MethodGet, "/v1/models").Allowed {
+			continue
+		}
+		baseURL, err := service.NormalizeBaseURL(apiConfig.BaseURL)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reqCtx, cancel := context.WithTimeout(c.Request.Context(), localModelsTimeout)
+			defer cancel()
+			// 不转发客户端的请求头，避免把客户端的凭据发给所有本地服务
+			rewriter := service.NewRewriter(apiConfig, rewriteCtx)
+			models, err := ctl.fetchLocalModels(reqCtx, apiConfig, rewriter, baseURL, http.Header{})
+			if err != nil {
+				util.Logger.Warnf("获取API %s 的模型列表失败: %v", apiConfig.Name, err)
+				return
+			}
+			for j := range models {
+				models[j].API = apiConfig.Name
+			}
+			results[i] = models
+		}(i)
+	}
+	wg.Wait()
+
+	list := service.ModelList{Object: "list", Data: []service.ModelInfo{}}
+	for _, models := range results {
+		list.Data = append(list.Data, models...)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// fetchLocalModels 请求本地模型服务的模型列表并转换为OpenAI格式
+func (ctl *ProxyController) fetchLocalModels(ctx context.Context, apiConfig *model.APIConfig, rewriter *service.Rewriter, baseURL string, header http.Header) ([]service.ModelInfo, error) {
+	target := baseURL + rewriter.Path(service.LocalModelsPath(apiConfig))
+	if query := rewriter.Query(""); query != "" {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Del("Accept-Encoding")
+	rewriter.RequestHeaders(req.Header)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ctl.upstreamClient(apiConfig).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, localModelsMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("上游返回%d: %s", resp.StatusCode, service.OllamaError(body))
+	}
+	return service.ParseLocalModels(apiConfig, body)
+}
+
+// localUpstreamError 请求本地模型服务失败时返回502
+func localUpstreamError(c *gin.Context, apiName string, err error) {
+	if util.IsEgressDenied(err) {
+		util.Logger.Warnf("API %s 的上游地址被出站策略拒绝: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "上游地址被出站策略拒绝")
+		return
+	}
+	util.ErrorResponse(c, http.StatusBadGateway, "请求失败: "+err.Error())
+}
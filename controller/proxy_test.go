@@ -0,0 +1,1112 @@
+package controller_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"hash/crc32"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/router"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamRequest 上游收到的请求
+type upstreamRequest struct {
+	method string
+	path   string
+	query  string
+	body   string
+	header http.Header
+}
+
+// newUpstream 启动一个记录请求并返回固定响应的上游服务
+func newUpstream(t *testing.T) (*httptest.Server, *upstreamRequest) {
+	t.Helper()
+	got := &upstreamRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.method = r.Method
+		got.path = r.URL.Path
+		got.query = r.URL.RawQuery
+		got.body = string(body)
+		got.header = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream", "ok")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"chatcmpl-1"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+// newTestRouter 使用内存存储创建完整路由
+func newTestRouter(t *testing.T, apis ...model.APIConfig) (*gin.Engine, *repository.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	util.InitLogger(&config.LogConfig{Level: "error"})
+
+	store := repository.NewMemoryStore()
+	for i := range apis {
+		if err := store.APIConfigs.Create(&apis[i]); err != nil {
+			t.Fatalf("创建API配置失败: %v", err)
+		}
+	}
+	return router.SetupRouter(service.New(store)), store
+}
+
+func TestForwardRequest(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{Name: "openai", BaseURL: upstream.URL + "/", AllowInternal: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions?stream=false", strings.NewReader(`{"model":"gpt-4o"}`))
+	req.Header.Set("Authorization", "Bearer sk-test")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, 期望 %d, body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if w.Body.String() != `{"id":"chatcmpl-1"}` {
+		t.Errorf("响应体 = %s", w.Body.String())
+	}
+	if w.Header().Get("X-Upstream") != "ok" {
+		t.Errorf("未透传上游响应头")
+	}
+	if got.method != http.MethodPost || got.path != "/v1/chat/completions" || got.query != "stream=false" {
+		t.Errorf("上游收到 %s %s?%s", got.method, got.path, got.query)
+	}
+	if got.body != `{"model":"gpt-4o"}` {
+		t.Errorf("上游收到的请求体 = %s", got.body)
+	}
+	if got.header.Get("Authorization") != "Bearer sk-test" {
+		t.Errorf("上游收到的Authorization = %q", got.header.Get("Authorization"))
+	}
+}
+
+func TestForwardRequestUnknownAPI(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing/v1/models", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("状态码 = %d, 期望 %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestForwardRequestInactiveAPI(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, store := newTestRouter(t, model.APIConfig{Name: "openai", BaseURL: upstream.URL, AllowInternal: true})
+	if _, err := store.APIConfigs.UpdateFields("openai", map[string]interface{}{"active": false}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openai/v1/models", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("状态码 = %d, 期望 %d", w.Code, http.StatusForbidden)
+	}
+	if got.method != "" {
+		t.Errorf("禁用的API不应转发到上游")
+	}
+}
+
+func TestForwardRequestGeminiKey(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t,
+		model.APIConfig{Name: "google", BaseURL: upstream.URL, Provider: service.ProviderGemini, AllowInternal: true},
+		model.APIConfig{Name: "gemini", BaseURL: upstream.URL, AllowInternal: true},
+	)
+
+	// 内置规则只按provider生效，与名称无关
+	req := httptest.NewRequest(http.MethodPost, "/gemini/v1beta/models/gemini-pro:generateContent", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer g-key")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if got.query != "" || got.header.Get("Authorization") != "Bearer g-key" {
+		t.Errorf("未设置provider时不应改写: query = %s, Authorization = %s", got.query, got.header.Get("Authorization"))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/google/v1beta/models/gemini-pro:generateContent?alt=sse", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer g-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.query != "alt=sse&key=g-key" {
+		t.Errorf("上游收到的查询参数 = %s", got.query)
+	}
+	if got.header.Get("Authorization") != "" {
+		t.Errorf("Gemini请求不应转发Authorization头")
+	}
+}
+
+func TestForwardRequestEgressDenied(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{Name: "internal", BaseURL: upstream.URL})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/v1/models", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("状态码 = %d, 期望 %d", w.Code, http.StatusBadGateway)
+	}
+	if got.method != "" {
+		t.Errorf("回环地址不应被访问")
+	}
+}
+
+func TestForwardRequestAccessRules(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "openai",
+		BaseURL:       upstream.URL,
+		AllowInternal: true,
+		AccessRules: model.AccessRules{
+			{Name: "no-files", Action: model.RuleActionDeny, Paths: []string{"/v1/files/**"}},
+			{Name: "inference", Action: model.RuleActionAllow, Methods: []string{"POST"}, Paths: []string{"/v1/chat/completions", "/v1/embeddings"}},
+		},
+	})
+
+	cases := []struct {
+		method, path string
+		status       int
+		rule         string
+	}{
+		{http.MethodPost, "/openai/v1/chat/completions", http.StatusCreated, ""},
+		{http.MethodGet, "/openai/v1/chat/completions", http.StatusForbidden, "default-deny"},
+		{http.MethodPost, "/openai/v1/files/abc/content", http.StatusForbidden, "no-files"},
+		{http.MethodPost, "/openai/v1/chat/../files", http.StatusForbidden, "no-files"},
+	}
+	for _, tc := range cases {
+		*got = upstreamRequest{}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{}`)))
+		if w.Code != tc.status {
+			t.Errorf("%s %s 状态码 = %d, 期望 %d", tc.method, tc.path, w.Code, tc.status)
+			continue
+		}
+		if tc.rule != "" {
+			if !strings.Contains(w.Body.String(), `"rule":"`+tc.rule+`"`) {
+				t.Errorf("%s %s 响应未包含规则 %s: %s", tc.method, tc.path, tc.rule, w.Body.String())
+			}
+			if got.method != "" {
+				t.Errorf("%s %s 被拒绝的请求不应转发到上游", tc.method, tc.path)
+			}
+		}
+	}
+}
+
+func TestForwardRequestPolicy(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "openai",
+		BaseURL:       upstream.URL,
+		AllowInternal: true,
+		RequestPolicy: model.RequestPolicy{
+			AllowedModels: []string{"gpt-4o-mini*"},
+			MaxTokens:     1000,
+			Strip:         []string{"user"},
+			Defaults:      map[string]interface{}{"temperature": 0.2},
+			Force:         map[string]interface{}{"logprobs": false},
+		},
+	})
+
+	sendAs := func(contentType, body string) *httptest.ResponseRecorder {
+		*got = upstreamRequest{}
+		req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send := func(body string) *httptest.ResponseRecorder {
+		return sendAs("application/json", body)
+	}
+
+	w := send(`{"model":"gpt-4o-mini","max_tokens":500,"user":"u1","logprobs":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if want := `{"logprobs":false,"max_tokens":500,"model":"gpt-4o-mini","temperature":0.2}`; got.body != want {
+		t.Errorf("上游收到的请求体 = %s, 期望 %s", got.body, want)
+	}
+
+	w = send(`{"model":"gpt-4o","max_tokens":500}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"model_not_allowed"`) {
+		t.Errorf("不允许的模型: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	w = send(`{"model":"gpt-4o-mini","max_tokens":100000}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param":"max_tokens"`) {
+		t.Errorf("超过max_tokens上限: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.method != "" {
+		t.Errorf("违反策略的请求不应转发到上游")
+	}
+
+	// 不能通过修改Content-Type绕过参数策略
+	for _, contentType := range []string{"application/octet-stream", "multipart/form-data; boundary=x"} {
+		w = sendAs(contentType, `{"model":"gpt-4o","max_tokens":500}`)
+		if w.Code != http.StatusUnsupportedMediaType || !strings.Contains(w.Body.String(), `"code":"unsupported_media_type"`) {
+			t.Errorf("%s: 状态码 = %d, body: %s", contentType, w.Code, w.Body.String())
+		}
+		if got.method != "" {
+			t.Errorf("%s: 请求不应转发到上游", contentType)
+		}
+	}
+
+	// 没有请求体的请求正常转发
+	*got = upstreamRequest{}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openai/v1/models", nil))
+	if w.Code != http.StatusCreated || got.method != http.MethodGet {
+		t.Errorf("GET请求: 状态码 = %d, 上游方法 = %q", w.Code, got.method)
+	}
+}
+
+func TestForwardRequestKeyPolicy(t *testing.T) {
+	sum := sha256.Sum256([]byte("sk-team-a"))
+	prev := config.Get()
+	config.Set(&config.Config{KeyPolicies: []config.KeyPolicyConfig{{
+		Name:      "team-a",
+		KeySHA256: hex.EncodeToString(sum[:]),
+		Policy: model.RequestPolicy{
+			AllowedModels: []string{"gpt-4o-mini"},
+			Force:         map[string]interface{}{"temperature": 0},
+		},
+	}}})
+	t.Cleanup(func() { config.Set(prev) })
+
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "openai",
+		BaseURL:       upstream.URL,
+		AllowInternal: true,
+		RequestPolicy: model.RequestPolicy{
+			MaxTokens: 1000,
+			Force:     map[string]interface{}{"temperature": 0.5},
+		},
+	})
+
+	send := func(key, contentType, body string) *httptest.ResponseRecorder {
+		*got = upstreamRequest{}
+		req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Key策略和API策略都生效，force冲突时以API为准
+	w := send("sk-team-a", "application/json", `{"model":"gpt-4o-mini","max_tokens":500}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if want := `{"max_tokens":500,"model":"gpt-4o-mini","temperature":0.5}`; got.body != want {
+		t.Errorf("上游收到的请求体 = %s, 期望 %s", got.body, want)
+	}
+
+	w = send("sk-team-a", "application/json", `{"model":"gpt-4o","max_tokens":500}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"model_not_allowed"`) {
+		t.Errorf("Key不允许的模型: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	w = send("sk-team-a", "application/json", `{"model":"gpt-4o-mini","max_tokens":100000}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param":"max_tokens"`) {
+		t.Errorf("超过API的max_tokens上限: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// 其他Key只受API策略限制
+	w = send("sk-team-b", "application/json", `{"model":"gpt-4o","max_tokens":500}`)
+	if w.Code != http.StatusCreated || got.body != `{"max_tokens":500,"model":"gpt-4o","temperature":0.5}` {
+		t.Errorf("其他Key: 状态码 = %d, 上游收到的请求体 = %s", w.Code, got.body)
+	}
+}
+
+func TestForwardRequestKeyPolicyOnly(t *testing.T) {
+	sum := sha256.Sum256([]byte("sk-team-a"))
+	prev := config.Get()
+	config.Set(&config.Config{KeyPolicies: []config.KeyPolicyConfig{{
+		KeySHA256: hex.EncodeToString(sum[:]),
+		Policy:    model.RequestPolicy{AllowedModels: []string{"gpt-4o-mini"}},
+	}}})
+	t.Cleanup(func() { config.Set(prev) })
+
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{Name: "openai", BaseURL: upstream.URL, AllowInternal: true})
+
+	send := func(key, contentType string) *httptest.ResponseRecorder {
+		*got = upstreamRequest{}
+		req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// API没有配置策略时，Key绑定的策略同样拒绝非JSON请求体
+	if w := send("sk-team-a", "application/octet-stream"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("非JSON请求体: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := send("sk-team-a", "application/json"); w.Code != http.StatusForbidden {
+		t.Errorf("Key不允许的模型: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := send("sk-team-b", "application/octet-stream"); w.Code != http.StatusCreated || got.body != `{"model":"gpt-4o"}` {
+		t.Errorf("未绑定策略的Key: 状态码 = %d, 上游收到的请求体 = %s", w.Code, got.body)
+	}
+}
+
+func TestForwardRequestRewrite(t *testing.T) {
+	t.Setenv("AI_PROXY_ORG", "org-1")
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "openai",
+		BaseURL:       upstream.URL,
+		AllowInternal: true,
+		Rewrite: model.RewriteRules{
+			RequestHeaders: model.HeaderRewrite{
+				Remove: []string{"X-Debug"},
+				Set:    map[string]string{"OpenAI-Organization": "${env.AI_PROXY_ORG}", "X-Trace": "${request_id}"},
+			},
+			Query: model.QueryRewrite{Remove: []string{"debug"}, Set: map[string]string{"api-version": "2024-06-01"}},
+			Path: model.PathRewrite{
+				StripPrefix: "/openai",
+				Regex:       []model.RegexRewrite{{Pattern: `^/v1/(.*)$`, Replacement: "/v2/$1"}},
+				AddPrefix:   "/api",
+			},
+			ResponseHeaders: model.HeaderRewrite{Remove: []string{"X-Upstream"}, Set: map[string]string{"X-Served-By": "ai-proxy"}},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/openai/openai/v1/models?debug=1&limit=5", nil)
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.path != "/api/v2/models" {
+		t.Errorf("上游收到的路径 = %s", got.path)
+	}
+	if got.query != "api-version=2024-06-01&limit=5" {
+		t.Errorf("上游收到的查询参数 = %s", got.query)
+	}
+	if got.header.Get("X-Debug") != "" || got.header.Get("OpenAI-Organization") != "org-1" || got.header.Get("X-Trace") != "req-42" {
+		t.Errorf("上游收到的请求头 = %v", got.header)
+	}
+	if w.Header().Get("X-Upstream") != "" || w.Header().Get("X-Served-By") != "ai-proxy" {
+		t.Errorf("响应头 = %v", w.Header())
+	}
+}
+
+func TestForwardRequestHeaders(t *testing.T) {
+	prev := config.Get()
+	config.Set(&config.Config{Proxy: config.ProxyConfig{SetCookie: config.SetCookieRewrite}})
+	t.Cleanup(func() { config.Set(prev) })
+
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("Access-Control-Allow-Origin", "https://upstream.example")
+		w.Header().Set("Connection", "X-Internal")
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Add("Set-Cookie", "sid=1; Domain=upstream.example; Path=/v1")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("compressed"))
+	}))
+	t.Cleanup(upstream.Close)
+	r, _ := newTestRouter(t, model.APIConfig{Name: "openai", BaseURL: upstream.URL, AllowInternal: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/openai/v1/models", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Connection", "keep-alive, X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Proxy-Authorization", "Basic abc")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if v := got.Values("Accept"); len(v) != 2 {
+		t.Errorf("多值请求头未完整转发: %v", v)
+	}
+	if got.Get("X-Hop") != "" || got.Get("Proxy-Authorization") != "" {
+		t.Errorf("逐跳请求头不应转发: %v", got)
+	}
+	if got.Get("X-Forwarded-For") != "198.51.100.1, 203.0.113.7" || got.Get("X-Forwarded-Proto") != "http" || got.Get("X-Forwarded-Host") == "" {
+		t.Errorf("X-Forwarded头 = %v", got)
+	}
+	if v := w.Header().Values("X-Multi"); len(v) != 2 {
+		t.Errorf("多值响应头未完整返回: %v", v)
+	}
+	if w.Header().Get("X-Internal") != "" || w.Header().Get("Connection") != "" {
+		t.Errorf("逐跳响应头不应返回: %v", w.Header())
+	}
+	if v := w.Header().Values("Access-Control-Allow-Origin"); len(v) != 1 || v[0] != "*" {
+		t.Errorf("CORS头应以本服务配置为准: %v", v)
+	}
+	if w.Header().Get("Set-Cookie") != "sid=1; Path=/openai/v1" {
+		t.Errorf("Set-Cookie = %q", w.Header().Get("Set-Cookie"))
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Body.String() != "compressed" {
+		t.Errorf("压缩响应应原样透传: %v %q", w.Header(), w.Body.String())
+	}
+}
+
+// newWebSocketUpstream 启动一个回显第一条消息后保持连接的WebSocket上游，返回握手请求头
+func newWebSocketUpstream(t *testing.T) (*httptest.Server, chan http.Header) {
+	t.Helper()
+	handshake := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handshake <- r.Header.Clone()
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n")
+		brw.WriteString("Sec-WebSocket-Protocol: realtime\r\n\r\n")
+		brw.Flush()
+
+		// 读取一个带掩码的短帧，去掩码后原样回显
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(brw, header); err != nil {
+			return
+		}
+		payload := make([]byte, header[1]&0x7f)
+		io.ReadFull(brw, payload)
+		for i := range payload {
+			payload[i] ^= header[2+i%4]
+		}
+		conn.Write(append([]byte{0x81, byte(len(payload))}, payload...))
+		io.Copy(io.Discard, brw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, handshake
+}
+
+func TestForwardRequestWebSocket(t *testing.T) {
+	prev := config.Get()
+	config.Set(&config.Config{Proxy: config.ProxyConfig{WebSocket: config.WebSocketConfig{IdleTimeout: 1}}})
+	t.Cleanup(func() { config.Set(prev) })
+
+	upstream, handshake := newWebSocketUpstream(t)
+	r, store := newTestRouter(t, model.APIConfig{
+		Name:          "openai",
+		BaseURL:       upstream.URL,
+		AllowInternal: true,
+		Rewrite: model.RewriteRules{
+			RequestHeaders: model.HeaderRewrite{Set: map[string]string{"Authorization": "Bearer sk-upstream"}},
+		},
+	})
+	proxy := httptest.NewServer(r)
+	t.Cleanup(proxy.Close)
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("连接代理失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /openai/v1/realtime?model=gpt-4o-realtime HTTP/1.1\r\nHost: proxy\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: realtime, openai-beta.realtime-v1\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("读取握手响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("状态码 = %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" || resp.Header.Get("Sec-WebSocket-Protocol") != "realtime" {
+		t.Errorf("握手响应头 = %v", resp.Header)
+	}
+	got := <-handshake
+	if got.Get("Authorization") != "Bearer sk-upstream" || got.Get("Sec-WebSocket-Protocol") != "realtime, openai-beta.realtime-v1" {
+		t.Errorf("上游收到的握手请求头 = %v", got)
+	}
+
+	// 发送一条带掩码的文本消息，应收到上游的回显
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x81, 0x80 | 5}, mask...)
+	for i, b := range []byte("hello") {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+	echo := make([]byte, 7)
+	if _, err := io.ReadFull(br, echo); err != nil {
+		t.Fatalf("读取回显失败: %v", err)
+	}
+	if string(echo[2:]) != "hello" {
+		t.Errorf("回显 = %q", echo[2:])
+	}
+
+	// 超过空闲时间后代理发送1001关闭帧并断开
+	closing := make([]byte, 4)
+	if _, err := io.ReadFull(br, closing); err != nil {
+		t.Fatalf("读取关闭帧失败: %v", err)
+	}
+	if closing[0] != 0x88 || int(closing[2])<<8|int(closing[3]) != 1001 {
+		t.Errorf("关闭帧 = %v", closing)
+	}
+
+	// 会话统计写入请求日志
+	var logs []model.RequestLog
+	for deadline := time.Now().Add(3 * time.Second); len(logs) == 0 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		logs, _ = store.RequestLogs.FindRecent("openai", 1)
+	}
+	if len(logs) != 1 {
+		t.Fatal("未记录WebSocket会话日志")
+	}
+	log := logs[0]
+	if log.StatusCode != http.StatusSwitchingProtocols || log.CloseReason != "idle_timeout" ||
+		log.RequestMessages != 1 || log.ResponseMessages != 1 || log.RequestBytes != int64(len(frame)) {
+		t.Errorf("会话日志 = %+v", log)
+	}
+}
+
+func TestForwardRequestBodyLimit(t *testing.T) {
+	prev := config.Get()
+	config.Set(&config.Config{Proxy: config.ProxyConfig{Retries: 1}})
+	t.Cleanup(func() { config.Set(prev) })
+
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t,
+		model.APIConfig{Name: "small", BaseURL: upstream.URL, AllowInternal: true, MaxBodySize: 1},
+		model.APIConfig{Name: "large", BaseURL: upstream.URL, AllowInternal: true, MaxBodySize: 4},
+	)
+	send := func(path string, size int, chunked bool) *httptest.ResponseRecorder {
+		got.body = ""
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("a", size)))
+		req.Header.Set("Content-Type", "audio/wav")
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 声明长度超限时不转发，未声明长度时读取过程中超限同样返回413
+	if w := send("/small/v1/audio/transcriptions", 2<<20, false); w.Code != http.StatusRequestEntityTooLarge || got.body != "" {
+		t.Errorf("声明长度超限: 状态码 = %d, 上游收到 %d 字节", w.Code, len(got.body))
+	}
+	if w := send("/small/v1/audio/transcriptions", 2<<20, true); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("未声明长度超限: 状态码 = %d", w.Code)
+	}
+	// 需要重试时超过内存上限的请求体写入临时文件，上游收到完整请求体
+	if w := send("/large/v1/audio/transcriptions", 3<<20, true); w.Code != http.StatusCreated || len(got.body) != 3<<20 {
+		t.Errorf("大请求体: 状态码 = %d, 上游收到 %d 字节", w.Code, len(got.body))
+	}
+}
+
+func TestForwardRequestAzure(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "azure",
+		BaseURL:       upstream.URL,
+		Provider:      "azure",
+		AllowInternal: true,
+		ProviderOptions: model.ProviderOptions{Azure: &model.AzureOptions{
+			APIVersion:  "2024-06-01",
+			Deployments: map[string]string{"gpt-4o": "prod-gpt4o"},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/azure/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer sk-azure")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.path != "/openai/deployments/prod-gpt4o/chat/completions" || got.query != "api-version=2024-06-01" {
+		t.Errorf("上游收到的地址 = %s?%s", got.path, got.query)
+	}
+	if got.header.Get("api-key") != "sk-azure" || got.header.Get("Authorization") != "" {
+		t.Errorf("上游收到的认证头 = %v", got.header)
+	}
+	if got.body != `{"model":"gpt-4o","messages":[]}` {
+		t.Errorf("上游收到的请求体 = %s", got.body)
+	}
+
+	// 不需要部署的接口转发到/openai下，客户端指定的api-version优先
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/azure/v1/models?api-version=2024-10-21", nil))
+	if got.path != "/openai/models" || got.query != "api-version=2024-10-21" {
+		t.Errorf("上游收到的地址 = %s?%s", got.path, got.query)
+	}
+
+	// 没有模型也没有默认部署时拒绝
+	req = httptest.NewRequest(http.MethodPost, "/azure/v1/embeddings", strings.NewReader(`{"input":"hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "missing_model") {
+		t.Errorf("缺少模型: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestForwardRequestAzureMultipart(t *testing.T) {
+	upstream, got := newUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "azure",
+		BaseURL:       upstream.URL,
+		Provider:      "azure",
+		AllowInternal: true,
+		ProviderOptions: model.ProviderOptions{Azure: &model.AzureOptions{
+			APIVersion:  "2024-06-01",
+			Deployments: map[string]string{"whisper-1": "prod-whisper"},
+		}},
+	})
+
+	// 文件部分在model字段之前，且超过内存缓存上限
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	file, _ := form.CreateFormFile("file", "audio.mp3")
+	file.Write(bytes.Repeat([]byte{0xff}, 1<<20+1))
+	form.WriteField("model", "whisper-1")
+	form.Close()
+	want := buf.String()
+
+	for _, p := range []string{"/v1/audio/transcriptions", "/v1/audio/translations"} {
+		*got = upstreamRequest{}
+		req := httptest.NewRequest(http.MethodPost, "/azure"+p, strings.NewReader(want))
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: 状态码 = %d, body: %s", p, w.Code, w.Body.String())
+		}
+		if wantPath := "/openai/deployments/prod-whisper" + strings.TrimPrefix(p, "/v1"); got.path != wantPath {
+			t.Errorf("%s: 上游收到的路径 = %s", p, got.path)
+		}
+		if got.body != want {
+			t.Errorf("%s: 上游收到的请求体长度 = %d, 期望 %d", p, len(got.body), len(want))
+		}
+	}
+
+	// 表单中没有model字段时拒绝
+	buf.Reset()
+	form = multipart.NewWriter(&buf)
+	form.WriteField("language", "zh")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/azure/v1/audio/transcriptions", &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "missing_model") {
+		t.Errorf("缺少模型: 状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+}
+
+// bedrockEvent 按AWS事件流格式编码一条消息
+func bedrockEvent(headers map[string]string, payload []byte) []byte {
+	var h []byte
+	for name, value := range headers {
+		h = append(h, byte(len(name)))
+		h = append(h, name...)
+		h = append(h, 7, byte(len(value)>>8), byte(len(value)))
+		h = append(h, value...)
+	}
+	total := 16 + len(h) + len(payload)
+	msg := binary.BigEndian.AppendUint32(nil, uint32(total))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(h)))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	msg = append(append(msg, h...), payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+// newBedrockUpstream 启动一个校验SigV4签名的模拟Bedrock服务
+func newBedrockUpstream(t *testing.T) (*httptest.Server, *upstreamRequest) {
+	t.Helper()
+	got := &upstreamRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.body, got.header = r.Method, r.URL.EscapedPath(), string(body), r.Header.Clone()
+		err := util.VerifyV4(r, body, func(id string) (string, bool) { return "bedrock-secret", id == "AKIDTEST" })
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"`+err.Error()+`"}`)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/invoke-with-response-stream") {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"msg_1","type":"message","content":[]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, event := range []string{`{"type":"message_start"}`, `{"type":"message_stop"}`} {
+			chunk := `{"bytes":"` + base64.StdEncoding.EncodeToString([]byte(event)) + `"}`
+			w.Write(bedrockEvent(map[string]string{":message-type": "event", ":event-type": "chunk"}, []byte(chunk)))
+		}
+		w.Write(bedrockEvent(map[string]string{":message-type": "exception", ":exception-type": "throttlingException"}, []byte(`{"message":"slow down"}`)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestForwardRequestBedrock(t *testing.T) {
+	upstream, got := newBedrockUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:          "bedrock",
+		BaseURL:       upstream.URL,
+		Provider:      "bedrock",
+		AllowInternal: true,
+		Secret:        "bedrock-secret",
+		ProviderOptions: model.ProviderOptions{Bedrock: &model.BedrockOptions{
+			Region:      "us-east-1",
+			AccessKeyID: "AKIDTEST",
+			Models:      map[string]string{"claude-3-haiku": "anthropic.claude-3-haiku-20240307-v1:0"},
+		}},
+	})
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/bedrock/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "client-key")
+		req.Header.Set("Anthropic-Beta", "tools-2024-04-04")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"model":"claude-3-haiku","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "msg_1") {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.path != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke" {
+		t.Errorf("上游收到的路径 = %s", got.path)
+	}
+	if got.header.Get("X-Api-Key") != "" {
+		t.Errorf("客户端的认证头不应转发: %v", got.header)
+	}
+	if !strings.Contains(got.body, `"anthropic_version":"bedrock-2023-05-31"`) || !strings.Contains(got.body, `"anthropic_beta":["tools-2024-04-04"]`) || strings.Contains(got.body, `"model"`) {
+		t.Errorf("上游收到的请求体 = %s", got.body)
+	}
+
+	// 流式响应的事件流转为SSE，异常转为error事件
+	w = send(`{"model":"anthropic.claude-v2","stream":true,"max_tokens":16,"messages":[]}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	want := "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n" +
+		"event: error\ndata: {\"error\":{\"message\":\"slow down\",\"type\":\"rate_limit_error\"},\"type\":\"error\"}\n\n"
+	if w.Body.String() != want {
+		t.Errorf("流式响应 = %q", w.Body.String())
+	}
+	if got.path != "/model/anthropic.claude-v2/invoke-with-response-stream" || strings.Contains(got.body, `"stream"`) {
+		t.Errorf("上游收到的请求 = %s %s", got.path, got.body)
+	}
+}
+
+// newVertexTokenServer 启动一个模拟的令牌地址，校验JWT断言的签名后返回访问令牌，
+// /short返回的令牌很快过期，用于验证提前刷新，/disabled返回服务账号已停用的错误
+func newVertexTokenServer(t *testing.T, key *rsa.PrivateKey) (*httptest.Server, *int32) {
+	t.Helper()
+	var count int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, "grant_type无效", http.StatusBadRequest)
+			return
+		}
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(parts) != 3 {
+			http.Error(w, "断言格式错误", http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			http.Error(w, "签名无效", http.StatusUnauthorized)
+			return
+		}
+		var claims struct {
+			Iss string `json:"iss"`
+			Aud string `json:"aud"`
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(payload, &claims)
+		if claims.Iss != "proxy@test-project.iam.gserviceaccount.com" || claims.Aud != srv.URL+r.URL.Path {
+			http.Error(w, "断言内容无效", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/disabled" {
+			http.Error(w, `{"error":"invalid_grant","error_description":"Account proxy@test-project.iam.gserviceaccount.com is disabled"}`, http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&count, 1)
+		expiresIn := 3600
+		if r.URL.Path == "/short" {
+			expiresIn = 60
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "ya29.token-" + string(rune('0'+n)),
+			"expires_in":   expiresIn,
+			"token_type":   "Bearer",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count
+}
+
+func TestForwardRequestVertex(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	account, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "proxy@test-project.iam.gserviceaccount.com",
+	})
+	tokenServer, tokenCount := newVertexTokenServer(t, key)
+	upstream, got := newUpstream(t)
+	vertexAPI := func(name, tokenPath string) model.APIConfig {
+		return model.APIConfig{
+			Name:            name,
+			BaseURL:         upstream.URL,
+			Provider:        "vertex",
+			AllowInternal:   true,
+			Secret:          string(account),
+			ProviderOptions: model.ProviderOptions{Vertex: &model.VertexOptions{Location: "us-central1", TokenURL: tokenServer.URL + tokenPath}},
+		}
+	}
+	r, _ := newTestRouter(t, vertexAPI("vertex", "/token"), vertexAPI("vertex-short", "/short"), vertexAPI("vertex-disabled", "/disabled"))
+	send := func(apiName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+apiName+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse&key=client-key", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Goog-Api-Key", "client-key")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 令牌有效期内复用缓存的令牌，客户端的API Key不转发给上游
+	for i := 0; i < 2; i++ {
+		if w := send("vertex"); w.Code != http.StatusCreated {
+			t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+	if got.path != "/v1beta1/projects/test-project/locations/us-central1/publishers/google/models/gemini-pro:streamGenerateContent" {
+		t.Errorf("上游收到的路径 = %s", got.path)
+	}
+	if got.query != "alt=sse" || got.header.Get("X-Goog-Api-Key") != "" {
+		t.Errorf("上游收到的查询参数 = %s, 请求头 = %v", got.query, got.header)
+	}
+	if got.header.Get("Authorization") != "Bearer ya29.token-1" || atomic.LoadInt32(tokenCount) != 1 {
+		t.Errorf("Authorization = %s, 换取令牌次数 = %d", got.header.Get("Authorization"), atomic.LoadInt32(tokenCount))
+	}
+
+	// 快过期的令牌在下一次请求前刷新
+	send("vertex-short")
+	send("vertex-short")
+	if got.header.Get("Authorization") != "Bearer ya29.token-3" || atomic.LoadInt32(tokenCount) != 3 {
+		t.Errorf("Authorization = %s, 换取令牌次数 = %d", got.header.Get("Authorization"), atomic.LoadInt32(tokenCount))
+	}
+
+	// 令牌地址的错误详情不返回给客户端
+	w := send("vertex-disabled")
+	if w.Code != http.StatusBadGateway || strings.Contains(w.Body.String(), "invalid_grant") || strings.Contains(w.Body.String(), "iam.gserviceaccount.com") {
+		t.Errorf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+}
+
+// newOllamaUpstream 启动一个模拟的Ollama服务，/api/chat按请求的stream返回单个JSON或NDJSON
+func newOllamaUpstream(t *testing.T) (*httptest.Server, *upstreamRequest) {
+	t.Helper()
+	got := &upstreamRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.body, got.header = r.Method, r.URL.Path, string(body), r.Header.Clone()
+		switch r.URL.Path {
+		case "/api/tags":
+			io.WriteString(w, `{"models":[{"name":"llama3:latest","modified_at":"2024-05-01T00:00:00Z"}]}`)
+		case "/api/chat":
+			if strings.Contains(string(body), `"stream":true`) {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				io.WriteString(w, `{"model":"llama3","created_at":"2024-05-01T00:00:00Z","message":{"role":"assistant","content":"Hel"},"done":false}`+"\n")
+				io.WriteString(w, `{"model":"llama3","created_at":"2024-05-01T00:00:00Z","message":{"role":"assistant","content":"lo"},"done":false}`+"\n")
+				io.WriteString(w, `{"model":"llama3","created_at":"2024-05-01T00:00:00Z","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}`+"\n")
+				return
+			}
+			io.WriteString(w, `{"model":"llama3","created_at":"2024-05-01T00:00:00Z","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}`)
+		case "/api/unknown":
+			http.Error(w, `{"error":"model \"missing\" not found"}`, http.StatusNotFound)
+		default:
+			io.WriteString(w, `{"object":"list","data":[]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestForwardRequestOllama(t *testing.T) {
+	upstream, got := newOllamaUpstream(t)
+	r, _ := newTestRouter(t, model.APIConfig{
+		Name:            "ollama",
+		BaseURL:         upstream.URL,
+		Provider:        "local",
+		AllowInternal:   true,
+		ProviderOptions: model.ProviderOptions{Local: &model.LocalOptions{API: "ollama"}},
+	})
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/ollama"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 非流式对话：参数移到options，图片转为images，工具调用转为OpenAI格式
+	w := send(http.MethodPost, "/v1/chat/completions", `{"model":"llama3","max_tokens":16,"temperature":0.5,"stop":"END",
+		"messages":[{"role":"user","content":[{"type":"text","text":"天气"},{"type":"image_url","image_url":{"url":"data:image/png;base64,aGk="}}]}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got.path != "/api/chat" {
+		t.Errorf("上游收到的路径 = %s", got.path)
+	}
+	for _, want := range []string{`"stream":false`, `"num_predict":16`, `"temperature":0.5`, `"stop":["END"]`, `"images":["aGk="]`, `"content":"天气"`} {
+		if !strings.Contains(got.body, want) {
+			t.Errorf("上游收到的请求体缺少%s: %s", want, got.body)
+		}
+	}
+	for _, want := range []string{`"object":"chat.completion"`, `"finish_reason":"tool_calls"`, `"arguments":"{\"city\":\"Paris\"}"`, `"total_tokens":7`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("响应缺少%s: %s", want, w.Body.String())
+		}
+	}
+
+	// 流式对话：NDJSON转为SSE，最后返回用量和[DONE]
+	w = send(http.MethodPost, "/v1/chat/completions", `{"model":"llama3","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 5 || events[4] != "data: [DONE]" {
+		t.Fatalf("流式响应 = %q", w.Body.String())
+	}
+	if !strings.Contains(events[0], `"delta":{"content":"Hel","role":"assistant"}`) || !strings.Contains(events[2], `"finish_reason":"stop"`) || !strings.Contains(events[3], `"total_tokens":7`) {
+		t.Errorf("流式响应 = %q", w.Body.String())
+	}
+
+	// 模型列表转换为OpenAI格式，其余请求原样转发到Ollama的OpenAI兼容接口
+	w = send(http.MethodGet, "/v1/models", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":"llama3:latest"`) || got.path != "/api/tags" {
+		t.Errorf("模型列表 = %d %s, 上游路径 = %s", w.Code, w.Body.String(), got.path)
+	}
+	if w = send(http.MethodPost, "/v1/embeddings", `{"model":"llama3","input":"hi"}`); w.Code != http.StatusOK || got.path != "/v1/embeddings" {
+		t.Errorf("其余请求 = %d, 上游路径 = %s", w.Code, got.path)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	prev := config.Get()
+	t.Cleanup(func() { config.Set(prev) })
+
+	ollama, _ := newOllamaUpstream(t)
+	var fetched int32
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "" {
+			http.Error(w, "unexpected", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"object":"list","data":[{"id":"qwen2-7b","object":"model","created":1,"owned_by":"vllm"}]}`)
+	}))
+	t.Cleanup(openai.Close)
+	r, store := newTestRouter(t,
+		model.APIConfig{Name: "ollama", BaseURL: ollama.URL, Provider: "local", AllowInternal: true,
+			ProviderOptions: model.ProviderOptions{Local: &model.LocalOptions{API: "ollama"}}},
+		model.APIConfig{Name: "vllm", BaseURL: openai.URL, Provider: "local", AllowInternal: true},
+		// 未豁免出站策略的内网地址和已禁用的API不计入
+		model.APIConfig{Name: "blocked", BaseURL: openai.URL, Provider: "local"},
+		model.APIConfig{Name: "inactive", BaseURL: openai.URL, Provider: "local", AllowInternal: true},
+	)
+	if _, err := store.APIConfigs.UpdateFields("inactive", map[string]interface{}{"active": false}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer sk-client")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 默认关闭，不请求任何本地服务
+	config.Set(&config.Config{})
+	if w := send(); w.Code != http.StatusNotFound || atomic.LoadInt32(&fetched) != 0 {
+		t.Fatalf("未开启时状态码 = %d, 请求本地服务次数 = %d", w.Code, atomic.LoadInt32(&fetched))
+	}
+
+	config.Set(&config.Config{Proxy: config.ProxyConfig{ModelList: true}})
+	w := send()
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body: %s", w.Code, w.Body.String())
+	}
+	var list service.ModelList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 2 || list.Data[0].ID != "llama3:latest" || list.Data[0].API != "ollama" || list.Data[1].ID != "qwen2-7b" || list.Data[1].API != "vllm" {
+		t.Errorf("模型列表 = %+v", list.Data)
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prepareVertex 使用服务账号换取Vertex访问令牌并设置到改写器，失败时写出错误响应并返回false
+func (ctl *ProxyController) prepareVertex(c *gin.Context, apiConfig *model.APIConfig, rewriter *service.Rewriter) bool {
+	apiName := apiConfig.Name
+	opts := apiConfig.ProviderOptions.Vertex
+	if opts == nil {
+		util.ErrorResponse(c, http.StatusBadGateway, "API配置缺少provider_options.vertex")
+		return false
+	}
+	account, err := service.VertexServiceAccount(apiConfig)
+	if err != nil {
+		util.Logger.Errorf("API %s 的服务账号JSON密钥无效: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "API的服务账号JSON密钥无效")
+		return false
+	}
+
+	// 令牌地址与上游使用相同的出站策略
+	token, err := service.VertexAccessToken(c.Request.Context(), ctl.upstreamClient(apiConfig), opts, account)
+	if util.IsEgressDenied(err) {
+		util.Logger.Warnf("API %s 的令牌地址被出站策略拒绝: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "令牌地址被出站策略拒绝")
+		return false
+	}
+	if err != nil {
+		// 令牌地址的错误可能包含服务账号信息，只写入日志
+		util.Logger.Errorf("API %s 获取Vertex访问令牌失败: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "获取Vertex访问令牌失败")
+		return false
+	}
+	rewriter.SetVertex(opts, service.VertexProject(opts, account), token)
+	return true
+}
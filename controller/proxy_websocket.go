@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocket会话默认限制
+const (
+	defaultWebSocketIdleTimeout = 300 * time.Second
+	defaultWebSocketMaxDuration = time.Hour
+)
+
+// WebSocket关闭原因，记录在会话日志中
+const (
+	wsClosedByClient   = "client_closed"
+	wsClosedByUpstream = "upstream_closed"
+	wsIdleTimeout      = "idle_timeout"
+	wsMaxDuration      = "max_duration"
+)
+
+// isWebSocketUpgrade 判断是否为WebSocket升级请求
+func isWebSocketUpgrade(r *http.Request) bool {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocketLimits 读取当前WebSocket会话限制，未配置时使用默认值
+func webSocketLimits(settings config.ProxyConfig) (idle, max time.Duration) {
+	idle, max = defaultWebSocketIdleTimeout, defaultWebSocketMaxDuration
+	if n := settings.WebSocket.IdleTimeout; n > 0 {
+		idle = time.Duration(n) * time.Second
+	}
+	if n := settings.WebSocket.MaxDuration; n > 0 {
+		max = time.Duration(n) * time.Second
+	}
+	return idle, max
+}
+
+// forwardWebSocket 转发WebSocket升级请求：握手经过与普通请求相同的改写和出站策略，
+// Sec-WebSocket-*头（包括子协议）原样透传，握手成功后接管客户端连接双向转发帧
+func (ctl *ProxyController) forwardWebSocket(c *gin.Context, apiConfig *model.APIConfig, rewriter *service.Rewriter, targetURL string) {
+	apiName := apiConfig.Name
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, targetURL, nil)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusInternalServerError, "创建请求失败")
+		return
+	}
+	settings := proxySettings()
+	req.Header = upstreamRequestHeader(c, settings)
+	rewriter.RequestHeaders(req.Header)
+	// 逐跳头已被删除，升级请求需要重新声明
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	resp, err := ctl.upstreamClient(apiConfig).Do(req)
+	if util.IsEgressDenied(err) {
+		util.Logger.Warnf("API %s 的上游地址被出站策略拒绝: %v", apiName, err)
+		util.ErrorResponse(c, http.StatusBadGateway, "上游地址被出站策略拒绝")
+		return
+	}
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadGateway, "请求失败: "+err.Error())
+		return
+	}
+
+	// 上游拒绝升级时按普通响应返回，客户端可以看到上游的错误信息
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			util.ErrorResponse(c, http.StatusInternalServerError, "读取响应体失败")
+			return
+		}
+		copyResponseHeader(c.Writer.Header(), resp.Header, apiName, settings)
+		rewriter.ResponseHeaders(c.Writer.Header())
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+		return
+	}
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		util.ErrorResponse(c, http.StatusBadGateway, "上游连接不支持双向转发")
+		return
+	}
+
+	copyResponseHeader(c.Writer.Header(), resp.Header, apiName, settings)
+	rewriter.ResponseHeaders(c.Writer.Header())
+	c.Writer.Header().Set("Connection", "Upgrade")
+	c.Writer.Header().Set("Upgrade", "websocket")
+	// 只记录状态码供访问日志使用，响应头在接管连接后手动写出
+	c.Status(http.StatusSwitchingProtocols)
+	conn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		upstream.Close()
+		util.Logger.Errorf("API %s 接管WebSocket连接失败: %v", apiName, err)
+		return
+	}
+	// 接管后连接仍保留服务器设置的读写超时，改由会话限制控制
+	conn.SetDeadline(time.Time{})
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\n")
+	c.Writer.Header().Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	idle, max := webSocketLimits(settings)
+	session := newWSSession(conn, brw.Reader, upstream)
+	reason := session.run(idle, max)
+	stats := util.WebSocketSession{
+		APIName:          apiName,
+		Path:             c.Request.URL.Path,
+		ClientIP:         c.ClientIP(),
+		Duration:         time.Since(session.start).Milliseconds(),
+		ClientBytes:      session.fromClient.bytes.Load(),
+		ClientMessages:   session.fromClient.messages.Load(),
+		UpstreamBytes:    session.fromUpstream.bytes.Load(),
+		UpstreamMessages: session.fromUpstream.messages.Load(),
+		CloseReason:      reason,
+	}
+	util.LogWebSocketSession(stats)
+	ctl.logs.Record(&model.RequestLog{
+		APIName:          stats.APIName,
+		Method:           http.MethodGet,
+		Path:             stats.Path,
+		StatusCode:       http.StatusSwitchingProtocols,
+		ResponseTime:     stats.Duration,
+		ClientIP:         stats.ClientIP,
+		RequestBytes:     stats.ClientBytes,
+		ResponseBytes:    stats.UpstreamBytes,
+		RequestMessages:  stats.ClientMessages,
+		ResponseMessages: stats.UpstreamMessages,
+		CloseReason:      stats.CloseReason,
+	})
+}
+
+// wsCounter 单个方向的转发统计
+type wsCounter struct {
+	bytes    atomic.Int64
+	messages atomic.Int64
+}
+
+// wsSession 一个WebSocket会话，按帧转发以便统计消息数和在超限时发送关闭帧
+type wsSession struct {
+	client       net.Conn
+	clientReader *bufio.Reader // 接管连接时已缓冲的数据需要先读出
+	upstream     io.ReadWriteCloser
+
+	start      time.Time
+	lastActive atomic.Int64 // 最近一次收到帧的时间（UnixNano）
+	clientMu   sync.Mutex   // 保证写给客户端的帧完整，不与关闭帧交错
+	upstreamMu sync.Mutex
+
+	fromClient   wsCounter
+	fromUpstream wsCounter
+
+	once   sync.Once
+	reason string
+}
+
+func newWSSession(client net.Conn, clientReader *bufio.Reader, upstream io.ReadWriteCloser) *wsSession {
+	s := &wsSession{client: client, clientReader: clientReader, upstream: upstream, start: time.Now()}
+	s.lastActive.Store(s.start.UnixNano())
+	return s
+}
+
+// run 双向转发直到任意一方断开或超出限制，返回关闭原因
+func (s *wsSession) run(idle, max time.Duration) string {
+	done := make(chan struct{}, 2)
+	go func() {
+		s.pump(s.upstream, &s.upstreamMu, s.clientReader, &s.fromClient)
+		s.shutdown(wsClosedByClient, 0, "")
+		done <- struct{}{}
+	}()
+	go func() {
+		s.pump(s.client, &s.clientMu, s.upstream, &s.fromUpstream)
+		s.shutdown(wsClosedByUpstream, 0, "")
+		done <- struct{}{}
+	}()
+
+	ticker := time.NewTicker(watchInterval(idle))
+	defer ticker.Stop()
+	deadline := time.NewTimer(max)
+	defer deadline.Stop()
+	for finished := 0; finished < 2; {
+		select {
+		case <-done:
+			finished++
+		case <-deadline.C:
+			s.shutdown(wsMaxDuration, 1008, "max session duration exceeded")
+		case <-ticker.C:
+			if time.Since(time.Unix(0, s.lastActive.Load())) >= idle {
+				s.shutdown(wsIdleTimeout, 1001, "idle timeout")
+			}
+		}
+	}
+	return s.reason
+}
+
+// watchInterval 空闲检查的间隔，保证超时后一秒左右断开
+func watchInterval(idle time.Duration) time.Duration {
+	if idle < 4*time.Second {
+		return idle / 4
+	}
+	return time.Second
+}
+
+// shutdown 结束会话，只有第一次调用生效。code非0时先向双方发送关闭帧
+func (s *wsSession) shutdown(reason string, code uint16, text string) {
+	s.once.Do(func() {
+		s.reason = reason
+		if code != 0 {
+			sent := make(chan struct{})
+			go func() {
+				defer close(sent)
+				// 等正在转发的帧写完再发送关闭帧，写不完时由下面的超时兜底
+				s.client.SetWriteDeadline(time.Now().Add(time.Second))
+				s.clientMu.Lock()
+				writeCloseFrame(s.client, false, code, text)
+				s.clientMu.Unlock()
+				s.upstreamMu.Lock()
+				writeCloseFrame(s.upstream, true, code, text)
+				s.upstreamMu.Unlock()
+			}()
+			select {
+			case <-sent:
+			case <-time.After(time.Second):
+			}
+		}
+		s.client.Close()
+		s.upstream.Close()
+	})
+}
+
+// pump 从src逐帧读取并原样写入dst，帧内容不解码，只解析帧头用于统计
+func (s *wsSession) pump(dst io.Writer, mu *sync.Mutex, src io.Reader, counter *wsCounter) error {
+	header := make([]byte, 14)
+	for {
+		if _, err := io.ReadFull(src, header[:2]); err != nil {
+			return err
+		}
+		n := 2
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			if _, err := io.ReadFull(src, header[2:4]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(header[2:4]))
+			n = 4
+		case 127:
+			if _, err := io.ReadFull(src, header[2:10]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(header[2:10])
+			n = 10
+		}
+		if header[1]&0x80 != 0 {
+			if _, err := io.ReadFull(src, header[n:n+4]); err != nil {
+				return err
+			}
+			n += 4
+		}
+		if length > 1<<62 {
+			return errors.New("WebSocket帧长度无效")
+		}
+
+		s.lastActive.Store(time.Now().UnixNano())
+		mu.Lock()
+		_, err := dst.Write(header[:n])
+		if err == nil {
+			_, err = io.CopyN(dst, src, int64(length))
+		}
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		counter.bytes.Add(int64(n) + int64(length))
+		// FIN置位的数据帧或延续帧表示一条消息结束，控制帧（opcode>=8）不计入消息数
+		if fin, opcode := header[0]&0x80 != 0, header[0]&0x0f; fin && opcode < 8 {
+			counter.messages.Add(1)
+		}
+	}
+}
+
+// writeCloseFrame 写出一个关闭帧，发往上游的帧按协议要求加掩码
+func writeCloseFrame(w io.Writer, masked bool, code uint16, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, code)
+	payload = append(payload, text...)
+
+	frame := []byte{0x88, byte(len(payload))}
+	if masked {
+		key := make([]byte, 4)
+		rand.Read(key)
+		frame[1] |= 0x80
+		frame = append(frame, key...)
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	_, err := w.Write(append(frame, payload...))
+	return err
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// wsFrame 测试中读到的一个帧
+type wsFrame struct {
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+// readWSFrame 读取一个短帧并去掉掩码
+func readWSFrame(r io.Reader) (wsFrame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return wsFrame{}, err
+	}
+	frame := wsFrame{opcode: header[0] & 0x0f, masked: header[1]&0x80 != 0}
+	var key []byte
+	if frame.masked {
+		key = make([]byte, 4)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return wsFrame{}, err
+		}
+	}
+	frame.payload = make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return wsFrame{}, err
+	}
+	for i := range frame.payload {
+		if key != nil {
+			frame.payload[i] ^= key[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// closeCode 关闭帧中的状态码
+func (f wsFrame) closeCode() int {
+	if f.opcode != 0x8 || len(f.payload) < 2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(f.payload))
+}
+
+// newTestWSSession 用内存连接创建会话，返回客户端和上游的对端
+func newTestWSSession(t *testing.T) (*wsSession, net.Conn, net.Conn) {
+	t.Helper()
+	client, clientPeer := net.Pipe()
+	upstream, upstreamPeer := net.Pipe()
+	t.Cleanup(func() {
+		clientPeer.Close()
+		upstreamPeer.Close()
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	clientPeer.SetDeadline(deadline)
+	upstreamPeer.SetDeadline(deadline)
+	return newWSSession(client, bufio.NewReader(client), upstream), clientPeer, upstreamPeer
+}
+
+func TestWSSessionLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		idle       time.Duration
+		max        time.Duration
+		keepalive  bool // 是否持续发送消息保持活跃
+		wantReason string
+		wantCode   int
+	}{
+		{"空闲超时", 200 * time.Millisecond, 10 * time.Second, false, wsIdleTimeout, 1001},
+		{"超过最长会话时间", 10 * time.Second, 300 * time.Millisecond, true, wsMaxDuration, 1008},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, clientPeer, upstreamPeer := newTestWSSession(t)
+			result := make(chan string, 1)
+			go func() { result <- session.run(tt.idle, tt.max) }()
+
+			// 上游发来的数据帧转发给客户端，客户端收到关闭帧前一直读取
+			clientClose := make(chan wsFrame, 1)
+			go func() {
+				for {
+					frame, err := readWSFrame(clientPeer)
+					if err != nil {
+						close(clientClose)
+						return
+					}
+					if frame.opcode == 0x8 {
+						clientClose <- frame
+						return
+					}
+				}
+			}()
+			stop := make(chan struct{})
+			defer close(stop)
+			if tt.keepalive {
+				go func() {
+					ticker := time.NewTicker(50 * time.Millisecond)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-ticker.C:
+							if _, err := upstreamPeer.Write([]byte{0x81, 2, 'h', 'i'}); err != nil {
+								return
+							}
+						case <-stop:
+							return
+						}
+					}
+				}()
+			}
+
+			// 发往上游的关闭帧按协议加掩码
+			var upstreamClose wsFrame
+			for {
+				frame, err := readWSFrame(upstreamPeer)
+				if err != nil {
+					t.Fatalf("读取上游关闭帧失败: %v", err)
+				}
+				if frame.opcode == 0x8 {
+					upstreamClose = frame
+					break
+				}
+			}
+			if !upstreamClose.masked || upstreamClose.closeCode() != tt.wantCode {
+				t.Errorf("发往上游的关闭帧: masked = %v, code = %d", upstreamClose.masked, upstreamClose.closeCode())
+			}
+			frame, ok := <-clientClose
+			if !ok || frame.masked || frame.closeCode() != tt.wantCode {
+				t.Errorf("发往客户端的关闭帧: %+v, ok = %v", frame, ok)
+			}
+
+			select {
+			case reason := <-result:
+				if reason != tt.wantReason {
+					t.Errorf("reason = %s, want %s", reason, tt.wantReason)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("会话没有结束")
+			}
+			if tt.keepalive && session.fromUpstream.messages.Load() == 0 {
+				t.Error("未统计上游消息数")
+			}
+		})
+	}
+}
+
+func TestWSSessionPeerClosed(t *testing.T) {
+	session, clientPeer, upstreamPeer := newTestWSSession(t)
+	result := make(chan string, 1)
+	go func() { result <- session.run(10*time.Second, 10*time.Second) }()
+
+	// 客户端发送一条分两帧的消息和一个ping后断开
+	go io.Copy(io.Discard, upstreamPeer)
+	mask := []byte{0, 0, 0, 0}
+	for _, frame := range [][]byte{
+		append([]byte{0x01, 0x80 | 1}, append(mask, 'a')...),
+		append([]byte{0x80, 0x80 | 1}, append(mask, 'b')...),
+		append([]byte{0x89, 0x80}, mask...),
+	} {
+		if _, err := clientPeer.Write(frame); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	clientPeer.Close()
+
+	select {
+	case reason := <-result:
+		if reason != wsClosedByClient {
+			t.Errorf("reason = %s, want %s", reason, wsClosedByClient)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("会话没有结束")
+	}
+	// 延续帧组成一条消息，控制帧不计入消息数
+	if got := session.fromClient.messages.Load(); got != 1 {
+		t.Errorf("客户端消息数 = %d, want 1", got)
+	}
+	if got := session.fromClient.bytes.Load(); got != 7+7+6 {
+		t.Errorf("客户端字节数 = %d, want 20", got)
+	}
+}
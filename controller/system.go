@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"AI-PROXY/config"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemController 系统状态与运维接口
+type SystemController struct {
+	apiConfig *service.APIConfigService
+	cluster   *service.ClusterService
+	logs      *service.RequestLogService
+}
+
+// NewSystemController 创建系统接口
+func NewSystemController(apiConfig *service.APIConfigService, cluster *service.ClusterService, logs *service.RequestLogService) *SystemController {
+	return &SystemController{apiConfig: apiConfig, cluster: cluster, logs: logs}
+}
+
+// 健康检查，API配置缓存过期时返回degraded
+func (ctl *SystemController) Health(c *gin.Context) {
+	cache := ctl.apiConfig.CacheStatus()
+	status := "ok"
+	if cache.Stale {
+		status = "degraded"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": status,
+		"cache":  cache,
+	})
+}
+
+// 重新加载配置文件
+func (ctl *SystemController) ReloadConfig(c *gin.Context) {
+	result, err := config.Reload()
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, "配置重载失败: "+err.Error())
+		return
+	}
+	util.Logger.Infof("配置已重载，生效项: %v，需重启项: %v，需手动同步项: %v", result.Applied, result.RestartRequired, result.Manual)
+	util.SuccessResponse(c, result)
+}
+
+// 查看各实例当前运行的配置版本
+func (ctl *SystemController) GetInstances(c *gin.Context) {
+	status, err := ctl.cluster.Status()
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, status)
+}
+
+// 查询最近的请求日志，支持api和limit参数
+func (ctl *SystemController) GetRequestLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	logs, err := ctl.logs.Recent(c.Query("api"), limit)
+	if err != nil {
+		util.InternalServerErrorResponse(c, err.Error())
+		return
+	}
+	util.SuccessResponse(c, logs)
+}
@@ -8,55 +8,99 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
 	"AI-PROXY/config"
 	"AI-PROXY/repository"
 	"AI-PROXY/router"
+	"AI-PROXY/service"
 	"AI-PROXY/util"
-
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
-var GlobalConfig *config.Config
-
 func main() {
 	//1、解析命令行参数
 	configPath := flag.String("config", "config.json", "配置文件路径")
+	watchConfig := flag.Bool("watch", false, "监听配置文件变化并自动重载")
 	flag.Parse()
 
 	//2、加载配置
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.Init(*configPath)
 	if err != nil {
 		log.Fatalf("加载配置失败：%v", err)
 	}
-	config.GlobalConfig = cfg
 
 	//3、初始化日志
 	if err := util.InitLogger(&cfg.Log); err != nil {
 		log.Printf("日志文件打开失败，将只输出到控制台: %v", err)
 	}
+	config.OnReload(func(old, new *config.Config) {
+		util.SetLogLevel(&new.Log)
+	})
 
 	//4、连接数据库
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.Database.Username,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.Database,
-	)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := repository.OpenDB(&cfg.Database)
 	if err != nil {
 		util.Logger.Fatalf("连接数据库失败：%v", err)
 	}
 
-	//5、初始化repository层
-	repository.InitDB(db)
+	//5、初始化repository和service层
+	store, err := repository.NewGormStore(db)
+	if err != nil {
+		util.Logger.Fatalf("初始化数据表失败：%v", err)
+	}
+	services := service.New(store)
+
+	// sync子命令：同步配置文件中的apis后退出
+	if flag.Arg(0) == "sync" {
+		os.Exit(runSync(services, cfg, flag.Args()[1:]))
+	}
+	if cfg.APISync.OnStartup && len(cfg.APIs) > 0 {
+		if err := syncAPIs(services, cfg); err != nil {
+			util.Logger.Fatalf("同步API配置失败：%v", err)
+		}
+	}
+	config.OnReload(func(old, new *config.Config) {
+		syncOnReload(services, old, new)
+	})
+
+	// 预热API配置缓存并定时刷新，先记录配置版本，避免遗漏预热期间的变更
+	if err := services.Cluster.Init(); err != nil {
+		util.Logger.Warnf("读取配置版本失败：%v", err)
+	}
+	if err := services.APIConfig.RefreshCache(); err != nil {
+		util.Logger.Warnf("加载API配置缓存失败：%v", err)
+	}
+	refreshInterval := time.Duration(cfg.Cache.RefreshInterval) * time.Second
+	if refreshInterval <= 0 {
+		refreshInterval = 30 * time.Second
+	}
+	stopRefresh := make(chan struct{})
+	go services.APIConfig.StartCacheRefresh(refreshInterval, stopRefresh, func(err error) {
+		util.Logger.Warnf("刷新API配置缓存失败，继续使用旧配置：%v", err)
+	})
+
+	// 轮询配置变更日志，使多实例间的配置修改在数秒内生效
+	pollInterval := time.Duration(cfg.Cluster.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = 2 * time.Second
+	}
+	go services.Cluster.Start(pollInterval, stopRefresh, func(err error) {
+		util.Logger.Warnf("同步配置变更失败：%v", err)
+	})
+	util.Logger.Infof("实例ID: %s", services.Cluster.InstanceID())
 
 	//6.初始化路由
-	r := router.SetupRouter()
+	r := router.SetupRouter(services)
+	// 路由注册后保留名称才完整，提示运维修改与之冲突的旧API名称
+	conflicts, err := services.APIConfig.ReservedNameConflicts()
+	if err != nil {
+		util.Logger.Warnf("检查API名称失败：%v", err)
+	}
+	for _, name := range conflicts {
+		util.Logger.Warnf("API名称 %s 与系统路由冲突，代理请求无法到达该API，且无法按原名更新或回滚，请通过 PUT /admin/api-config/%s 改名", name, name)
+	}
 
 	//7、启动HTTP服务
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -74,10 +118,25 @@ func main() {
 		}
 	}()
 
-	// 8. 等待中断信号，优雅关闭
+	// 8. 配置热重载：SIGHUP信号或文件变化
+	stopWatch := make(chan struct{})
+	if *watchConfig {
+		go config.Watch(2*time.Second, stopWatch, logReload)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logReload(config.Reload())
+		}
+	}()
+
+	// 9. 等待中断信号，优雅关闭
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	close(stopWatch)
+	close(stopRefresh)
 	util.Logger.Info("正在关闭服务器...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -86,4 +145,83 @@ func main() {
 		util.Logger.Fatalf("服务器关闭失败: %v", err)
 	}
 	util.Logger.Info("服务器已关闭")
+	util.CloseLogger()
+}
+
+// syncAPIs 按api_sync.mode把配置文件中的apis同步到数据库，并记录有变化的API
+func syncAPIs(services *service.Services, cfg *config.Config) error {
+	result, err := services.APIConfig.SyncAPIConfigs(service.SystemActor("config-sync"), cfg.APIs, cfg.APISync.Mode, false)
+	if err != nil {
+		return err
+	}
+	for _, change := range result.Changes {
+		if change.Action != service.SyncActionUnchanged {
+			util.Logger.Infof("同步API配置 %s: %s %v", change.Name, change.Action, change.Changes)
+		}
+		for _, warning := range change.Warnings {
+			util.Logger.Warnf("同步API配置 %s: %s", change.Name, warning)
+		}
+	}
+	return nil
+}
+
+// syncOnReload 开启自动同步时，重载后apis或同步模式有变化则重新同步；
+// 与启动时一样，apis为空时不同步，避免mirror模式删除所有API
+func syncOnReload(services *service.Services, old, new *config.Config) {
+	if !new.APISync.OnStartup || len(new.APIs) == 0 {
+		return
+	}
+	if reflect.DeepEqual(old.APIs, new.APIs) && old.APISync == new.APISync {
+		return
+	}
+	if err := syncAPIs(services, new); err != nil {
+		util.Logger.Errorf("重载后同步API配置失败：%v", err)
+	}
+}
+
+// logReload 记录配置重载结果
+func logReload(result *config.ReloadResult, err error) {
+	if err != nil {
+		util.Logger.Errorf("配置重载失败，继续使用原配置: %v", err)
+		return
+	}
+	util.Logger.Infof("配置已重载，生效项: %v", result.Applied)
+	if len(result.RestartRequired) > 0 {
+		util.Logger.Warnf("以下配置修改需要重启才能生效: %v", result.RestartRequired)
+	}
+	if len(result.Manual) > 0 {
+		util.Logger.Warnf("以下配置修改需要执行sync子命令才能生效: %v", result.Manual)
+	}
+}
+
+// runSync 执行sync子命令，返回进程退出码
+func runSync(services *service.Services, cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	mode := fs.String("mode", cfg.APISync.Mode, "同步模式: create/upsert/mirror")
+	dryRun := fs.Bool("dry-run", false, "只打印将要发生的变更，不写入数据库")
+	fs.Parse(args)
+
+	result, err := services.APIConfig.SyncAPIConfigs(service.SystemActor("config-sync"), cfg.APIs, *mode, *dryRun)
+	if result != nil {
+		for _, change := range result.Changes {
+			fmt.Printf("%-10s %s\n", change.Action, change.Name)
+			for _, c := range change.Changes {
+				fmt.Printf("           %s\n", c)
+			}
+			for _, w := range change.Warnings {
+				fmt.Printf("           警告: %s\n", w)
+			}
+			if change.Error != "" {
+				fmt.Printf("           错误: %s\n", change.Error)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "同步失败: %v\n", err)
+		return 1
+	}
+	if *dryRun {
+		fmt.Println("dry-run模式，未写入数据库")
+	}
+	return 0
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+)
+
+func TestSyncOnReloadEmptyAPIs(t *testing.T) {
+	util.InitLogger(&config.LogConfig{Level: "error"})
+	store := repository.NewMemoryStore()
+	services := service.New(store)
+	if err := store.APIConfigs.Create(&model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sync := config.APISyncConfig{OnStartup: true, Mode: service.SyncModeMirror}
+	old := &config.Config{APISync: sync, APIs: map[string]config.APIConfig{"openai": {BaseURL: "https://api.openai.com"}}}
+	// 重载后apis被清空或整个删除
+	for _, apis := range []map[string]config.APIConfig{{}, nil} {
+		syncOnReload(services, old, &config.Config{APISync: sync, APIs: apis})
+	}
+	if _, err := store.APIConfigs.FindByName("openai"); err != nil {
+		t.Errorf("apis为空时重载不应删除已有的API: %v", err)
+	}
+}
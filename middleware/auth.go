@@ -1,30 +1,62 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
-	"AI-PROXY/config"
+	"AI-PROXY/service"
 )
 
-// 管理员认证中间件
-func AdminAuth() gin.HandlerFunc {
+// gin上下文中保存管理员身份的键
+const principalKey = "admin_principal"
+
+// 管理员认证中间件，支持静态令牌和登录会话令牌
+func AdminAuth(auth *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer") {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供有效的token"})
 			c.Abort()
 			return
 		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if config.GlobalConfig == nil || token != config.GlobalConfig.Auth.Token {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token无效"})
+		token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		principal, err := auth.Authenticate(token)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenExpired) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "认证失败: " + err.Error()})
+			}
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// 角色校验中间件，需放在AdminAuth之后
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if principal == nil || !service.RoleAllows(principal.Role, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，需要" + role + "角色"})
 			c.Abort()
 			return
 		}
 		c.Next()
+	}
+}
 
+// 获取当前请求的管理员身份，未认证时返回nil
+func CurrentPrincipal(c *gin.Context) *service.Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if p, ok := v.(*service.Principal); ok {
+			return p
+		}
 	}
+	return nil
 }
@@ -1,14 +1,35 @@
 package middleware
 
 import (
+	"strings"
+
+	"AI-PROXY/config"
+
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultAllowMethods = "GET,POST,PUT,PATCH,DELETE,OPTIONS"
+	defaultAllowHeaders = "Content-Type,Authorization,If-Match,X-Bundle-Passphrase"
+)
+
+// 跨域中间件，每次请求读取当前配置，支持热重载
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		var cors config.CORSConfig
+		if cfg := config.Get(); cfg != nil {
+			cors = cfg.CORS
+		}
+
+		origin := allowOrigin(cors.AllowOrigins, c.GetHeader("Origin"))
+		if origin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				c.Writer.Header().Add("Vary", "Origin")
+			}
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Methods", joinOrDefault(cors.AllowMethods, defaultAllowMethods))
+		c.Writer.Header().Set("Access-Control-Allow-Headers", joinOrDefault(cors.AllowHeaders, defaultAllowHeaders))
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -16,3 +37,26 @@ func CORS() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// allowOrigin 返回应写入响应的Allow-Origin值，未配置时允许所有来源
+func allowOrigin(allowed []string, origin string) string {
+	if len(allowed) == 0 {
+		return "*"
+	}
+	for _, o := range allowed {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func joinOrDefault(values []string, def string) string {
+	if len(values) == 0 {
+		return def
+	}
+	return strings.Join(values, ",")
+}
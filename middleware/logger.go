@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"fmt"
 	"time"
 
 	"AI-PROXY/util"
@@ -14,22 +13,18 @@ func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
-		// 添加明显的调试输出
-		fmt.Printf("=== 收到请求 ===\n")
-		fmt.Printf("路径: %s\n", c.Request.URL.Path)
-		fmt.Printf("方法: %s\n", c.Request.Method)
-		fmt.Printf("用户代理: %s\n", c.Request.UserAgent())
-		fmt.Printf("================\n")
+		util.Logger.Debugf("收到请求: %s %s User-Agent=%s", c.Request.Method, c.Request.URL.Path, c.Request.UserAgent())
 
 		c.Next()
 		duration := time.Since(start).Milliseconds()
+		// 代理路由带有API名称参数，其他路由为空
 		util.LogRequest(
-			"",
-			c.Request.URL.Path,
+			c.Param("apiName"),
 			c.Request.Method,
+			c.Request.URL.Path,
 			c.Writer.Status(),
 			duration,
-			"",
+			c.Errors.ByType(gin.ErrorTypeAny).String(),
 		)
 	}
 }
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"AI-PROXY/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 空闲超过该时间的令牌桶会被清理
+const bucketIdleTTL = 10 * time.Minute
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter 按客户端IP限流，速率每次从当前配置读取，支持热重载
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// RateLimit 代理请求限流中间件
+func RateLimit() gin.HandlerFunc {
+	limiter := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+	return func(c *gin.Context) {
+		cfg := config.Get()
+		if cfg == nil || cfg.RateLimit.RequestsPerMinute <= 0 {
+			c.Next()
+			return
+		}
+		if !limiter.allow(c.ClientIP(), cfg.RateLimit, time.Now()) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (l *rateLimiter) allow(key string, limit config.RateLimitConfig, now time.Time) bool {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = float64(limit.RequestsPerMinute)
+	}
+	perSecond := float64(limit.RequestsPerMinute) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > bucketIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.lastSeen).Seconds() * perSecond
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.lastSeen = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
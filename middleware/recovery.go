@@ -1,10 +1,11 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
+	"AI-PROXY/util"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,9 +14,7 @@ func Recovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				fmt.Println("=== PANIC 捕获 ===")
-				fmt.Printf("panic: %+v\n", err)
-				fmt.Println(string(debug.Stack()))
+				util.Logger.Errorf("panic: %+v\n%s", err, debug.Stack())
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error":  "服务器内部错误",
 					"detail": err,
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// 访问规则动作
+const (
+	RuleActionAllow = "allow"
+	RuleActionDeny  = "deny"
+)
+
+// AccessRule 代理访问规则，按顺序匹配请求方法和路径，第一条命中的规则决定放行或拒绝
+type AccessRule struct {
+	Name    string   `json:"name"`              // 规则名称，拒绝时在响应中返回
+	Action  string   `json:"action"`            // allow/deny
+	Methods []string `json:"methods,omitempty"` // 请求方法，为空表示所有方法
+	Paths   []string `json:"paths,omitempty"`   // 路径模式，*匹配一段，**匹配任意多段，为空表示所有路径
+}
+
+// AccessRules 访问规则列表，以JSON文本存储
+type AccessRules []AccessRule
+
+// MarshalJSON 空列表输出[]，保证比较和输出一致
+func (r AccessRules) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]AccessRule(r))
+}
+
+// Value 实现driver.Valuer
+func (r AccessRules) Value() (driver.Value, error) {
+	data, err := r.MarshalJSON()
+	return string(data), err
+}
+
+// Scan 实现sql.Scanner
+func (r *AccessRules) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("无法解析访问规则: %T", value)
+	}
+	if len(data) == 0 {
+		*r = nil
+		return nil
+	}
+	var rules []AccessRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// 管理员角色
+const (
+	RoleViewer   = "viewer"   // 只读
+	RoleOperator = "operator" // 可修改API配置
+	RoleAdmin    = "admin"    // 可管理用户和系统配置
+)
+
+// 管理员账号
+type AdminUser struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Username     string     `json:"username" gorm:"uniqueIndex;size:50"`
+	PasswordHash string     `json:"-" gorm:"size:255"` // bcrypt哈希，不对外输出
+	Role         string     `json:"role" gorm:"size:20"`
+	Active       bool       `json:"active" gorm:"default:true"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (AdminUser) TableName() string {
+	return "admin_users"
+}
+
+// 管理员登录会话，登出或过期后令牌失效
+type AdminSession struct {
+	ID        string    `json:"id" gorm:"primaryKey;size:64"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ClientIP  string    `json:"client_ip" gorm:"size:64"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (AdminSession) TableName() string {
+	return "admin_sessions"
+}
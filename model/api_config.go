@@ -8,16 +8,25 @@ import (
 
 // api配置结构体
 type APIConfig struct {
-	ID             uint           `json:"id" gorm:"primaryKey"`                     //主键
-	Name           string         `json:"name" gorm:"uniqueIndex;size:50"`          //API名称，唯一不可重复
-	BaseURL        string         `json:"base_url" gorm:"column:base_url;size:255"` //APIurl
-	Description    string         `json:"description" gorm:"size:255"`
-	Active         bool           `json:"active" gorm:"default:true"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"`
-	LastTestStatus string         `json:"last_test_status" gorm:"column:last_test_status;size:10;default:'never'"` // 最近一次测试状态 success/fail/never
-	LastTestTime   *time.Time     `json:"last_test_time" gorm:"column:last_test_time"`                             // 最近一次测试时间
+	ID              uint            `json:"id" gorm:"primaryKey"`                     //主键
+	Name            string          `json:"name" gorm:"uniqueIndex;size:50"`          //API名称，唯一不可重复
+	BaseURL         string          `json:"base_url" gorm:"column:base_url;size:255"` //APIurl
+	Description     string          `json:"description" gorm:"size:255"`
+	Provider        string          `json:"provider" gorm:"size:20;index"` // 上游供应商类型，如openai、gemini，为空表示通用
+	Active          bool            `json:"active" gorm:"default:true"`
+	AllowInternal   bool            `json:"allow_internal" gorm:"default:false"` // 明确允许访问内网地址（如本地Ollama），不受出站策略的地址段限制，仍受主机和端口允许列表约束
+	AccessRules     AccessRules     `json:"access_rules" gorm:"type:text"`       // 按方法和路径放行或拒绝请求的规则
+	RequestPolicy   RequestPolicy   `json:"request_policy" gorm:"type:text"`     // 请求体中model和参数的限制
+	Rewrite         RewriteRules    `json:"rewrite" gorm:"type:text"`            // 转发时的请求头、查询参数、路径和响应头改写规则
+	ProviderOptions ProviderOptions `json:"provider_options" gorm:"type:text"`   // 供应商专属配置，如Azure的部署映射
+	Secret          string          `json:"secret" gorm:"type:text"`             // 供应商凭据，使用auth.encryption_key加密保存，如Bedrock的Secret Access Key
+	MaxBodySize     int             `json:"max_body_size" gorm:"default:0"`      // 请求体大小上限（MB），0表示使用proxy.max_body_size
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt  `json:"deleted_at" gorm:"index"`
+	LastTestStatus  string          `json:"last_test_status" gorm:"column:last_test_status;size:10;default:'never'"` // 最近一次测试状态 success/fail/never
+	LastTestTime    *time.Time      `json:"last_test_time" gorm:"column:last_test_time"`                             // 最近一次测试时间
+	Version         int             `json:"version" gorm:"not null;default:1"`                                       // 配置版本，每次修改加1，用于乐观并发控制
 }
 
 func (APIConfig) TableName() string {
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// API配置历史版本，每次修改后保存一份完整快照
+type APIConfigRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	APIName   string    `json:"api_name" gorm:"uniqueIndex:idx_api_revision;size:50"`
+	Version   int       `json:"version" gorm:"uniqueIndex:idx_api_revision"`
+	Action    string    `json:"action" gorm:"size:20"` // create/update/delete/restore/rollback等
+	Actor     string    `json:"actor" gorm:"size:50"`
+	Snapshot  JSONText  `json:"snapshot" gorm:"type:text"` // 该版本的完整配置，删除时为删除时的配置
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (APIConfigRevision) TableName() string {
+	return "api_config_revisions"
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 审计日志，记录每一次管理操作的操作者和前后变化
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Actor      string    `json:"actor" gorm:"index;size:50"` // 操作者用户名，静态令牌为token
+	ClientIP   string    `json:"client_ip" gorm:"size:64"`
+	Action     string    `json:"action" gorm:"index;size:20"` // create/update/delete/test/toggle
+	Entity     string    `json:"entity" gorm:"index;size:50"` // 操作对象类型，如api_config
+	EntityName string    `json:"entity_name" gorm:"index;size:100"`
+	Before     JSONText  `json:"before" gorm:"type:text"` // 修改前的JSON
+	After      JSONText  `json:"after" gorm:"type:text"`  // 修改后的JSON
+	Diff       JSONText  `json:"diff" gorm:"type:text"`   // 字段级差异JSON {"字段":{"before":..,"after":..}}
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// JSONText 以文本存储的JSON，输出接口时直接内嵌为JSON而不是字符串
+type JSONText string
+
+func (t JSONText) MarshalJSON() ([]byte, error) {
+	if t == "" || !json.Valid([]byte(t)) {
+		return []byte("null"), nil
+	}
+	return []byte(t), nil
+}
+
+func (t *JSONText) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = ""
+		return nil
+	}
+	*t = JSONText(data)
+	return nil
+}
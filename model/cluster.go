@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// 配置变更日志，每次修改配置追加一条，各实例轮询后失效本地缓存
+type ConfigChange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"` // 自增ID即配置版本号
+	Entity    string    `json:"entity" gorm:"size:50"`
+	Name      string    `json:"name" gorm:"size:50"`
+	Action    string    `json:"action" gorm:"size:20"`
+	Instance  string    `json:"instance" gorm:"size:100"` // 发起变更的实例
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ConfigChange) TableName() string {
+	return "config_changes"
+}
+
+// 代理实例心跳，记录每个实例当前应用到的配置版本
+type Instance struct {
+	InstanceID string    `json:"instance_id" gorm:"primaryKey;size:100"`
+	Hostname   string    `json:"hostname" gorm:"size:100"`
+	Version    uint      `json:"version"`
+	StartedAt  time.Time `json:"started_at"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+func (Instance) TableName() string {
+	return "instances"
+}
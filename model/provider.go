@@ -0,0 +1,72 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// ProviderOptions 各供应商的专属配置，只有provider对应的部分生效
+type ProviderOptions struct {
+	Azure   *AzureOptions   `json:"azure,omitempty"`
+	Bedrock *BedrockOptions `json:"bedrock,omitempty"`
+	Vertex  *VertexOptions  `json:"vertex,omitempty"`
+	Local   *LocalOptions   `json:"local,omitempty"`
+}
+
+// AzureOptions Azure OpenAI配置，客户端按OpenAI的路径和模型名请求，转发时改为部署路径
+type AzureOptions struct {
+	APIVersion        string            `json:"api_version"`                  // 客户端未指定api-version时使用的版本
+	Deployments       map[string]string `json:"deployments,omitempty"`        // OpenAI模型名到部署名的映射，未映射的模型名直接作为部署名
+	DefaultDeployment string            `json:"default_deployment,omitempty"` // 请求中没有模型时使用的部署，如multipart上传
+}
+
+// BedrockOptions AWS Bedrock配置，客户端按Anthropic Messages API请求，转发时改为invoke接口并使用SigV4签名，
+// Secret Access Key保存在API配置的secret字段
+type BedrockOptions struct {
+	Region      string            `json:"region"`           // 如us-east-1
+	AccessKeyID string            `json:"access_key_id"`    // AWS Access Key ID
+	Models      map[string]string `json:"models,omitempty"` // Anthropic模型名到Bedrock模型ID的映射，未映射的模型名直接作为模型ID
+}
+
+// VertexOptions Google Vertex AI配置，客户端按Gemini API的路径请求，转发时改为项目和区域下的模型路径，
+// 使用服务账号换取的访问令牌认证，服务账号JSON密钥保存在API配置的secret字段
+type VertexOptions struct {
+	ProjectID string `json:"project_id,omitempty"` // 项目ID，为空时使用服务账号所属的项目
+	Location  string `json:"location"`             // 区域，如us-central1、global
+	TokenURL  string `json:"token_url,omitempty"`  // 令牌地址，为空时使用服务账号中的token_uri或Google默认地址
+}
+
+// LocalOptions 本地或自建模型服务配置，如Ollama、llama.cpp、vLLM
+type LocalOptions struct {
+	// 上游接口类型：openai（默认）表示OpenAI兼容接口，原样转发；
+	// ollama表示Ollama原生接口，OpenAI的对话和模型列表请求转换为/api/chat和/api/tags
+	API string `json:"api,omitempty"`
+}
+
+// Value 实现driver.Valuer
+func (o ProviderOptions) Value() (driver.Value, error) {
+	data, err := json.Marshal(o)
+	return string(data), err
+}
+
+// Scan 实现sql.Scanner
+func (o *ProviderOptions) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*o = ProviderOptions{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("无法解析供应商配置: %T", value)
+	}
+	*o = ProviderOptions{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, o)
+}
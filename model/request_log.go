@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// 请求日志结构体，记录每次代理转发的结果和用量
+type RequestLog struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	APIName          string    `json:"api_name" gorm:"index;size:50"`
+	Method           string    `json:"method" gorm:"size:10"`
+	Path             string    `json:"path" gorm:"size:255"`
+	StatusCode       int       `json:"status_code"`
+	ResponseTime     int64     `json:"response_time"` // 耗时（毫秒）
+	ClientIP         string    `json:"client_ip" gorm:"size:64"`
+	RequestBytes     int64     `json:"request_bytes"`
+	ResponseBytes    int64     `json:"response_bytes"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	ErrorMessage     string    `json:"error_message" gorm:"size:500"`
+	RequestMessages  int64     `json:"request_messages"`            // WebSocket会话中客户端发送的消息数
+	ResponseMessages int64     `json:"response_messages"`           // WebSocket会话中上游发送的消息数
+	CloseReason      string    `json:"close_reason" gorm:"size:20"` // WebSocket会话的关闭原因
+	CreatedAt        time.Time `json:"created_at" gorm:"index"`
+}
+
+func (RequestLog) TableName() string {
+	return "request_logs"
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// RequestPolicy 请求体参数策略，对JSON请求体生效，依次执行strip、defaults、force，再检查model和上限
+type RequestPolicy struct {
+	AllowedModels       []string               `json:"allowed_models,omitempty"`        // 允许的model，支持*通配，为空表示不限制
+	MaxTokens           int                    `json:"max_tokens,omitempty"`            // max_tokens上限，0表示不限制
+	MaxCompletionTokens int                    `json:"max_completion_tokens,omitempty"` // max_completion_tokens上限，0表示不限制
+	MaxN                int                    `json:"max_n,omitempty"`                 // n上限，0表示不限制
+	Strip               []string               `json:"strip,omitempty"`                 // 删除的参数
+	Defaults            map[string]interface{} `json:"defaults,omitempty"`              // 客户端未提供时注入的参数
+	Force               map[string]interface{} `json:"force,omitempty"`                 // 强制设置的参数，覆盖客户端的值
+}
+
+// IsEmpty 策略是否为空
+func (p RequestPolicy) IsEmpty() bool {
+	return len(p.AllowedModels) == 0 && p.MaxTokens == 0 && p.MaxCompletionTokens == 0 && p.MaxN == 0 &&
+		len(p.Strip) == 0 && len(p.Defaults) == 0 && len(p.Force) == 0
+}
+
+// Value 实现driver.Valuer
+func (p RequestPolicy) Value() (driver.Value, error) {
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// Scan 实现sql.Scanner
+func (p *RequestPolicy) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = RequestPolicy{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("无法解析请求策略: %T", value)
+	}
+	*p = RequestPolicy{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// RewriteRules 转发时对请求和响应的改写规则，值中可以使用${client_key}、${request_id}、${env.AI_PROXY_XXX}模板
+type RewriteRules struct {
+	RequestHeaders  HeaderRewrite `json:"request_headers"`
+	Query           QueryRewrite  `json:"query"`
+	Path            PathRewrite   `json:"path"`
+	ResponseHeaders HeaderRewrite `json:"response_headers"`
+}
+
+// HeaderRewrite 请求头或响应头改写，依次执行remove、set、add
+type HeaderRewrite struct {
+	Remove []string          `json:"remove,omitempty"` // 删除的头
+	Set    map[string]string `json:"set,omitempty"`    // 设置的头，覆盖原值
+	Add    map[string]string `json:"add,omitempty"`    // 追加的头，保留原值
+}
+
+// QueryRewrite 查询参数改写，依次执行remove、set、default
+type QueryRewrite struct {
+	Remove  []string          `json:"remove,omitempty"`  // 删除的参数
+	Set     map[string]string `json:"set,omitempty"`     // 设置的参数，覆盖原值
+	Default map[string]string `json:"default,omitempty"` // 客户端未提供时添加的参数
+}
+
+// PathRewrite 路径改写，依次执行strip_prefix、regex、add_prefix
+type PathRewrite struct {
+	StripPrefix string         `json:"strip_prefix,omitempty"` // 去掉的路径前缀
+	Regex       []RegexRewrite `json:"regex,omitempty"`        // 按顺序执行的正则替换
+	AddPrefix   string         `json:"add_prefix,omitempty"`   // 添加的路径前缀
+}
+
+// RegexRewrite 正则替换，replacement中可以用$1引用分组
+type RegexRewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// Value 实现driver.Valuer
+func (r RewriteRules) Value() (driver.Value, error) {
+	data, err := json.Marshal(r)
+	return string(data), err
+}
+
+// Scan 实现sql.Scanner
+func (r *RewriteRules) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*r = RewriteRules{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("无法解析改写规则: %T", value)
+	}
+	*r = RewriteRules{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, r)
+}
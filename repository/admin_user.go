@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+)
+
+// gormAdminUserRepository 基于GORM的管理员账号存储
+type gormAdminUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAdminUserRepository 创建基于GORM的管理员账号存储
+func NewGormAdminUserRepository(db *gorm.DB) AdminUserRepository {
+	return &gormAdminUserRepository{db: db}
+}
+
+// 查询所有管理员
+func (r *gormAdminUserRepository) FindAll() ([]model.AdminUser, error) {
+	var users []model.AdminUser
+	result := r.db.Order("id ASC").Find(&users)
+	return users, result.Error
+}
+
+// 按用户名查询
+func (r *gormAdminUserRepository) FindByUsername(username string) (*model.AdminUser, error) {
+	var user model.AdminUser
+	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 按ID查询
+func (r *gormAdminUserRepository) FindByID(id uint) (*model.AdminUser, error) {
+	var user model.AdminUser
+	if err := r.db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 创建管理员
+func (r *gormAdminUserRepository) Create(user *model.AdminUser) error {
+	return r.db.Create(user).Error
+}
+
+// 按字段更新
+func (r *gormAdminUserRepository) UpdateFields(username string, fields map[string]interface{}) error {
+	return r.db.Model(&model.AdminUser{}).Where("username = ?", username).Updates(fields).Error
+}
+
+// 删除管理员
+func (r *gormAdminUserRepository) Delete(username string) error {
+	return r.db.Where("username = ?", username).Delete(&model.AdminUser{}).Error
+}
+
+// gormAdminSessionRepository 基于GORM的管理员会话存储
+type gormAdminSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAdminSessionRepository 创建基于GORM的管理员会话存储
+func NewGormAdminSessionRepository(db *gorm.DB) AdminSessionRepository {
+	return &gormAdminSessionRepository{db: db}
+}
+
+// 创建会话
+func (r *gormAdminSessionRepository) Create(session *model.AdminSession) error {
+	return r.db.Create(session).Error
+}
+
+// 按ID查询
+func (r *gormAdminSessionRepository) FindByID(id string) (*model.AdminSession, error) {
+	var session model.AdminSession
+	if err := r.db.Where("id = ?", id).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// 删除会话
+func (r *gormAdminSessionRepository) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.AdminSession{}).Error
+}
+
+// 删除某个用户的所有会话
+func (r *gormAdminSessionRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.AdminSession{}).Error
+}
+
+// 删除过期会话
+func (r *gormAdminSessionRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at < ?", now).Delete(&model.AdminSession{}).Error
+}
@@ -1,65 +1,222 @@
 package repository
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"AI-PROXY/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-var db *gorm.DB
-
-// 初始化数据库连接，根据model目录下的数据结构自动创建api配置表
-func InitDB(database *gorm.DB) {
-	db = database
+// gormAPIConfigRepository 基于GORM的API配置存储
+type gormAPIConfigRepository struct {
+	db *gorm.DB
+}
 
-	// 只进行自动迁移，不删除现有表，保留历史数据
-	database.AutoMigrate(&model.APIConfig{})
+// NewGormAPIConfigRepository 创建基于GORM的API配置存储
+func NewGormAPIConfigRepository(db *gorm.DB) APIConfigRepository {
+	return &gormAPIConfigRepository{db: db}
 }
 
 // 查询所有api配置
-func GetALLAPIConfig() ([]model.APIConfig, error) {
+func (r *gormAPIConfigRepository) FindAll() ([]model.APIConfig, error) {
 	var configs []model.APIConfig
-	result := db.Find(&configs)
+	result := r.db.Find(&configs)
 	return configs, result.Error
 }
 
+// 按条件分页查询api配置
+func (r *gormAPIConfigRepository) Find(filter APIConfigFilter) ([]model.APIConfig, int64, error) {
+	query := r.db.Model(&model.APIConfig{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		query = query.Where("(LOWER(name) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!')", pattern, pattern)
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if filter.TestStatus != "" {
+		query = query.Where("last_test_status = ?", filter.TestStatus)
+	}
+	if filter.Provider != "" {
+		query = query.Where("provider = ?", filter.Provider)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	sortColumn := filter.Sort
+	if !APIConfigSortColumns[sortColumn] {
+		sortColumn = "name"
+	}
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn}, Desc: filter.Desc}).Order("id")
+	var configs []model.APIConfig
+	result := query.Limit(filter.Limit).Offset(filter.Offset).Find(&configs)
+	return configs, total, result.Error
+}
+
+// escapeLike 转义LIKE中的通配符，配合ESCAPE '!'使用
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
 // 查询单个api配置
-func GetAPIConfigByName(name string) (*model.APIConfig, error) {
+func (r *gormAPIConfigRepository) FindByName(name string) (*model.APIConfig, error) {
+	return findAPIConfig(r.db, name)
+}
+
+// findAPIConfig 在db（可以是事务）中查询单个api配置
+func findAPIConfig(db *gorm.DB, name string) (*model.APIConfig, error) {
 	var config model.APIConfig
 	result := db.Where("name=?", name).First(&config)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
 		return nil, result.Error
 	}
 	return &config, nil
 }
 
 // 创建API配置
-func CreateAPIConfig(config *model.APIConfig) error {
-	return db.Create(config).Error
+func (r *gormAPIConfigRepository) Create(config *model.APIConfig) error {
+	return r.db.Create(config).Error
+}
+
+// 更新配置，零值字段会被忽略
+func (r *gormAPIConfigRepository) Update(name string, config *model.APIConfig, expectedVersion int) (*model.APIConfig, error) {
+	return r.UpdateFields(name, nonZeroFields(config), expectedVersion)
+}
+
+// 按字段更新配置，可以写入零值，每次更新版本号加1；
+// 在同一事务中读回更新后的配置，保证返回的版本号和内容对应本次更新
+func (r *gormAPIConfigRepository) UpdateFields(name string, fields map[string]interface{}, expectedVersion int) (*model.APIConfig, error) {
+	values := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		values[k] = v
+	}
+	values["version"] = gorm.Expr("version + 1")
+	newName := name
+	if n, ok := values["name"].(string); ok && n != "" {
+		newName = n
+	}
+
+	var updated *model.APIConfig
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.APIConfig{}).Where("name = ?", name)
+		if expectedVersion > 0 {
+			query = query.Where("version = ?", expectedVersion)
+		}
+		result := query.Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if _, err := findAPIConfig(tx, name); err != nil {
+				return err
+			}
+			return ErrVersionConflict
+		}
+		var err error
+		updated, err = findAPIConfig(tx, newName)
+		return err
+	})
+	return updated, err
+}
+
+// 软删除API配置，同时把版本号加1，使删除也对应一个独立的历史版本
+func (r *gormAPIConfigRepository) Delete(name string) (*model.APIConfig, error) {
+	var deleted model.APIConfig
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.APIConfig{}).Where("name = ?", name).Updates(map[string]interface{}{
+			"deleted_at": time.Now(),
+			"version":    gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Unscoped().Where("name = ?", name).First(&deleted).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &deleted, nil
 }
 
-// 更新配置
-func UpdateAPIConfig(name string, config *model.APIConfig) error {
-	return db.Model(&model.APIConfig{}).Where("name= ?", name).Updates(config).Error
+// 查询已软删除的API配置
+func (r *gormAPIConfigRepository) FindDeletedByName(name string) (*model.APIConfig, error) {
+	var config model.APIConfig
+	result := r.db.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", name).First(&config)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &config, nil
 }
 
-// 删除API配置
-func DeleteAPIConfig(name string) error {
-	return db.Unscoped().Where("name=?", name).Delete(&model.APIConfig{}).Error
+// 恢复已软删除的API配置
+func (r *gormAPIConfigRepository) Restore(name string) (*model.APIConfig, error) {
+	var restored *model.APIConfig
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&model.APIConfig{}).Where("name = ? AND deleted_at IS NOT NULL", name).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"updated_at": time.Now(),
+			"version":    gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		var err error
+		restored, err = findAPIConfig(tx, name)
+		return err
+	})
+	return restored, err
+}
+
+// 彻底删除API配置
+func (r *gormAPIConfigRepository) Purge(name string) error {
+	return r.db.Unscoped().Where("name=?", name).Delete(&model.APIConfig{}).Error
+}
+
+// 查询updated_at不早于指定时间的配置
+func (r *gormAPIConfigRepository) FindUpdatedSince(t time.Time) ([]model.APIConfig, error) {
+	var configs []model.APIConfig
+	result := r.db.Where("updated_at >= ?", t).Find(&configs)
+	return configs, result.Error
+}
+
+// 获取API配置总数
+func (r *gormAPIConfigRepository) Count() (int, error) {
+	var count int64
+	result := r.db.Model(&model.APIConfig{}).Count(&count)
+	return int(count), result.Error
 }
 
-// GetActiveAPICount 获取活跃API配置数量
-func GetActiveAPICount() (int, error) {
+// 获取活跃API配置数量
+func (r *gormAPIConfigRepository) CountActive() (int, error) {
 	var count int64
-	result := db.Model(&model.APIConfig{}).Where("active = ?", true).Count(&count)
+	result := r.db.Model(&model.APIConfig{}).Where("active = ?", true).Count(&count)
 	return int(count), result.Error
 }
 
 // 更新API测试状态
-func UpdateAPITestStatus(name string, status string, testTime time.Time) error {
-	return db.Model(&model.APIConfig{}).Where("name = ?", name).Updates(map[string]interface{}{
+func (r *gormAPIConfigRepository) UpdateTestStatus(name string, status string, testTime time.Time) error {
+	return r.db.Model(&model.APIConfig{}).Where("name = ?", name).Updates(map[string]interface{}{
 		"last_test_status": status,
 		"last_test_time":   testTime,
 	}).Error
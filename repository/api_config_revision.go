@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+)
+
+// gormAPIConfigRevisionRepository 基于GORM的API配置历史版本存储
+type gormAPIConfigRevisionRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAPIConfigRevisionRepository 创建基于GORM的API配置历史版本存储
+func NewGormAPIConfigRevisionRepository(db *gorm.DB) APIConfigRevisionRepository {
+	return &gormAPIConfigRevisionRepository{db: db}
+}
+
+// 保存一个版本
+func (r *gormAPIConfigRevisionRepository) Create(revision *model.APIConfigRevision) error {
+	return r.db.Create(revision).Error
+}
+
+// 查询某个API的所有版本
+func (r *gormAPIConfigRevisionRepository) FindByAPI(name string) ([]model.APIConfigRevision, error) {
+	var revisions []model.APIConfigRevision
+	result := r.db.Where("api_name = ?", name).Order("version DESC").Find(&revisions)
+	return revisions, result.Error
+}
+
+// 查询某个API的指定版本
+func (r *gormAPIConfigRevisionRepository) FindVersion(name string, version int) (*model.APIConfigRevision, error) {
+	var revision model.APIConfigRevision
+	result := r.db.Where("api_name = ? AND version = ?", name, version).First(&revision)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &revision, nil
+}
+
+// 获取某个API的最新版本号
+func (r *gormAPIConfigRevisionRepository) LatestVersion(name string) (int, error) {
+	var version int
+	result := r.db.Model(&model.APIConfigRevision{}).Where("api_name = ?", name).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	return version, result.Error
+}
+
+// API改名时把历史版本移到新名称下
+func (r *gormAPIConfigRevisionRepository) Rename(oldName, newName string) error {
+	return r.db.Model(&model.APIConfigRevision{}).Where("api_name = ?", oldName).Update("api_name", newName).Error
+}
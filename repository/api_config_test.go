@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"AI-PROXY/model"
+)
+
+func TestGormAPIConfigs(t *testing.T) {
+	store := newTestStore(t)
+	repo := store.APIConfigs
+
+	if err := repo.Create(&model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := repo.FindByName("openai")
+	if err != nil || created.Version != 1 || created.LastTestStatus != "never" {
+		t.Fatalf("FindByName = %+v, %v", created, err)
+	}
+
+	// 更新返回本次更新后的配置，版本号加1
+	updated, err := repo.Update("openai", &model.APIConfig{Description: "OpenAI"}, 1)
+	if err != nil || updated.Version != 2 || updated.Description != "OpenAI" || updated.BaseURL != "https://api.openai.com" {
+		t.Fatalf("Update = %+v, %v", updated, err)
+	}
+	if _, err := repo.Update("openai", &model.APIConfig{Description: "stale"}, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("过期版本号: err = %v, want ErrVersionConflict", err)
+	}
+	if _, err := repo.Update("missing", &model.APIConfig{Description: "x"}, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("不存在的配置: err = %v, want ErrNotFound", err)
+	}
+
+	// UpdateFields可以写入零值，改名后返回新名称下的配置
+	updated, err = repo.UpdateFields("openai", map[string]interface{}{"active": false, "name": "openai-2"}, 0)
+	if err != nil || updated.Name != "openai-2" || updated.Active || updated.Version != 3 {
+		t.Fatalf("UpdateFields = %+v, %v", updated, err)
+	}
+	if n, _ := repo.CountActive(); n != 0 {
+		t.Errorf("CountActive = %d, want 0", n)
+	}
+
+	// 删除和恢复各增加一个版本
+	deleted, err := repo.Delete("openai-2")
+	if err != nil || deleted.Version != 4 || !deleted.DeletedAt.Valid {
+		t.Fatalf("Delete = %+v, %v", deleted, err)
+	}
+	if _, err := repo.FindByName("openai-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除后FindByName: err = %v", err)
+	}
+	if c, err := repo.FindDeletedByName("openai-2"); err != nil || c.Version != 4 {
+		t.Errorf("FindDeletedByName = %+v, %v", c, err)
+	}
+	if _, err := repo.Delete("openai-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("重复删除: err = %v, want ErrNotFound", err)
+	}
+	if n, _ := repo.Count(); n != 0 {
+		t.Errorf("Count = %d, want 0", n)
+	}
+
+	restored, err := repo.Restore("openai-2")
+	if err != nil || restored.Version != 5 || restored.DeletedAt.Valid {
+		t.Fatalf("Restore = %+v, %v", restored, err)
+	}
+	if _, err := repo.Restore("openai-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("重复恢复: err = %v, want ErrNotFound", err)
+	}
+
+	if err := repo.Purge("openai-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindDeletedByName("openai-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("彻底删除后FindDeletedByName: err = %v", err)
+	}
+	if err := repo.Create(&model.APIConfig{Name: "openai-2", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Errorf("彻底删除后应能重新创建: %v", err)
+	}
+}
+
+func TestGormAPIConfigFind(t *testing.T) {
+	store := newTestStore(t)
+	repo := store.APIConfigs
+	for _, c := range []model.APIConfig{
+		{Name: "gpt_4", BaseURL: "https://a", Provider: "openai"},
+		{Name: "gpt-4x", BaseURL: "https://b", Provider: "openai"},
+		{Name: "quota", BaseURL: "https://c", Description: "100% 可用"},
+		{Name: "a!b", BaseURL: "https://d"},
+		{Name: "claude", BaseURL: "https://e", Description: "Anthropic GPT替代"},
+	} {
+		c := c
+		if err := repo.Create(&c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Delete("claude"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(configs []model.APIConfig) []string {
+		var result []string
+		for _, c := range configs {
+			result = append(result, c.Name)
+		}
+		return result
+	}
+	// service层总是设置Limit
+	tests := []struct {
+		filter APIConfigFilter
+		want   []string
+		total  int64
+	}{
+		// LIKE的通配符按字面匹配
+		{APIConfigFilter{Query: "_", Limit: 10}, []string{"gpt_4"}, 1},
+		{APIConfigFilter{Query: "%", Limit: 10}, []string{"quota"}, 1},
+		{APIConfigFilter{Query: "!", Limit: 10}, []string{"a!b"}, 1},
+		// 不区分大小写，同时搜索描述，默认排除已删除的配置
+		{APIConfigFilter{Query: "GPT", Limit: 10}, []string{"gpt-4x", "gpt_4"}, 2},
+		{APIConfigFilter{Query: "gpt", Deleted: true, Limit: 10}, []string{"claude"}, 1},
+		{APIConfigFilter{Provider: "openai", Sort: "name", Desc: true, Limit: 10}, []string{"gpt_4", "gpt-4x"}, 2},
+		{APIConfigFilter{Limit: 2, Offset: 1}, []string{"gpt-4x", "gpt_4"}, 4},
+		// 不支持的排序列按名称排序
+		{APIConfigFilter{Sort: "base_url; DROP TABLE api_configs", Limit: 1}, []string{"a!b"}, 4},
+	}
+	for _, tt := range tests {
+		configs, total, err := repo.Find(tt.filter)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.filter, err)
+		}
+		if got := names(configs); total != tt.total || !equalStrings(got, tt.want) {
+			t.Errorf("%+v: = %v (total %d), want %v (total %d)", tt.filter, got, total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestGormAPIConfigRevisions(t *testing.T) {
+	store := newTestStore(t)
+	repo := store.Revisions
+
+	if v, err := repo.LatestVersion("openai"); err != nil || v != 0 {
+		t.Fatalf("没有历史时LatestVersion = %d, %v", v, err)
+	}
+	for v := 1; v <= 3; v++ {
+		if err := repo.Create(&model.APIConfigRevision{APIName: "openai", Version: v, Action: "update"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一API的版本号唯一
+	if err := repo.Create(&model.APIConfigRevision{APIName: "openai", Version: 3}); err == nil {
+		t.Error("重复的版本号应写入失败")
+	}
+
+	revisions, err := repo.FindByAPI("openai")
+	if err != nil || len(revisions) != 3 || revisions[0].Version != 3 {
+		t.Fatalf("FindByAPI = %+v, %v", revisions, err)
+	}
+	if _, err := repo.FindVersion("openai", 4); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindVersion不存在的版本: err = %v", err)
+	}
+
+	if err := repo.Rename("openai", "openai-2"); err != nil {
+		t.Fatal(err)
+	}
+	if revisions, _ := repo.FindByAPI("openai"); len(revisions) != 0 {
+		t.Errorf("改名后旧名称下还有 %d 个版本", len(revisions))
+	}
+	if v, err := repo.LatestVersion("openai-2"); err != nil || v != 3 {
+		t.Errorf("改名后LatestVersion = %d, %v", v, err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+)
+
+// gormAuditLogRepository 基于GORM的审计日志存储
+type gormAuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAuditLogRepository 创建基于GORM的审计日志存储
+func NewGormAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &gormAuditLogRepository{db: db}
+}
+
+// 写入一条审计日志
+func (r *gormAuditLogRepository) Create(log *model.AuditLog) error {
+	return r.db.Create(log).Error
+}
+
+// 按条件查询审计日志
+func (r *gormAuditLogRepository) Find(filter AuditFilter) ([]model.AuditLog, int64, error) {
+	query := r.db.Model(&model.AuditLog{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityName != "" {
+		query = query.Where("entity_name = ?", filter.EntityName)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []model.AuditLog
+	result := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&logs)
+	return logs, total, result.Error
+}
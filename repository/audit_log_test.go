@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+func TestGormAuditLogs(t *testing.T) {
+	repo := newTestStore(t).AuditLogs
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, l := range []model.AuditLog{
+		{Actor: "alice", Action: "create", Entity: "api_config", EntityName: "openai"},
+		{Actor: "alice", Action: "update", Entity: "api_config", EntityName: "openai"},
+		{Actor: "bob", Action: "delete", Entity: "api_config", EntityName: "claude"},
+		{Actor: "alice", Action: "create", Entity: "admin_user", EntityName: "bob"},
+	} {
+		l := l
+		l.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := repo.Create(&l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter AuditFilter
+		want   []string // 按时间倒序的action/entity_name
+		total  int64
+	}{
+		{AuditFilter{Limit: 10}, []string{"create/bob", "delete/claude", "update/openai", "create/openai"}, 4},
+		{AuditFilter{Actor: "alice", Entity: "api_config", Limit: 10}, []string{"update/openai", "create/openai"}, 2},
+		{AuditFilter{Action: "delete", Limit: 10}, []string{"delete/claude"}, 1},
+		{AuditFilter{EntityName: "openai", Limit: 1, Offset: 1}, []string{"create/openai"}, 2},
+		// Since包含边界，Until不包含
+		{AuditFilter{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour), Limit: 10}, []string{"delete/claude", "update/openai"}, 2},
+	}
+	for _, tt := range tests {
+		logs, total, err := repo.Find(tt.filter)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.filter, err)
+		}
+		var got []string
+		for _, l := range logs {
+			got = append(got, l.Action+"/"+l.EntityName)
+		}
+		if total != tt.total || !equalStrings(got, tt.want) {
+			t.Errorf("%+v: = %v (total %d), want %v (total %d)", tt.filter, got, total, tt.want, tt.total)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormConfigChangeRepository 基于GORM的配置变更日志存储
+type gormConfigChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewGormConfigChangeRepository 创建基于GORM的配置变更日志存储
+func NewGormConfigChangeRepository(db *gorm.DB) ConfigChangeRepository {
+	return &gormConfigChangeRepository{db: db}
+}
+
+// 追加一条变更
+func (r *gormConfigChangeRepository) Append(change *model.ConfigChange) error {
+	return r.db.Create(change).Error
+}
+
+// 查询ID大于afterID的变更
+func (r *gormConfigChangeRepository) FindAfter(afterID uint, limit int) ([]model.ConfigChange, error) {
+	var changes []model.ConfigChange
+	result := r.db.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&changes)
+	return changes, result.Error
+}
+
+// 获取最新的变更ID
+func (r *gormConfigChangeRepository) LatestID() (uint, error) {
+	var id uint
+	result := r.db.Model(&model.ConfigChange{}).Select("COALESCE(MAX(id), 0)").Scan(&id)
+	return id, result.Error
+}
+
+// gormInstanceRepository 基于GORM的实例心跳存储
+type gormInstanceRepository struct {
+	db *gorm.DB
+}
+
+// NewGormInstanceRepository 创建基于GORM的实例心跳存储
+func NewGormInstanceRepository(db *gorm.DB) InstanceRepository {
+	return &gormInstanceRepository{db: db}
+}
+
+// 写入或更新实例心跳
+func (r *gormInstanceRepository) Upsert(instance *model.Instance) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hostname", "version", "last_seen"}),
+	}).Create(instance).Error
+}
+
+// 查询所有实例
+func (r *gormInstanceRepository) FindAll() ([]model.Instance, error) {
+	var instances []model.Instance
+	result := r.db.Order("started_at ASC").Find(&instances)
+	return instances, result.Error
+}
+
+// 删除最后心跳早于指定时间的实例
+func (r *gormInstanceRepository) DeleteSeenBefore(t time.Time) error {
+	return r.db.Where("last_seen < ?", t).Delete(&model.Instance{}).Error
+}
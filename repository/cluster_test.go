@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+func TestGormConfigChanges(t *testing.T) {
+	repo := newTestStore(t).ConfigChanges
+
+	if id, err := repo.LatestID(); err != nil || id != 0 {
+		t.Fatalf("没有变更时LatestID = %d, %v", id, err)
+	}
+	for _, name := range []string{"openai", "claude", "gemini"} {
+		change := &model.ConfigChange{Entity: "api_config", Name: name, Action: "update"}
+		if err := repo.Append(change); err != nil || change.ID == 0 {
+			t.Fatalf("Append = %d, %v", change.ID, err)
+		}
+	}
+	if id, err := repo.LatestID(); err != nil || id != 3 {
+		t.Errorf("LatestID = %d, %v", id, err)
+	}
+
+	changes, err := repo.FindAfter(1, 1)
+	if err != nil || len(changes) != 1 || changes[0].ID != 2 || changes[0].Name != "claude" {
+		t.Errorf("FindAfter(1, 1) = %+v, %v", changes, err)
+	}
+	if changes, _ := repo.FindAfter(3, 10); len(changes) != 0 {
+		t.Errorf("FindAfter(3) = %+v", changes)
+	}
+}
+
+func TestGormInstances(t *testing.T) {
+	repo := newTestStore(t).Instances
+	now := time.Now()
+
+	if err := repo.Upsert(&model.Instance{InstanceID: "a", Hostname: "host-a", Version: 1, StartedAt: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(&model.Instance{InstanceID: "b", Hostname: "host-b", Version: 1, StartedAt: now, LastSeen: now}); err != nil {
+		t.Fatal(err)
+	}
+	// 再次写入时更新心跳，保留启动时间
+	if err := repo.Upsert(&model.Instance{InstanceID: "a", Hostname: "host-a", Version: 5, StartedAt: now, LastSeen: now}); err != nil {
+		t.Fatal(err)
+	}
+	instances, err := repo.FindAll()
+	if err != nil || len(instances) != 2 || instances[0].InstanceID != "a" || instances[0].Version != 5 {
+		t.Fatalf("FindAll = %+v, %v", instances, err)
+	}
+	if !instances[0].StartedAt.Before(instances[1].StartedAt) {
+		t.Errorf("更新心跳不应修改启动时间: %v", instances[0].StartedAt)
+	}
+
+	if err := repo.DeleteSeenBefore(now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if instances, _ := repo.FindAll(); len(instances) != 2 {
+		t.Errorf("心跳未过期的实例不应删除: %+v", instances)
+	}
+	if err := repo.DeleteSeenBefore(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if instances, _ := repo.FindAll(); len(instances) != 0 {
+		t.Errorf("心跳过期的实例应删除: %+v", instances)
+	}
+}
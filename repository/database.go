@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// NewGormStore 创建基于GORM的存储，并根据model目录下的数据结构自动迁移表结构
+func NewGormStore(database *gorm.DB) (*Store, error) {
+	// 只进行自动迁移，不删除现有表，保留历史数据
+	if err := database.AutoMigrate(
+		&model.APIConfig{},
+		&model.RequestLog{},
+		&model.ConfigChange{},
+		&model.Instance{},
+		&model.AdminUser{},
+		&model.AdminSession{},
+		&model.AuditLog{},
+		&model.APIConfigRevision{},
+	); err != nil {
+		return nil, err
+	}
+	if err := migrateLegacyGemini(database); err != nil {
+		return nil, err
+	}
+	if err := migrateRevisionVersions(database); err != nil {
+		return nil, err
+	}
+	return &Store{
+		APIConfigs:    NewGormAPIConfigRepository(database),
+		RequestLogs:   NewGormRequestLogRepository(database),
+		ConfigChanges: NewGormConfigChangeRepository(database),
+		Instances:     NewGormInstanceRepository(database),
+		AdminUsers:    NewGormAdminUserRepository(database),
+		AdminSessions: NewGormAdminSessionRepository(database),
+		AuditLogs:     NewGormAuditLogRepository(database),
+		Revisions:     NewGormAPIConfigRevisionRepository(database),
+	}, nil
+}
+
+// migrateLegacyGemini 旧版本按名称识别Gemini：名为gemini且未设置provider的API补上provider，
+// 此后Gemini的内置改写规则只按provider生效
+func migrateLegacyGemini(database *gorm.DB) error {
+	return database.Model(&model.APIConfig{}).
+		Where("name = ? AND (provider = ? OR provider IS NULL)", "gemini", "").
+		Update("provider", "gemini").Error
+}
+
+// migrateRevisionVersions 旧版本的历史版本号单独计数，删除时不增加配置的version，可能超过配置的version；
+// 现在历史版本号与version一致，把落后的version对齐到最新的历史版本号，避免后续写入与已有版本冲突
+func migrateRevisionVersions(database *gorm.DB) error {
+	latest := "(SELECT MAX(r.version) FROM api_config_revisions r WHERE r.api_name = api_configs.name)"
+	return database.Exec("UPDATE api_configs SET version = " + latest + " WHERE version < " + latest).Error
+}
+
+// OpenDB 根据配置的驱动打开数据库连接并设置连接池
+func OpenDB(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	dialector, err := newDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	database, err := gorm.Open(dialector, &gorm.Config{Logger: newGormLogger(os.Stdout)})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Driver == "sqlite" {
+		// sqlite同一时间只允许一个写入者，单连接避免database is locked
+		sqlDB.SetMaxOpenConns(1)
+	} else if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	}
+	return database, nil
+}
+
+// newGormLogger 与GORM的默认日志相同，但不记录record not found：查询不到记录是正常情况，由仓库转换为ErrNotFound
+func newGormLogger(out io.Writer) logger.Interface {
+	return logger.New(log.New(out, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+		Colorful:                  true,
+	})
+}
+
+// newDialector 按驱动构建DSN
+func newDialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "", "mysql":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			cfg.Username,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.Database,
+		)
+		return mysql.Open(dsn), nil
+	case "postgres":
+		sslMode := cfg.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=Local",
+			cfg.Host,
+			cfg.Port,
+			cfg.Username,
+			cfg.Password,
+			cfg.Database,
+			sslMode,
+		)
+		return postgres.Open(dsn), nil
+	case "sqlite":
+		path := cfg.Database
+		if path == "" {
+			path = "data/proxy.db"
+		}
+		if path == ":memory:" {
+			return sqlite.Open(path), nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+		}
+		return sqlite.Open(path + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"), nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB 打开一个内存中的SQLite数据库，每个测试独立
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := OpenDB(&config.DatabaseConfig{Driver: "sqlite", Database: ":memory:"})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return database
+}
+
+// newTestStore 在内存SQLite数据库上创建GORM存储
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewGormStore(newTestDB(t))
+	if err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+	return store
+}
+
+func TestGormLoggerIgnoresRecordNotFound(t *testing.T) {
+	database := newTestDB(t)
+	var buf bytes.Buffer
+	database.Logger = newGormLogger(&buf)
+	store, err := NewGormStore(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.APIConfigs.FindDeletedByName("missing"); err != ErrNotFound {
+		t.Fatalf("FindDeletedByName = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Revisions.FindVersion("missing", 1); err != ErrNotFound {
+		t.Fatalf("FindVersion = %v, want ErrNotFound", err)
+	}
+	if strings.Contains(buf.String(), "record not found") {
+		t.Errorf("查询不到记录时不应记录错误日志: %s", buf.String())
+	}
+
+	// 其他错误仍然记录
+	database.Exec("SELECT * FROM missing_table")
+	if !strings.Contains(buf.String(), "missing_table") {
+		t.Errorf("SQL错误应记录日志: %q", buf.String())
+	}
+}
+
+func TestMigrateRevisionVersions(t *testing.T) {
+	database := newTestDB(t)
+	if _, err := NewGormStore(database); err != nil {
+		t.Fatal(err)
+	}
+	// 旧版本的历史版本号单独计数，删除和恢复后超过配置的version
+	database.Create(&model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Version: 2})
+	database.Create(&model.APIConfig{Name: "claude", BaseURL: "https://api.anthropic.com", Version: 3})
+	for _, r := range []model.APIConfigRevision{
+		{APIName: "openai", Version: 1}, {APIName: "openai", Version: 2}, {APIName: "openai", Version: 3}, {APIName: "openai", Version: 4},
+		{APIName: "claude", Version: 1},
+	} {
+		r := r
+		database.Create(&r)
+	}
+
+	store, err := NewGormStore(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int{"openai": 4, "claude": 3} {
+		c, err := store.APIConfigs.FindByName(name)
+		if err != nil || c.Version != want {
+			t.Errorf("%s 的version = %v, want %d, err = %v", name, c, want, err)
+		}
+	}
+}
+
+func TestMigrateLegacyGemini(t *testing.T) {
+	database := newTestDB(t)
+	if _, err := NewGormStore(database); err != nil {
+		t.Fatal(err)
+	}
+	database.Create(&model.APIConfig{Name: "gemini", BaseURL: "https://generativelanguage.googleapis.com"})
+	database.Create(&model.APIConfig{Name: "other", BaseURL: "https://example.com"})
+	// 重复执行迁移不影响已有数据
+	store, err := NewGormStore(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"gemini": "gemini", "other": ""} {
+		c, err := store.APIConfigs.FindByName(name)
+		if err != nil || c.Provider != want {
+			t.Errorf("%s 的provider = %v, want %q, err = %v", name, c, want, err)
+		}
+	}
+}
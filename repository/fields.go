@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"AI-PROXY/model"
+
+	"gorm.io/gorm/schema"
+)
+
+// apiConfigSchema APIConfig的字段结构，用于按列名读写字段
+var apiConfigSchema = mustParseSchema(&model.APIConfig{})
+
+// 不允许通过更新接口修改的列
+var apiConfigReadOnlyColumns = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"version":    true,
+}
+
+func mustParseSchema(v interface{}) *schema.Schema {
+	s, err := schema.Parse(v, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(fmt.Sprintf("解析%T结构失败: %v", v, err))
+	}
+	return s
+}
+
+// nonZeroFields 与GORM的Updates(struct)一致，只取非零值字段，返回列名到值的映射
+func nonZeroFields(config *model.APIConfig) map[string]interface{} {
+	fields := make(map[string]interface{})
+	ctx := context.Background()
+	rv := reflect.ValueOf(config).Elem()
+	for _, field := range apiConfigSchema.Fields {
+		if field.DBName == "" || apiConfigReadOnlyColumns[field.DBName] {
+			continue
+		}
+		if value, zero := field.ValueOf(ctx, rv); !zero {
+			fields[field.DBName] = value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,748 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// NewMemoryStore 创建内存存储，用于测试和无数据库场景
+func NewMemoryStore() *Store {
+	return &Store{
+		APIConfigs:    NewMemoryAPIConfigRepository(),
+		RequestLogs:   NewMemoryRequestLogRepository(),
+		ConfigChanges: NewMemoryConfigChangeRepository(),
+		Instances:     NewMemoryInstanceRepository(),
+		AdminUsers:    NewMemoryAdminUserRepository(),
+		AdminSessions: NewMemoryAdminSessionRepository(),
+		AuditLogs:     NewMemoryAuditLogRepository(),
+		Revisions:     NewMemoryAPIConfigRevisionRepository(),
+	}
+}
+
+// memoryAPIConfigRepository 基于内存的API配置存储，行为与GORM实现保持一致
+type memoryAPIConfigRepository struct {
+	mu      sync.RWMutex
+	nextID  uint
+	configs map[string]*model.APIConfig
+	deleted map[string]*model.APIConfig // 已软删除的配置
+	schema  *schema.Schema
+}
+
+// NewMemoryAPIConfigRepository 创建基于内存的API配置存储
+func NewMemoryAPIConfigRepository() APIConfigRepository {
+	return &memoryAPIConfigRepository{
+		configs: make(map[string]*model.APIConfig),
+		deleted: make(map[string]*model.APIConfig),
+		schema:  apiConfigSchema,
+	}
+}
+
+// 查询所有api配置，按ID排序
+func (r *memoryAPIConfigRepository) FindAll() ([]model.APIConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	configs := make([]model.APIConfig, 0, len(r.configs))
+	for _, c := range r.configs {
+		configs = append(configs, *c)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+	return configs, nil
+}
+
+// 按条件分页查询api配置
+func (r *memoryAPIConfigRepository) Find(filter APIConfigFilter) ([]model.APIConfig, int64, error) {
+	r.mu.RLock()
+	source := r.configs
+	if filter.Deleted {
+		source = r.deleted
+	}
+	query := strings.ToLower(filter.Query)
+	matched := []model.APIConfig{}
+	for _, c := range source {
+		if query != "" && !strings.Contains(strings.ToLower(c.Name), query) && !strings.Contains(strings.ToLower(c.Description), query) {
+			continue
+		}
+		if filter.Active != nil && c.Active != *filter.Active {
+			continue
+		}
+		if filter.TestStatus != "" && c.LastTestStatus != filter.TestStatus {
+			continue
+		}
+		if filter.Provider != "" && c.Provider != filter.Provider {
+			continue
+		}
+		matched = append(matched, *c)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := &matched[i], &matched[j]
+		if cmp := compareAPIConfigs(a, b, filter.Sort); cmp != 0 {
+			return (cmp < 0) != filter.Desc
+		}
+		return a.ID < b.ID
+	})
+	total := int64(len(matched))
+	return pageOf(matched, filter.Offset, filter.Limit), total, nil
+}
+
+// compareAPIConfigs 按排序列比较两个配置，空的测试时间排在最前（与MySQL/SQLite一致）
+func compareAPIConfigs(a, b *model.APIConfig, column string) int {
+	switch column {
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case "last_test_time":
+		switch {
+		case a.LastTestTime == nil && b.LastTestTime == nil:
+			return 0
+		case a.LastTestTime == nil:
+			return -1
+		case b.LastTestTime == nil:
+			return 1
+		}
+		return a.LastTestTime.Compare(*b.LastTestTime)
+	default:
+		return strings.Compare(a.Name, b.Name)
+	}
+}
+
+// 查询单个api配置
+func (r *memoryAPIConfigRepository) FindByName(name string) (*model.APIConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.configs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+// 创建API配置，零值字段按gorm default标签填充默认值
+func (r *memoryAPIConfigRepository) Create(config *model.APIConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 与唯一索引一致，软删除的记录同样占用名称
+	if _, ok := r.configs[config.Name]; ok {
+		return fmt.Errorf("API名称已存在: %s", config.Name)
+	}
+	if _, ok := r.deleted[config.Name]; ok {
+		return fmt.Errorf("API名称已存在: %s", config.Name)
+	}
+
+	ctx := context.Background()
+	rv := reflect.ValueOf(config).Elem()
+	for _, field := range r.schema.Fields {
+		if field.DefaultValueInterface == nil {
+			continue
+		}
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			if err := field.Set(ctx, rv, field.DefaultValueInterface); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.nextID++
+	now := time.Now()
+	config.ID = r.nextID
+	config.CreatedAt = now
+	config.UpdatedAt = now
+	cp := *config
+	r.configs[config.Name] = &cp
+	return nil
+}
+
+// 更新配置，与GORM的Updates(struct)一样忽略零值字段
+func (r *memoryAPIConfigRepository) Update(name string, config *model.APIConfig, expectedVersion int) (*model.APIConfig, error) {
+	return r.UpdateFields(name, nonZeroFields(config), expectedVersion)
+}
+
+// 按字段更新配置，可以写入零值，每次更新版本号加1
+func (r *memoryAPIConfigRepository) UpdateFields(name string, fields map[string]interface{}, expectedVersion int) (*model.APIConfig, error) {
+	return r.updateFields(name, fields, expectedVersion, true)
+}
+
+func (r *memoryAPIConfigRepository) updateFields(name string, fields map[string]interface{}, expectedVersion int, bumpVersion bool) (*model.APIConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.configs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if expectedVersion > 0 && c.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	updated := *c
+	ctx := context.Background()
+	rv := reflect.ValueOf(&updated).Elem()
+	for column, value := range fields {
+		field := r.schema.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("未知字段: %s", column)
+		}
+		if err := field.Set(ctx, rv, value); err != nil {
+			return nil, err
+		}
+	}
+	updated.UpdatedAt = time.Now()
+	if bumpVersion {
+		updated.Version++
+	}
+
+	if updated.Name != name {
+		if _, exists := r.configs[updated.Name]; exists {
+			return nil, fmt.Errorf("API名称已存在: %s", updated.Name)
+		}
+		delete(r.configs, name)
+	}
+	r.configs[updated.Name] = &updated
+	cp := updated
+	return &cp, nil
+}
+
+// 软删除API配置，版本号加1
+func (r *memoryAPIConfigRepository) Delete(name string) (*model.APIConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.configs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	c.Version++
+	r.deleted[name] = c
+	delete(r.configs, name)
+	cp := *c
+	return &cp, nil
+}
+
+// 查询已软删除的API配置
+func (r *memoryAPIConfigRepository) FindDeletedByName(name string) (*model.APIConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.deleted[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+// 恢复已软删除的API配置
+func (r *memoryAPIConfigRepository) Restore(name string) (*model.APIConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.deleted[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c.DeletedAt = gorm.DeletedAt{}
+	c.UpdatedAt = time.Now()
+	c.Version++
+	r.configs[name] = c
+	delete(r.deleted, name)
+	cp := *c
+	return &cp, nil
+}
+
+// 彻底删除API配置
+func (r *memoryAPIConfigRepository) Purge(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.configs, name)
+	delete(r.deleted, name)
+	return nil
+}
+
+// 查询updated_at不早于指定时间的配置
+func (r *memoryAPIConfigRepository) FindUpdatedSince(t time.Time) ([]model.APIConfig, error) {
+	all, _ := r.FindAll()
+	configs := []model.APIConfig{}
+	for _, c := range all {
+		if !c.UpdatedAt.Before(t) {
+			configs = append(configs, c)
+		}
+	}
+	return configs, nil
+}
+
+// 获取API配置总数
+func (r *memoryAPIConfigRepository) Count() (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.configs), nil
+}
+
+// 获取活跃API配置数量
+func (r *memoryAPIConfigRepository) CountActive() (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, c := range r.configs {
+		if c.Active {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// 更新API测试状态
+func (r *memoryAPIConfigRepository) UpdateTestStatus(name string, status string, testTime time.Time) error {
+	_, err := r.updateFields(name, map[string]interface{}{
+		"last_test_status": status,
+		"last_test_time":   testTime,
+	}, 0, false)
+	// 与GORM一致，未匹配到记录时不报错
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// memoryRequestLogRepository 基于内存的请求日志存储
+type memoryRequestLogRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	logs   []model.RequestLog
+}
+
+// NewMemoryRequestLogRepository 创建基于内存的请求日志存储
+func NewMemoryRequestLogRepository() RequestLogRepository {
+	return &memoryRequestLogRepository{}
+}
+
+// 保存一条请求日志
+func (r *memoryRequestLogRepository) Create(log *model.RequestLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	log.ID = r.nextID
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	r.logs = append(r.logs, *log)
+	return nil
+}
+
+// 查询最近的请求日志
+func (r *memoryRequestLogRepository) FindRecent(apiName string, limit int) ([]model.RequestLog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	logs := []model.RequestLog{}
+	for i := len(r.logs) - 1; i >= 0 && (limit <= 0 || len(logs) < limit); i-- {
+		if apiName == "" || r.logs[i].APIName == apiName {
+			logs = append(logs, r.logs[i])
+		}
+	}
+	return logs, nil
+}
+
+// memoryConfigChangeRepository 基于内存的配置变更日志存储
+type memoryConfigChangeRepository struct {
+	mu      sync.RWMutex
+	changes []model.ConfigChange
+}
+
+// NewMemoryConfigChangeRepository 创建基于内存的配置变更日志存储
+func NewMemoryConfigChangeRepository() ConfigChangeRepository {
+	return &memoryConfigChangeRepository{}
+}
+
+// 追加一条变更
+func (r *memoryConfigChangeRepository) Append(change *model.ConfigChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change.ID = uint(len(r.changes) + 1)
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+	r.changes = append(r.changes, *change)
+	return nil
+}
+
+// 查询ID大于afterID的变更
+func (r *memoryConfigChangeRepository) FindAfter(afterID uint, limit int) ([]model.ConfigChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	changes := []model.ConfigChange{}
+	for _, c := range r.changes {
+		if c.ID > afterID && (limit <= 0 || len(changes) < limit) {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// 获取最新的变更ID
+func (r *memoryConfigChangeRepository) LatestID() (uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return uint(len(r.changes)), nil
+}
+
+// memoryInstanceRepository 基于内存的实例心跳存储
+type memoryInstanceRepository struct {
+	mu        sync.RWMutex
+	instances map[string]model.Instance
+}
+
+// NewMemoryInstanceRepository 创建基于内存的实例心跳存储
+func NewMemoryInstanceRepository() InstanceRepository {
+	return &memoryInstanceRepository{instances: make(map[string]model.Instance)}
+}
+
+// 写入或更新实例心跳
+func (r *memoryInstanceRepository) Upsert(instance *model.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.instances[instance.InstanceID]; ok {
+		old.Hostname = instance.Hostname
+		old.Version = instance.Version
+		old.LastSeen = instance.LastSeen
+		r.instances[instance.InstanceID] = old
+		return nil
+	}
+	r.instances[instance.InstanceID] = *instance
+	return nil
+}
+
+// 查询所有实例
+func (r *memoryInstanceRepository) FindAll() ([]model.Instance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	instances := make([]model.Instance, 0, len(r.instances))
+	for _, i := range r.instances {
+		instances = append(instances, i)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].StartedAt.Before(instances[j].StartedAt) })
+	return instances, nil
+}
+
+// 删除最后心跳早于指定时间的实例
+func (r *memoryInstanceRepository) DeleteSeenBefore(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, i := range r.instances {
+		if i.LastSeen.Before(t) {
+			delete(r.instances, id)
+		}
+	}
+	return nil
+}
+
+// memoryAdminUserRepository 基于内存的管理员账号存储
+type memoryAdminUserRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	users  map[string]*model.AdminUser
+}
+
+// NewMemoryAdminUserRepository 创建基于内存的管理员账号存储
+func NewMemoryAdminUserRepository() AdminUserRepository {
+	return &memoryAdminUserRepository{users: make(map[string]*model.AdminUser)}
+}
+
+// 查询所有管理员
+func (r *memoryAdminUserRepository) FindAll() ([]model.AdminUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]model.AdminUser, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, *u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// 按用户名查询
+func (r *memoryAdminUserRepository) FindByUsername(username string) (*model.AdminUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+// 按ID查询
+func (r *memoryAdminUserRepository) FindByID(id uint) (*model.AdminUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if u.ID == id {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// 创建管理员
+func (r *memoryAdminUserRepository) Create(user *model.AdminUser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.Username]; ok {
+		return fmt.Errorf("用户名已存在: %s", user.Username)
+	}
+	r.nextID++
+	now := time.Now()
+	user.ID = r.nextID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	cp := *user
+	r.users[user.Username] = &cp
+	return nil
+}
+
+// 按字段更新，只支持管理员账号可修改的字段
+func (r *memoryAdminUserRepository) UpdateFields(username string, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[username]
+	if !ok {
+		return nil
+	}
+	for column, value := range fields {
+		switch column {
+		case "password_hash":
+			u.PasswordHash = value.(string)
+		case "role":
+			u.Role = value.(string)
+		case "active":
+			u.Active = value.(bool)
+		case "last_login_at":
+			t := value.(time.Time)
+			u.LastLoginAt = &t
+		default:
+			return fmt.Errorf("未知字段: %s", column)
+		}
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// 删除管理员
+func (r *memoryAdminUserRepository) Delete(username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, username)
+	return nil
+}
+
+// memoryAdminSessionRepository 基于内存的管理员会话存储
+type memoryAdminSessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]model.AdminSession
+}
+
+// NewMemoryAdminSessionRepository 创建基于内存的管理员会话存储
+func NewMemoryAdminSessionRepository() AdminSessionRepository {
+	return &memoryAdminSessionRepository{sessions: make(map[string]model.AdminSession)}
+}
+
+// 创建会话
+func (r *memoryAdminSessionRepository) Create(session *model.AdminSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+// 按ID查询
+func (r *memoryAdminSessionRepository) FindByID(id string) (*model.AdminSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+// 删除会话
+func (r *memoryAdminSessionRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+	return nil
+}
+
+// 删除某个用户的所有会话
+func (r *memoryAdminSessionRepository) DeleteByUser(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sessions {
+		if s.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+// 删除过期会话
+func (r *memoryAdminSessionRepository) DeleteExpired(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sessions {
+		if s.ExpiresAt.Before(now) {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+// memoryAuditLogRepository 基于内存的审计日志存储
+type memoryAuditLogRepository struct {
+	mu   sync.RWMutex
+	logs []model.AuditLog
+}
+
+// NewMemoryAuditLogRepository 创建基于内存的审计日志存储
+func NewMemoryAuditLogRepository() AuditLogRepository {
+	return &memoryAuditLogRepository{}
+}
+
+// 写入一条审计日志
+func (r *memoryAuditLogRepository) Create(log *model.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log.ID = uint(len(r.logs) + 1)
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	r.logs = append(r.logs, *log)
+	return nil
+}
+
+// 按条件查询审计日志
+func (r *memoryAuditLogRepository) Find(filter AuditFilter) ([]model.AuditLog, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var matched []model.AuditLog
+	for i := len(r.logs) - 1; i >= 0; i-- {
+		l := r.logs[i]
+		if (filter.Actor != "" && l.Actor != filter.Actor) ||
+			(filter.Action != "" && l.Action != filter.Action) ||
+			(filter.Entity != "" && l.Entity != filter.Entity) ||
+			(filter.EntityName != "" && l.EntityName != filter.EntityName) ||
+			(!filter.Since.IsZero() && l.CreatedAt.Before(filter.Since)) ||
+			(!filter.Until.IsZero() && !l.CreatedAt.Before(filter.Until)) {
+			continue
+		}
+		matched = append(matched, l)
+	}
+	total := int64(len(matched))
+	return pageOf(matched, filter.Offset, filter.Limit), total, nil
+}
+
+// pageOf 按offset/limit截取切片，limit<=0表示不限制
+func pageOf[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// memoryAPIConfigRevisionRepository 基于内存的API配置历史版本存储
+type memoryAPIConfigRevisionRepository struct {
+	mu        sync.RWMutex
+	revisions []model.APIConfigRevision
+}
+
+// NewMemoryAPIConfigRevisionRepository 创建基于内存的API配置历史版本存储
+func NewMemoryAPIConfigRevisionRepository() APIConfigRevisionRepository {
+	return &memoryAPIConfigRevisionRepository{}
+}
+
+// 保存一个版本
+func (r *memoryAPIConfigRevisionRepository) Create(revision *model.APIConfigRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rev := range r.revisions {
+		if rev.APIName == revision.APIName && rev.Version == revision.Version {
+			return fmt.Errorf("版本已存在: %s@%d", revision.APIName, revision.Version)
+		}
+	}
+	revision.ID = uint(len(r.revisions) + 1)
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+	r.revisions = append(r.revisions, *revision)
+	return nil
+}
+
+// 查询某个API的所有版本
+func (r *memoryAPIConfigRevisionRepository) FindByAPI(name string) ([]model.APIConfigRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revisions := []model.APIConfigRevision{}
+	for _, rev := range r.revisions {
+		if rev.APIName == name {
+			revisions = append(revisions, rev)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version > revisions[j].Version })
+	return revisions, nil
+}
+
+// 查询某个API的指定版本
+func (r *memoryAPIConfigRevisionRepository) FindVersion(name string, version int) (*model.APIConfigRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rev := range r.revisions {
+		if rev.APIName == name && rev.Version == version {
+			cp := rev
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// 获取某个API的最新版本号
+func (r *memoryAPIConfigRevisionRepository) LatestVersion(name string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest := 0
+	for _, rev := range r.revisions {
+		if rev.APIName == name && rev.Version > latest {
+			latest = rev.Version
+		}
+	}
+	return latest, nil
+}
+
+// API改名时把历史版本移到新名称下
+func (r *memoryAPIConfigRevisionRepository) Rename(oldName, newName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.revisions {
+		if r.revisions[i].APIName == oldName {
+			r.revisions[i].APIName = newName
+		}
+	}
+	return nil
+}
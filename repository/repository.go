@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+var (
+	// ErrNotFound 记录不存在
+	ErrNotFound = errors.New("记录不存在")
+	// ErrVersionConflict 记录已被其他人修改，版本号不匹配
+	ErrVersionConflict = errors.New("配置已被修改，请刷新后重试")
+)
+
+// APIConfigRepository API配置存储
+type APIConfigRepository interface {
+	// 查询所有api配置
+	FindAll() ([]model.APIConfig, error)
+	// 按条件分页查询api配置，返回当前页和符合条件的总数
+	Find(filter APIConfigFilter) ([]model.APIConfig, int64, error)
+	// 查询单个api配置，不存在时返回ErrNotFound
+	FindByName(name string) (*model.APIConfig, error)
+	// 创建API配置
+	Create(config *model.APIConfig) error
+	// 更新配置，零值字段会被忽略，版本号加1，返回本次更新后的配置；
+	// expectedVersion大于0时校验版本号，不匹配返回ErrVersionConflict，配置不存在时返回ErrNotFound
+	Update(name string, config *model.APIConfig, expectedVersion int) (*model.APIConfig, error)
+	// 按字段更新配置，可以写入零值；版本号和返回值同Update
+	UpdateFields(name string, fields map[string]interface{}, expectedVersion int) (*model.APIConfig, error)
+	// 软删除API配置，版本号加1，返回删除时的配置，不存在时返回ErrNotFound
+	Delete(name string) (*model.APIConfig, error)
+	// 查询已软删除的API配置，不存在时返回ErrNotFound
+	FindDeletedByName(name string) (*model.APIConfig, error)
+	// 恢复已软删除的API配置，版本号加1，返回恢复后的配置，不存在时返回ErrNotFound
+	Restore(name string) (*model.APIConfig, error)
+	// 彻底删除API配置，包括已软删除的记录
+	Purge(name string) error
+	// 查询updated_at不早于指定时间的配置，用于增量刷新缓存
+	FindUpdatedSince(t time.Time) ([]model.APIConfig, error)
+	// 获取API配置总数
+	Count() (int, error)
+	// 获取活跃API配置数量
+	CountActive() (int, error)
+	// 更新API测试状态
+	UpdateTestStatus(name string, status string, testTime time.Time) error
+}
+
+// API配置列表可排序的列
+var APIConfigSortColumns = map[string]bool{
+	"name":           true,
+	"created_at":     true,
+	"updated_at":     true,
+	"last_test_time": true,
+}
+
+// APIConfigFilter API配置查询条件，零值字段不参与过滤
+type APIConfigFilter struct {
+	Query      string // 按名称或描述模糊搜索，不区分大小写
+	Active     *bool
+	TestStatus string
+	Provider   string
+	Deleted    bool   // 为true时只查询已软删除的配置
+	Sort       string // 排序列，见APIConfigSortColumns，默认name
+	Desc       bool
+	Limit      int
+	Offset     int
+}
+
+// APIConfigRevisionRepository API配置历史版本存储
+type APIConfigRevisionRepository interface {
+	// 保存一个版本
+	Create(revision *model.APIConfigRevision) error
+	// 查询某个API的所有版本，按版本号倒序
+	FindByAPI(name string) ([]model.APIConfigRevision, error)
+	// 查询某个API的指定版本，不存在时返回ErrNotFound
+	FindVersion(name string, version int) (*model.APIConfigRevision, error)
+	// 获取某个API的最新版本号，没有历史时返回0
+	LatestVersion(name string) (int, error)
+	// API改名时把历史版本移到新名称下
+	Rename(oldName, newName string) error
+}
+
+// RequestLogRepository 请求日志存储
+type RequestLogRepository interface {
+	// 保存一条请求日志
+	Create(log *model.RequestLog) error
+	// 按API名称查询最近的请求日志，apiName为空时查询全部
+	FindRecent(apiName string, limit int) ([]model.RequestLog, error)
+}
+
+// ConfigChangeRepository 配置变更日志存储
+type ConfigChangeRepository interface {
+	// 追加一条变更，写入后ID即为新版本号
+	Append(change *model.ConfigChange) error
+	// 查询ID大于afterID的变更，按ID升序
+	FindAfter(afterID uint, limit int) ([]model.ConfigChange, error)
+	// 获取最新的变更ID，没有变更时返回0
+	LatestID() (uint, error)
+}
+
+// InstanceRepository 代理实例心跳存储
+type InstanceRepository interface {
+	// 写入或更新实例心跳
+	Upsert(instance *model.Instance) error
+	// 查询所有实例
+	FindAll() ([]model.Instance, error)
+	// 删除最后心跳早于指定时间的实例
+	DeleteSeenBefore(t time.Time) error
+}
+
+// AdminUserRepository 管理员账号存储
+type AdminUserRepository interface {
+	// 查询所有管理员
+	FindAll() ([]model.AdminUser, error)
+	// 按用户名查询，不存在时返回ErrNotFound
+	FindByUsername(username string) (*model.AdminUser, error)
+	// 按ID查询，不存在时返回ErrNotFound
+	FindByID(id uint) (*model.AdminUser, error)
+	// 创建管理员
+	Create(user *model.AdminUser) error
+	// 按字段更新，可以写入零值
+	UpdateFields(username string, fields map[string]interface{}) error
+	// 删除管理员
+	Delete(username string) error
+}
+
+// AdminSessionRepository 管理员会话存储
+type AdminSessionRepository interface {
+	// 创建会话
+	Create(session *model.AdminSession) error
+	// 按ID查询，不存在时返回ErrNotFound
+	FindByID(id string) (*model.AdminSession, error)
+	// 删除会话
+	Delete(id string) error
+	// 删除某个用户的所有会话
+	DeleteByUser(userID uint) error
+	// 删除过期会话
+	DeleteExpired(now time.Time) error
+}
+
+// AuditFilter 审计日志查询条件，零值字段不参与过滤
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	Entity     string
+	EntityName string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditLogRepository 审计日志存储
+type AuditLogRepository interface {
+	// 写入一条审计日志
+	Create(log *model.AuditLog) error
+	// 按条件查询，按时间倒序，同时返回符合条件的总数
+	Find(filter AuditFilter) ([]model.AuditLog, int64, error)
+}
+
+// Store 汇总所有存储，由main创建后注入service层
+type Store struct {
+	APIConfigs    APIConfigRepository
+	RequestLogs   RequestLogRepository
+	ConfigChanges ConfigChangeRepository
+	Instances     InstanceRepository
+	AdminUsers    AdminUserRepository
+	AdminSessions AdminSessionRepository
+	AuditLogs     AuditLogRepository
+	Revisions     APIConfigRevisionRepository
+}
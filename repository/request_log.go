@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"AI-PROXY/model"
+
+	"gorm.io/gorm"
+)
+
+// gormRequestLogRepository 基于GORM的请求日志存储
+type gormRequestLogRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRequestLogRepository 创建基于GORM的请求日志存储
+func NewGormRequestLogRepository(db *gorm.DB) RequestLogRepository {
+	return &gormRequestLogRepository{db: db}
+}
+
+// 保存一条请求日志
+func (r *gormRequestLogRepository) Create(log *model.RequestLog) error {
+	return r.db.Create(log).Error
+}
+
+// 查询最近的请求日志
+func (r *gormRequestLogRepository) FindRecent(apiName string, limit int) ([]model.RequestLog, error) {
+	var logs []model.RequestLog
+	query := r.db.Order("id DESC").Limit(limit)
+	if apiName != "" {
+		query = query.Where("api_name = ?", apiName)
+	}
+	result := query.Find(&logs)
+	return logs, result.Error
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"testing"
+
+	"AI-PROXY/model"
+)
+
+func TestGormRequestLogs(t *testing.T) {
+	repo := newTestStore(t).RequestLogs
+	for _, l := range []model.RequestLog{
+		{APIName: "openai", Path: "/v1/chat/completions", StatusCode: 200},
+		{APIName: "claude", Path: "/v1/messages", StatusCode: 200},
+		{APIName: "openai", Path: "/v1/realtime", StatusCode: 101, RequestMessages: 3, CloseReason: "client"},
+	} {
+		l := l
+		if err := repo.Create(&l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs, err := repo.FindRecent("openai", 10)
+	if err != nil || len(logs) != 2 || logs[0].Path != "/v1/realtime" || logs[0].RequestMessages != 3 || logs[0].CloseReason != "client" {
+		t.Fatalf("FindRecent(openai) = %+v, %v", logs, err)
+	}
+	logs, err = repo.FindRecent("", 2)
+	if err != nil || len(logs) != 2 || logs[0].APIName != "openai" || logs[1].APIName != "claude" {
+		t.Errorf("FindRecent(\"\", 2) = %+v, %v", logs, err)
+	}
+}
@@ -1,28 +1,37 @@
 package router
 
 import (
-	"fmt"
+	"strings"
 
 	"AI-PROXY/controller"
 	"AI-PROXY/middleware"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter() *gin.Engine {
+func SetupRouter(services *service.Services) *gin.Engine {
 	r := gin.New()
 
+	apiConfigController := controller.NewAPIConfigController(services.APIConfig)
+	proxyController := controller.NewProxyController(services.APIConfig, services.RequestLog, nil)
+	systemController := controller.NewSystemController(services.APIConfig, services.Cluster, services.RequestLog)
+	authController := controller.NewAuthController(services.Auth)
+	auditController := controller.NewAuditController(services.Audit)
+
 	r.Use(middleware.CORS())
 	r.Use(middleware.Logger())
 	r.Use(middleware.Recovery())
 
-	fmt.Printf("=== 路由配置开始 ===\n")
-
 	// 首页（普通用户）
 	r.GET("/", func(c *gin.Context) {
 		c.File("./web/home.html")
 	})
 
+	// 健康检查
+	r.GET("/health", systemController.Health)
+
 	// 管理后台页面入口
 	r.GET("/admin", func(c *gin.Context) {
 		c.File("./web/admin.html")
@@ -42,30 +51,72 @@ func SetupRouter() *gin.Engine {
 	r.Static("/admin/assets", "./web/assets")
 	r.Static("/admin/pages", "./web/pages")
 
-	// 管理后台接口路由
+	// 管理员登录（无需认证）
+	r.POST("/admin/login", authController.Login)
+
+	// 管理后台接口路由，按角色分组：viewer只读，operator可修改API配置，admin可管理用户和系统
 	admin := r.Group("/admin")
-	admin.Use(middleware.AdminAuth())
-	admin.GET("/api-config", controller.GetAllAPIConfigs)
-	admin.GET("/api-config/:name", controller.GetAPIConfig)
-	admin.POST("/api-config", controller.CreateAPIConfig)
-	admin.PUT("/api-config/:name", controller.UpdateAPIConfig)
-	admin.DELETE("/api-config/:name", controller.DeleteAPIConfig)
-	admin.POST("/api-config/test", controller.TestAPIConfig)
+	admin.Use(middleware.AdminAuth(services.Auth))
+	admin.POST("/logout", authController.Logout)
+	admin.GET("/me", authController.Me)
+
+	viewer := admin.Group("", middleware.RequireRole(model.RoleViewer))
+	viewer.GET("/api-config", apiConfigController.GetAllAPIConfigs)
+	viewer.GET("/api-config/:name", apiConfigController.GetAPIConfig)
+	viewer.GET("/api-config/:name/history", apiConfigController.GetAPIConfigHistory)
+	viewer.GET("/instances", systemController.GetInstances)
+	viewer.GET("/audit", auditController.GetAuditLogs)
+	viewer.GET("/request-logs", systemController.GetRequestLogs)
+
+	operator := admin.Group("", middleware.RequireRole(model.RoleOperator))
+	operator.POST("/api-config", apiConfigController.CreateAPIConfig)
+	operator.GET("/api-config/export", apiConfigController.ExportAPIConfigs)
+	operator.POST("/api-config/import", apiConfigController.ImportAPIConfigs)
+	operator.PUT("/api-config/:name", apiConfigController.UpdateAPIConfig)
+	operator.PATCH("/api-config/:name", apiConfigController.PatchAPIConfig)
+	operator.DELETE("/api-config/:name", apiConfigController.DeleteAPIConfig)
+	operator.POST("/api-config/test", apiConfigController.TestAPIConfig)
+	operator.POST("/api-config/:name/rollback/:version", apiConfigController.RollbackAPIConfig)
+	operator.POST("/api-config/:name/restore", apiConfigController.RestoreAPIConfig)
+
+	superAdmin := admin.Group("", middleware.RequireRole(model.RoleAdmin))
+	superAdmin.POST("/reload", systemController.ReloadConfig)
+	superAdmin.GET("/users", authController.GetUsers)
+	superAdmin.POST("/users", authController.CreateUser)
+	superAdmin.PUT("/users/:username", authController.UpdateUser)
+	superAdmin.DELETE("/users/:username", authController.DeleteUser)
+
+	// 汇总本地模型服务的模型列表，与代理转发使用相同的限流；未开启proxy.model_list时返回404，
+	// 但路由始终注册，v1始终不能作为API名称
+	rateLimit := middleware.RateLimit()
+	r.GET("/v1/models", rateLimit, proxyController.ListModels)
+
+	// 已注册路由的第一段路径不能作为API名称，否则代理路由无法匹配；
+	// 内置路由在创建service时已登记，这里补充登记新增的路由
+	services.APIConfig.ReserveNames(reservedNames(r.Routes())...)
 
 	// 代理转发路由（必须放在最后）
-	fmt.Printf("注册代理转发路由: /:apiName/*path\n")
-	r.Any("/:apiName/*path", func(c *gin.Context) {
-		fmt.Printf("匹配到代理转发路由: %s\n", c.Request.URL.Path)
-		controller.ForwardRequest(c)
-	})
+	r.Any("/:apiName/*path", rateLimit, proxyController.ForwardRequest)
 
 	// SPA兜底，支持前端路由刷新
 	r.NoRoute(func(c *gin.Context) {
-		fmt.Printf("匹配到NoRoute: %s\n", c.Request.URL.Path)
 		c.File("./web/admin.html")
 	})
 
-	fmt.Printf("=== 路由配置完成 ===\n")
-
 	return r
 }
+
+// reservedNames 返回已注册路由的第一段静态路径，如admin、css、health
+func reservedNames(routes gin.RoutesInfo) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, route := range routes {
+		segment := strings.SplitN(strings.TrimPrefix(route.Path, "/"), "/", 2)[0]
+		if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") || seen[segment] {
+			continue
+		}
+		seen[segment] = true
+		names = append(names, segment)
+	}
+	return names
+}
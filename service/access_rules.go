@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"AI-PROXY/model"
+)
+
+// 所有允许规则都未命中时，拒绝结果中使用的规则名称
+const defaultDenyRuleName = "default-deny"
+
+// 规则中允许使用的请求方法
+var ruleMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// AccessDecision 访问规则的判定结果
+type AccessDecision struct {
+	Allowed bool
+	Rule    string // 命中的规则名称，没有规则命中时为空
+}
+
+// EvaluateAccessRules 按顺序匹配访问规则，第一条命中的规则决定结果；
+// 没有规则命中时，如果存在allow规则则拒绝（白名单模式），否则放行
+func EvaluateAccessRules(rules []model.AccessRule, method, requestPath string) AccessDecision {
+	requestPath = CleanProxyPath(requestPath)
+	hasAllow := false
+	for i, rule := range rules {
+		if rule.Action == model.RuleActionAllow {
+			hasAllow = true
+		}
+		if !ruleMatches(rule, method, requestPath) {
+			continue
+		}
+		return AccessDecision{Allowed: rule.Action == model.RuleActionAllow, Rule: ruleName(rule, i)}
+	}
+	if hasAllow {
+		return AccessDecision{Allowed: false, Rule: defaultDenyRuleName}
+	}
+	return AccessDecision{Allowed: true}
+}
+
+// CleanProxyPath 规范化代理路径，去掉.和..以及重复的/，保留末尾的/，避免绕过路径规则
+func CleanProxyPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func ruleName(rule model.AccessRule, index int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("access_rules[%d]", index)
+}
+
+func ruleMatches(rule model.AccessRule, method, requestPath string) bool {
+	if len(rule.Methods) > 0 {
+		matched := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if matchPathPattern(pattern, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern 按段匹配路径，段内支持path.Match语法，**匹配零个或多个段
+func matchPathPattern(pattern, requestPath string) bool {
+	return matchSegments(splitPath(pattern), splitPath(requestPath))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// validateAccessRules 校验访问规则的动作、方法和路径模式
+func validateAccessRules(rules []model.AccessRule, verr *ValidationError) {
+	for i, rule := range rules {
+		field := fmt.Sprintf("access_rules[%d]", i)
+		if rule.Action != model.RuleActionAllow && rule.Action != model.RuleActionDeny {
+			verr.add(field+".action", "只能是allow或deny")
+		}
+		for _, m := range rule.Methods {
+			if !ruleMethods[strings.ToUpper(m)] {
+				verr.add(field+".methods", "不支持的请求方法: %s", m)
+			}
+		}
+		for _, p := range rule.Paths {
+			if !strings.HasPrefix(p, "/") {
+				verr.add(field+".paths", "路径模式需以/开头: %s", p)
+				continue
+			}
+			for _, segment := range splitPath(p) {
+				if _, err := path.Match(segment, ""); err != nil {
+					verr.add(field+".paths", "路径模式无效: %s", p)
+					break
+				}
+			}
+		}
+	}
+}
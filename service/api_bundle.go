@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"AI-PROXY/model"
+	"AI-PROXY/util"
+)
+
+// 导出时凭据字段的处理方式
+const (
+	SecretsOmit    = "omit"    // 不导出凭据，导入时保留数据库中的原值
+	SecretsEncrypt = "encrypt" // 使用口令加密导出，导入时需要同一口令
+)
+
+// 导入模式
+const (
+	ImportModeMerge   = "merge"   // 创建不存在的API并更新已存在的API，包中没有的API保持不变
+	ImportModeReplace = "replace" // 以导入包为准，额外删除包中没有的API
+)
+
+// 导入导出包的格式版本
+const bundleFormatVersion = 1
+
+// APIConfigBundle API配置导入导出包，每个API为一个字段表，name必填，未出现的字段导入时保持原值
+type APIConfigBundle struct {
+	Version    int                      `json:"version" yaml:"version"`
+	ExportedAt time.Time                `json:"exported_at" yaml:"exported_at"`
+	Secrets    string                   `json:"secrets" yaml:"secrets"`               // 凭据处理方式 omit/encrypt
+	Salt       string                   `json:"salt,omitempty" yaml:"salt,omitempty"` // 加密凭据时派生密钥用的盐值（base64）
+	APIs       []map[string]interface{} `json:"apis" yaml:"apis"`
+}
+
+// 导出所有API配置，secrets为encrypt时用passphrase加密凭据字段
+func (s *APIConfigService) ExportAPIConfigs(secrets, passphrase string) (*APIConfigBundle, error) {
+	if secrets == "" {
+		secrets = SecretsOmit
+	}
+	bundle := &APIConfigBundle{
+		Version:    bundleFormatVersion,
+		ExportedAt: time.Now(),
+		Secrets:    secrets,
+		APIs:       []map[string]interface{}{},
+	}
+
+	var key []byte
+	switch secrets {
+	case SecretsOmit:
+	case SecretsEncrypt:
+		if passphrase == "" {
+			return nil, errors.New("加密导出需要提供口令")
+		}
+		salt := util.NewSalt()
+		var err error
+		if key, err = util.DeriveKey(passphrase, salt); err != nil {
+			return nil, err
+		}
+		bundle.Salt = base64.StdEncoding.EncodeToString(salt)
+	default:
+		return nil, fmt.Errorf("不支持的凭据处理方式: %s", secrets)
+	}
+
+	configs, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	for i := range configs {
+		entry := map[string]interface{}{"name": configs[i].Name}
+		for field, value := range apiConfigFields(&configs[i]) {
+			if !apiConfigSecretFields[field] {
+				entry[field] = value
+				continue
+			}
+			if key == nil {
+				continue
+			}
+			// 数据库中的凭据使用服务端密钥加密，先解密再用导出口令加密
+			stored, _ := value.(string)
+			plaintext, err := OpenSecret(stored)
+			if err != nil {
+				return nil, fmt.Errorf("解密%s的%s失败: %w", configs[i].Name, field, err)
+			}
+			if plaintext == "" {
+				entry[field] = ""
+				continue
+			}
+			if entry[field], err = util.Encrypt(key, plaintext); err != nil {
+				return nil, err
+			}
+		}
+		bundle.APIs = append(bundle.APIs, entry)
+	}
+	return bundle, nil
+}
+
+// 导入API配置，先校验全部条目，有错误时不写库；dryRun为true时只返回将要发生的变更
+func (s *APIConfigService) ImportAPIConfigs(actor Actor, bundle *APIConfigBundle, mode, passphrase string, dryRun bool) (*SyncResult, error) {
+	syncMode := SyncModeUpsert
+	switch mode {
+	case "", ImportModeMerge:
+		mode = ImportModeMerge
+	case ImportModeReplace:
+		syncMode = SyncModeMirror
+	default:
+		return nil, fmt.Errorf("不支持的导入模式: %s", mode)
+	}
+	if bundle.Version > bundleFormatVersion {
+		return nil, fmt.Errorf("不支持的导入包版本: %d", bundle.Version)
+	}
+
+	decrypt := s.bundleDecrypter(bundle, passphrase)
+	result := &SyncResult{Mode: mode, DryRun: dryRun, Changes: []SyncChange{}}
+	entries := make([]apiConfigEntry, 0, len(bundle.APIs))
+	for i, api := range bundle.APIs {
+		entry, err := parseBundleEntry(api, decrypt)
+		if err != nil {
+			name := entry.name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			result.Changes = append(result.Changes, invalidChange(name, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(result.Changes) > 0 {
+		return result, fmt.Errorf("%d个API配置校验失败", len(result.Changes))
+	}
+
+	applied, err := s.applyAPIConfigs(actor, entries, syncMode, dryRun)
+	if applied != nil {
+		applied.Mode = mode
+	}
+	return applied, err
+}
+
+// bundleDecrypter 返回解密凭据字段的函数，派生的密钥在多个条目间复用
+func (s *APIConfigService) bundleDecrypter(bundle *APIConfigBundle, passphrase string) func(string) (string, error) {
+	var key []byte
+	return func(value string) (string, error) {
+		if key == nil {
+			if passphrase == "" {
+				return "", errors.New("导入包中的凭据已加密，需要提供口令")
+			}
+			salt, err := base64.StdEncoding.DecodeString(bundle.Salt)
+			if err != nil || len(salt) == 0 {
+				return "", errors.New("导入包缺少有效的salt")
+			}
+			if key, err = util.DeriveKey(passphrase, salt); err != nil {
+				return "", err
+			}
+		}
+		return util.Decrypt(key, value)
+	}
+}
+
+// parseBundleEntry 解析导入包中的一个API，只允许可编辑字段，加密的值会被解密
+func parseBundleEntry(api map[string]interface{}, decrypt func(string) (string, error)) (apiConfigEntry, error) {
+	name, _ := api["name"].(string)
+	entry := apiConfigEntry{name: name, fields: make(map[string]interface{})}
+	if name == "" {
+		return entry, errors.New("API名称不能为空")
+	}
+	editable := apiConfigFields(&model.APIConfig{})
+	for field, value := range api {
+		if field == "name" {
+			continue
+		}
+		if _, ok := editable[field]; !ok {
+			return entry, fmt.Errorf("字段不可导入: %s", field)
+		}
+		if str, ok := value.(string); ok && util.IsEncrypted(str) {
+			plaintext, err := decrypt(str)
+			if err != nil {
+				return entry, fmt.Errorf("%s: %w", field, err)
+			}
+			value = plaintext
+		}
+		entry.fields[field] = value
+	}
+	return entry, nil
+}
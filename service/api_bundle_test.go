@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+)
+
+// exportTestBundle 在一个新的存储中创建带凭据的API并导出，经过一次JSON序列化
+func exportTestBundle(t *testing.T, secrets, passphrase string) *service.APIConfigBundle {
+	t.Helper()
+	services, _ := newTestServices(t)
+	err := services.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Secret: "sk-secret"})
+	if err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	bundle, err := services.APIConfig.ExportAPIConfigs(secrets, passphrase)
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret") {
+		t.Fatalf("导出包中包含凭据明文: %s", data)
+	}
+	var decoded service.APIConfigBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	return &decoded
+}
+
+func TestExportImportSecrets(t *testing.T) {
+	setTestConfig(t, &config.Config{Auth: config.AuthConfig{EncryptionKey: "test-encryption-key"}})
+	tests := []struct {
+		name       string
+		secrets    string
+		passphrase string // 导入时使用的口令
+		existing   string // 导入前数据库中的凭据，为空表示API不存在
+		wantErr    bool
+		wantSecret string
+	}{
+		{"加密导出后用相同口令导入", service.SecretsEncrypt, "passphrase", "", false, "sk-secret"},
+		{"口令错误", service.SecretsEncrypt, "wrong", "", true, ""},
+		{"缺少口令", service.SecretsEncrypt, "", "", true, ""},
+		{"不导出凭据时保留数据库中的原值", service.SecretsOmit, "", "sk-existing", false, "sk-existing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exportPassphrase := ""
+			if tt.secrets == service.SecretsEncrypt {
+				exportPassphrase = "passphrase"
+			}
+			bundle := exportTestBundle(t, tt.secrets, exportPassphrase)
+
+			services, store := newTestServices(t)
+			if tt.existing != "" {
+				err := services.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://old.example.com", Secret: tt.existing})
+				if err != nil {
+					t.Fatalf("创建失败: %v", err)
+				}
+			}
+			_, err := services.APIConfig.ImportAPIConfigs(testActor, bundle, service.ImportModeMerge, tt.passphrase, false)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("应返回错误")
+				}
+				if configs, _ := store.APIConfigs.FindAll(); len(configs) != 0 {
+					t.Errorf("导入失败时不应写库，实际有%d个API", len(configs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("导入失败: %v", err)
+			}
+			got, err := store.APIConfigs.FindByName("openai")
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if got.BaseURL != "https://api.openai.com" {
+				t.Errorf("base_url = %s", got.BaseURL)
+			}
+			// 数据库中的凭据重新用服务端密钥加密
+			if got.Secret == tt.wantSecret {
+				t.Error("凭据未加密保存")
+			}
+			if plain, err := service.OpenSecret(got.Secret); err != nil || plain != tt.wantSecret {
+				t.Errorf("secret = %q, %v, want %q", plain, err, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestImportAPIConfigsModes(t *testing.T) {
+	bundle := &service.APIConfigBundle{
+		Version: 1,
+		Secrets: service.SecretsOmit,
+		APIs:    []map[string]interface{}{{"name": "openai", "base_url": "https://api.openai.com", "description": "imported"}},
+	}
+	tests := []struct {
+		name      string
+		mode      string
+		dryRun    bool
+		wantNames []string
+	}{
+		{"merge保留包中没有的API", service.ImportModeMerge, false, []string{"legacy", "openai"}},
+		{"replace删除包中没有的API", service.ImportModeReplace, false, []string{"openai"}},
+		{"dry_run不写库", service.ImportModeReplace, true, []string{"legacy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			if err := services.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "legacy", BaseURL: "https://legacy.example.com"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			result, err := services.APIConfig.ImportAPIConfigs(testActor, bundle, tt.mode, "", tt.dryRun)
+			if err != nil {
+				t.Fatalf("导入失败: %v", err)
+			}
+			if result.Mode != tt.mode || result.DryRun != tt.dryRun {
+				t.Errorf("mode = %s, dry_run = %v", result.Mode, result.DryRun)
+			}
+			configs, _ := store.APIConfigs.FindAll()
+			var names []string
+			for _, c := range configs {
+				names = append(names, c.Name)
+			}
+			if !sameNames(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestImportAPIConfigsRejectsUnknownFields(t *testing.T) {
+	services, _ := newTestServices(t)
+	bundle := &service.APIConfigBundle{
+		Version: 1,
+		APIs:    []map[string]interface{}{{"name": "openai", "base_url": "https://api.openai.com", "version": 3}},
+	}
+	result, err := services.APIConfig.ImportAPIConfigs(testActor, bundle, "", "", false)
+	if err == nil {
+		t.Fatal("包含不可导入的字段时应返回错误")
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Action != service.SyncActionError {
+		t.Errorf("changes = %+v", result.Changes)
+	}
+}
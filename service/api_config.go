@@ -1,51 +1,409 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"AI-PROXY/model"
 	"AI-PROXY/repository"
+	"AI-PROXY/util"
 )
 
-// 获取所有API配置
-func GetAllAPIConfigs() ([]model.APIConfig, error) {
-	return repository.GetALLAPIConfig()
+// 审计日志中API配置的实体类型
+const auditEntityAPIConfig = "api_config"
+
+// APIConfigService API配置业务逻辑
+type APIConfigService struct {
+	repo       repository.APIConfigRepository
+	changes    repository.ConfigChangeRepository
+	revisions  repository.APIConfigRevisionRepository
+	audit      *AuditService
+	instanceID string
+	cache      *apiConfigCache
+	reservedMu sync.RWMutex
+	reserved   map[string]bool // 不能作为API名称的保留名，见ReserveNames
+}
+
+// NewAPIConfigService 创建API配置service，store中变更日志、历史版本为空时不记录，audit为空时不写审计日志
+func NewAPIConfigService(store *repository.Store, audit *AuditService, instanceID string) *APIConfigService {
+	s := &APIConfigService{
+		repo:       store.APIConfigs,
+		changes:    store.ConfigChanges,
+		revisions:  store.Revisions,
+		audit:      audit,
+		instanceID: instanceID,
+		cache:      newAPIConfigCache(),
+	}
+	s.ReserveNames(defaultReservedNames...)
+	return s
+}
+
+// APIConfigSummary API配置摘要，用于只需要列表概览的场景
+type APIConfigSummary struct {
+	Name           string `json:"name"`
+	Provider       string `json:"provider"`
+	Active         bool   `json:"active"`
+	LastTestStatus string `json:"last_test_status"`
+}
+
+// 按条件分页查询API配置
+func (s *APIConfigService) FindAPIConfigs(filter repository.APIConfigFilter) ([]model.APIConfig, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.Find(filter)
+}
+
+// SummarizeAPIConfigs 将配置列表转换为摘要
+func SummarizeAPIConfigs(configs []model.APIConfig) []APIConfigSummary {
+	summaries := make([]APIConfigSummary, len(configs))
+	for i, c := range configs {
+		summaries[i] = APIConfigSummary{
+			Name:           c.Name,
+			Provider:       c.Provider,
+			Active:         c.Active,
+			LastTestStatus: c.LastTestStatus,
+		}
+	}
+	return summaries
 }
 
 // 获取单个API配置
-func GetAPIConfigByName(name string) (*model.APIConfig, error) {
+func (s *APIConfigService) GetAPIConfigByName(name string) (*model.APIConfig, error) {
 	if name == "" {
 		return nil, errors.New("API名称不能为空")
 	}
-	return repository.GetAPIConfigByName(name)
+	if config, ok := s.cache.get(name); ok {
+		return config, nil
+	}
+	config, err := s.repo.FindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(config)
+	return config, nil
+}
+
+// 创建API配置，同名的已删除配置会被彻底清除，历史版本保留
+func (s *APIConfigService) CreateAPIConfig(actor Actor, config *model.APIConfig) error {
+	if err := s.validateAPIConfig(config, false); err != nil {
+		return err
+	}
+	if _, err := s.repo.FindDeletedByName(config.Name); err == nil {
+		if err := s.repo.Purge(config.Name); err != nil {
+			return err
+		}
+	}
+	if err := s.create(config); err != nil {
+		return err
+	}
+	return s.committed(actor, AuditActionCreate, nil, config, config)
 }
 
-// 创建API配置
-func CreateAPIConfig(config *model.APIConfig) error {
-	if config.Name == "" || config.BaseURL == "" {
-		return errors.New("API名称和基础url不能为空")
+// create 写入新配置，同名API留有历史版本时版本号接着历史继续，避免与已有的历史版本冲突
+func (s *APIConfigService) create(config *model.APIConfig) error {
+	config.Version = 0
+	if s.revisions != nil {
+		latest, err := s.revisions.LatestVersion(config.Name)
+		if err != nil {
+			return err
+		}
+		if latest > 0 {
+			config.Version = latest + 1
+		}
 	}
-	return repository.CreateAPIConfig(config)
+	return s.repo.Create(config)
 }
 
-// 更新API配置
-func UpdateAPIConfig(name string, config *model.APIConfig) error {
+// 更新API配置，零值字段不修改；expectedVersion大于0时校验版本号
+func (s *APIConfigService) UpdateAPIConfig(actor Actor, name string, config *model.APIConfig, expectedVersion int) error {
 	if name == "" {
 		return errors.New("API名称不能为空")
 	}
-	return repository.UpdateAPIConfig(name, config)
+	before, err := s.repo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	// 零值不修改，未传allow_internal时按现有配置检查出站策略
+	if !config.AllowInternal {
+		config.AllowInternal = before.AllowInternal
+	}
+	if err := s.validateAPIConfig(config, true); err != nil {
+		return err
+	}
+	renamed := config.Name != "" && config.Name != name
+	if renamed {
+		if err := s.checkRenameTarget(config.Name); err != nil {
+			return err
+		}
+	}
+	after, err := s.repo.Update(name, config, expectedVersion)
+	if err != nil {
+		return err
+	}
+	// 历史版本跟随新名称，改名后仍可查看和回滚改名前的版本
+	if renamed && s.revisions != nil {
+		if err := s.revisions.Rename(name, after.Name); err != nil {
+			return fmt.Errorf("迁移历史版本失败: %w", err)
+		}
+	}
+	return s.committedUpdate(actor, before, after)
+}
+
+// checkRenameTarget 改名的目标名称不能留有历史版本（已彻底删除的同名API），否则两者的历史会混在一起
+func (s *APIConfigService) checkRenameTarget(newName string) error {
+	if s.revisions == nil {
+		return nil
+	}
+	latest, err := s.revisions.LatestVersion(newName)
+	if err != nil {
+		return err
+	}
+	if latest > 0 {
+		verr := &ValidationError{}
+		verr.add("name", "%s 已有历史版本（曾被删除的同名API），请换一个名称", newName)
+		return verr
+	}
+	return nil
+}
+
+// 按JSON Merge Patch部分更新API配置，可以把字段设为false或空值；expectedVersion大于0时校验版本号
+func (s *APIConfigService) PatchAPIConfig(actor Actor, name string, patch map[string]interface{}, expectedVersion int) (*model.APIConfig, error) {
+	if name == "" {
+		return nil, errors.New("API名称不能为空")
+	}
+	editable := apiConfigFields(&model.APIConfig{})
+	for key := range patch {
+		if _, ok := editable[key]; !ok {
+			return nil, fmt.Errorf("字段不可修改: %s", key)
+		}
+	}
+
+	before, err := s.repo.FindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	doc, _ := auditSnapshot(before)
+	data, err := json.Marshal(util.MergePatch(doc, patch))
+	if err != nil {
+		return nil, err
+	}
+	var target model.APIConfig
+	if err := json.Unmarshal(data, &target); err != nil {
+		return nil, fmt.Errorf("参数格式错误: %w", err)
+	}
+	if err := s.validateAPIConfig(&target, false); err != nil {
+		return nil, err
+	}
+
+	after, err := s.repo.UpdateFields(name, apiConfigFields(&target), expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.committedUpdate(actor, before, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// 按字段更新API配置，可以写入零值
+func (s *APIConfigService) updateAPIConfigFields(actor Actor, name string, fields map[string]interface{}) error {
+	before, err := s.repo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	after, err := s.repo.UpdateFields(name, fields, 0)
+	if err != nil {
+		return err
+	}
+	return s.committedUpdate(actor, before, after)
+}
+
+// committedUpdate 记录一次更新，只修改了启用状态时记为toggle
+func (s *APIConfigService) committedUpdate(actor Actor, before, after *model.APIConfig) error {
+	action := AuditActionUpdate
+	if changed := changedFields(before, after); len(changed) == 1 && changed[0] == "active" {
+		action = AuditActionToggle
+	}
+	return s.committed(actor, action, before, after, after)
 }
 
-// 删除api配置
-func DeleteAPIConfig(name string) error {
+// 删除api配置（软删除，可通过RestoreAPIConfig恢复）
+func (s *APIConfigService) DeleteAPIConfig(actor Actor, name string) error {
 	if name == "" {
 		return errors.New("API名称不能为空")
 	}
-	return repository.DeleteAPIConfig(name)
+	before, err := s.repo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.Delete(name)
+	if err != nil {
+		return err
+	}
+	return s.committed(actor, AuditActionDelete, before, nil, deleted)
+}
+
+// 恢复已删除的API配置
+func (s *APIConfigService) RestoreAPIConfig(actor Actor, name string) (*model.APIConfig, error) {
+	deleted, err := s.repo.FindDeletedByName(name)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.repo.Restore(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.committed(actor, AuditActionRestore, deleted, after, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// 获取API配置的历史版本，按版本号倒序
+func (s *APIConfigService) GetAPIConfigHistory(name string) ([]model.APIConfigRevision, error) {
+	if name == "" {
+		return nil, errors.New("API名称不能为空")
+	}
+	return s.revisions.FindByAPI(name)
+}
+
+// 回滚API配置到指定版本，已删除的配置会先恢复，已彻底删除的会重新创建，恢复和创建各自记录一个版本；
+// 历史版本按当前的校验规则（保留名、出站策略、加密密钥等）完整校验后才写入
+func (s *APIConfigService) RollbackAPIConfig(actor Actor, name string, version int) (*model.APIConfig, error) {
+	revision, err := s.revisions.FindVersion(name, version)
+	if err != nil {
+		return nil, err
+	}
+	var target model.APIConfig
+	if err := json.Unmarshal([]byte(revision.Snapshot), &target); err != nil {
+		return nil, fmt.Errorf("解析历史版本失败: %w", err)
+	}
+	target.Name = name
+	if err := s.validateAPIConfig(&target, false); err != nil {
+		return nil, err
+	}
+
+	before, err := s.repo.FindByName(name)
+	if errors.Is(err, repository.ErrNotFound) {
+		before, err = s.reviveAPIConfig(actor, name, target.BaseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.repo.UpdateFields(name, apiConfigFields(&target), 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.committed(actor, AuditActionRollback, before, after, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// reviveAPIConfig 回滚前恢复已删除的配置，已彻底删除时按baseURL重新创建
+func (s *APIConfigService) reviveAPIConfig(actor Actor, name, baseURL string) (*model.APIConfig, error) {
+	deleted, err := s.repo.FindDeletedByName(name)
+	if err == nil {
+		restored, err := s.repo.Restore(name)
+		if err != nil {
+			return nil, err
+		}
+		return restored, s.committed(actor, AuditActionRestore, deleted, restored, restored)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	created := &model.APIConfig{Name: name, BaseURL: baseURL}
+	if err := s.create(created); err != nil {
+		return nil, err
+	}
+	return created, s.committed(actor, AuditActionCreate, nil, created, created)
 }
 
 // 更新API测试状态
-func UpdateAPITestStatus(name string, status string, testTime int64) error {
-	return repository.UpdateAPITestStatus(name, status, time.UnixMilli(testTime))
+func (s *APIConfigService) UpdateAPITestStatus(actor Actor, name string, status string, testTime int64) error {
+	before, err := s.repo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdateTestStatus(name, status, time.UnixMilli(testTime)); err != nil {
+		return err
+	}
+	after, err := s.repo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	// 测试状态不属于配置内容，不产生新版本
+	return s.committed(actor, AuditActionTest, before, after, nil)
+}
+
+// apiConfigSecretFields 可编辑字段中属于凭据的字段，导出时省略或加密，变更说明中不输出明文
+var apiConfigSecretFields = map[string]bool{"secret": true}
+
+// apiConfigFields 返回可由管理员编辑、需要随版本回滚的字段
+func apiConfigFields(c *model.APIConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"base_url":         c.BaseURL,
+		"description":      c.Description,
+		"provider":         c.Provider,
+		"active":           c.Active,
+		"allow_internal":   c.AllowInternal,
+		"access_rules":     c.AccessRules,
+		"request_policy":   c.RequestPolicy,
+		"rewrite":          c.Rewrite,
+		"provider_options": c.ProviderOptions,
+		"secret":           c.Secret,
+		"max_body_size":    c.MaxBodySize,
+	}
+}
+
+// committed 配置修改成功后：失效缓存并写变更日志、保存历史版本、写审计日志；
+// revision为本次修改产生的版本对应的配置，删除时为删除时的配置，为nil时不保存历史版本
+func (s *APIConfigService) committed(actor Actor, action string, before, after, revision *model.APIConfig) error {
+	var names []string
+	current := after
+	if before != nil {
+		names = append(names, before.Name)
+	}
+	if after != nil {
+		names = append(names, after.Name)
+	} else {
+		current = before
+	}
+	s.recordChange(action, names...)
+	var err error
+	if revision != nil {
+		err = s.saveRevision(actor, action, revision)
+	}
+	s.audit.Record(actor, action, auditEntityAPIConfig, current.Name, before, after)
+	return err
+}
+
+// saveRevision 保存一个历史版本，版本号与配置的version（即ETag）一致
+func (s *APIConfigService) saveRevision(actor Actor, action string, config *model.APIConfig) error {
+	if s.revisions == nil {
+		return nil
+	}
+	snapshot, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	err = s.revisions.Create(&model.APIConfigRevision{
+		APIName:  config.Name,
+		Version:  config.Version,
+		Action:   action,
+		Actor:    actor.Name,
+		Snapshot: model.JSONText(snapshot),
+	})
+	if err != nil {
+		return fmt.Errorf("保存API配置历史版本失败: %w", err)
+	}
+	return nil
 }
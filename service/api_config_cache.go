@@ -0,0 +1,161 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+// CacheStatus API配置缓存状态，用于健康检查输出
+type CacheStatus struct {
+	Entries     int       `json:"entries"`
+	Stale       bool      `json:"stale"` // 最近一次刷新失败，正在使用旧配置
+	LastRefresh time.Time `json:"last_refresh"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// apiConfigCache API配置读穿缓存，数据库不可用时继续提供最后一次成功加载的配置
+type apiConfigCache struct {
+	mu          sync.RWMutex
+	entries     map[string]model.APIConfig
+	loaded      bool      // 是否完成过一次全量加载
+	lastUpdated time.Time // 已加载配置中最大的updated_at，用于增量刷新
+	lastRefresh time.Time
+	lastError   string
+}
+
+func newAPIConfigCache() *apiConfigCache {
+	return &apiConfigCache{entries: make(map[string]model.APIConfig)}
+}
+
+func (c *apiConfigCache) get(name string) (*model.APIConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	config, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	return &config, true
+}
+
+func (c *apiConfigCache) put(config *model.APIConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[config.Name] = *config
+	if config.UpdatedAt.After(c.lastUpdated) {
+		c.lastUpdated = config.UpdatedAt
+	}
+}
+
+func (c *apiConfigCache) invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		delete(c.entries, name)
+	}
+}
+
+// replace 用全量加载结果替换缓存
+func (c *apiConfigCache) replace(configs []model.APIConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]model.APIConfig, len(configs))
+	c.lastUpdated = time.Time{}
+	for _, config := range configs {
+		c.entries[config.Name] = config
+		if config.UpdatedAt.After(c.lastUpdated) {
+			c.lastUpdated = config.UpdatedAt
+		}
+	}
+	c.loaded = true
+}
+
+// merge 合并增量加载结果
+func (c *apiConfigCache) merge(configs []model.APIConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, config := range configs {
+		c.entries[config.Name] = config
+		if config.UpdatedAt.After(c.lastUpdated) {
+			c.lastUpdated = config.UpdatedAt
+		}
+	}
+}
+
+func (c *apiConfigCache) markRefreshed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRefresh = time.Now()
+	if err != nil {
+		c.lastError = err.Error()
+	} else {
+		c.lastError = ""
+	}
+}
+
+func (c *apiConfigCache) status() CacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CacheStatus{
+		Entries:     len(c.entries),
+		Stale:       c.lastError != "",
+		LastRefresh: c.lastRefresh,
+		Error:       c.lastError,
+	}
+}
+
+// RefreshCache 刷新API配置缓存：首次或数量不一致时全量加载，否则按updated_at增量加载
+func (s *APIConfigService) RefreshCache() error {
+	err := s.refreshCache()
+	s.cache.markRefreshed(err)
+	return err
+}
+
+func (s *APIConfigService) refreshCache() error {
+	s.cache.mu.RLock()
+	loaded, size, since := s.cache.loaded, len(s.cache.entries), s.cache.lastUpdated
+	s.cache.mu.RUnlock()
+
+	count, err := s.repo.Count()
+	if err != nil {
+		return err
+	}
+	// 数量不一致说明有记录被删除或尚未加载，直接全量加载
+	if !loaded || count != size {
+		configs, err := s.repo.FindAll()
+		if err != nil {
+			return err
+		}
+		s.cache.replace(configs)
+		return nil
+	}
+
+	configs, err := s.repo.FindUpdatedSince(since)
+	if err != nil {
+		return err
+	}
+	s.cache.merge(configs)
+	return nil
+}
+
+// StartCacheRefresh 定时刷新API配置缓存，stop关闭后退出
+func (s *APIConfigService) StartCacheRefresh(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.RefreshCache(); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CacheStatus 获取API配置缓存状态
+func (s *APIConfigService) CacheStatus() CacheStatus {
+	return s.cache.status()
+}
@@ -0,0 +1,160 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+)
+
+// flakyAPIConfigRepository 可以模拟数据库不可用的API配置存储
+type flakyAPIConfigRepository struct {
+	repository.APIConfigRepository
+	down bool
+}
+
+var errDatabaseDown = errors.New("数据库不可用")
+
+func (r *flakyAPIConfigRepository) FindByName(name string) (*model.APIConfig, error) {
+	if r.down {
+		return nil, errDatabaseDown
+	}
+	return r.APIConfigRepository.FindByName(name)
+}
+
+func (r *flakyAPIConfigRepository) FindAll() ([]model.APIConfig, error) {
+	if r.down {
+		return nil, errDatabaseDown
+	}
+	return r.APIConfigRepository.FindAll()
+}
+
+func (r *flakyAPIConfigRepository) Count() (int, error) {
+	if r.down {
+		return 0, errDatabaseDown
+	}
+	return r.APIConfigRepository.Count()
+}
+
+func TestAPIConfigCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(t *testing.T, svc *service.APIConfigService, store *repository.Store)
+		refresh  bool   // 变更后是否刷新缓存
+		wantDesc string // 变更后读到的描述，为空表示配置不存在
+	}{
+		{
+			name: "绕过service修改数据库时继续使用缓存",
+			change: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				store.APIConfigs.UpdateFields("openai", map[string]interface{}{"description": "changed"}, 0)
+			},
+			wantDesc: "cached",
+		},
+		{
+			name: "通过service更新时失效缓存",
+			change: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "changed"}, 0); err != nil {
+					t.Fatalf("更新失败: %v", err)
+				}
+			},
+			wantDesc: "changed",
+		},
+		{
+			name: "通过service删除时失效缓存",
+			change: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				if err := svc.DeleteAPIConfig(testActor, "openai"); err != nil {
+					t.Fatalf("删除失败: %v", err)
+				}
+			},
+		},
+		{
+			name: "定时刷新增量加载数据库中的修改",
+			change: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				store.APIConfigs.UpdateFields("openai", map[string]interface{}{"description": "changed"}, 0)
+			},
+			refresh:  true,
+			wantDesc: "changed",
+		},
+		{
+			name: "定时刷新发现记录被删除时全量加载",
+			change: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				store.APIConfigs.Delete("openai")
+			},
+			refresh: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			svc := services.APIConfig
+			if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "cached"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			if err := svc.RefreshCache(); err != nil {
+				t.Fatalf("刷新缓存失败: %v", err)
+			}
+			if _, err := svc.GetAPIConfigByName("openai"); err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+
+			tt.change(t, svc, store)
+			if tt.refresh {
+				if err := svc.RefreshCache(); err != nil {
+					t.Fatalf("刷新缓存失败: %v", err)
+				}
+			}
+			got, err := svc.GetAPIConfigByName("openai")
+			if tt.wantDesc == "" {
+				if !errors.Is(err, service.ErrNotFound) {
+					t.Errorf("err = %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+			if got.Description != tt.wantDesc {
+				t.Errorf("description = %q, want %q", got.Description, tt.wantDesc)
+			}
+		})
+	}
+}
+
+func TestAPIConfigCacheStale(t *testing.T) {
+	store := repository.NewMemoryStore()
+	flaky := &flakyAPIConfigRepository{APIConfigRepository: store.APIConfigs}
+	store.APIConfigs = flaky
+	util.InitLogger(&config.LogConfig{Level: "error"})
+	svc := service.New(store).APIConfig
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := svc.RefreshCache(); err != nil {
+		t.Fatalf("刷新缓存失败: %v", err)
+	}
+
+	flaky.down = true
+	if err := svc.RefreshCache(); err == nil {
+		t.Fatal("数据库不可用时刷新应返回错误")
+	}
+	status := svc.CacheStatus()
+	if !status.Stale || status.Entries != 1 || status.Error == "" {
+		t.Errorf("status = %+v", status)
+	}
+	// 数据库不可用时继续使用最后一次加载的配置
+	if _, err := svc.GetAPIConfigByName("openai"); err != nil {
+		t.Errorf("数据库不可用时应读取缓存: %v", err)
+	}
+
+	flaky.down = false
+	if err := svc.RefreshCache(); err != nil {
+		t.Fatalf("刷新缓存失败: %v", err)
+	}
+	if status := svc.CacheStatus(); status.Stale || status.Error != "" {
+		t.Errorf("恢复后status = %+v", status)
+	}
+}
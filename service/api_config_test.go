@@ -0,0 +1,449 @@
+package service_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+)
+
+func TestAPIConfigRevisions(t *testing.T) {
+	services, _ := newTestServices(t)
+	svc := services.APIConfig
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "v1"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "v2"}, 0); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	if err := svc.UpdateAPITestStatus(testActor, "openai", "success", 1); err != nil {
+		t.Fatalf("更新测试状态失败: %v", err)
+	}
+	if err := svc.DeleteAPIConfig(testActor, "openai"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := svc.RestoreAPIConfig(testActor, "openai"); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+
+	revisions, err := svc.GetAPIConfigHistory("openai")
+	if err != nil {
+		t.Fatalf("查询历史失败: %v", err)
+	}
+	var got []string
+	for _, r := range revisions {
+		got = append(got, r.Action)
+		if r.Version != len(revisions)-len(got)+1 {
+			t.Errorf("%s 的版本号 = %d", r.Action, r.Version)
+		}
+	}
+	// 按版本号倒序，测试状态不产生新版本
+	want := []string{service.AuditActionRestore, service.AuditActionDelete, service.AuditActionUpdate, service.AuditActionCreate}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("actions = %v, want %v", got, want)
+	}
+	// 最新的历史版本号与ETag使用的version一致
+	current, _ := svc.GetAPIConfigByName("openai")
+	if current.Version != revisions[0].Version {
+		t.Errorf("version = %d, 最新历史版本 = %d", current.Version, revisions[0].Version)
+	}
+
+	// 删除后同名重新创建，版本号接着历史继续
+	if err := svc.DeleteAPIConfig(testActor, "openai"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatalf("重新创建失败: %v", err)
+	}
+	revisions, _ = svc.GetAPIConfigHistory("openai")
+	if len(revisions) != 6 || revisions[0].Version != 6 || revisions[0].Action != service.AuditActionCreate {
+		t.Errorf("重新创建后的最新版本 = %+v", revisions[0])
+	}
+}
+
+func TestRenameAPIConfigHistory(t *testing.T) {
+	services, store := newTestServices(t)
+	svc := services.APIConfig
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "v1"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Name: "gpt", Description: "v2"}, 0); err != nil {
+		t.Fatalf("改名失败: %v", err)
+	}
+
+	// 历史版本跟随新名称，旧名称不再有历史，无法回滚出同名的API
+	revisions, _ := svc.GetAPIConfigHistory("gpt")
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[1].Version != 1 {
+		t.Fatalf("新名称的历史 = %+v", revisions)
+	}
+	if old, _ := svc.GetAPIConfigHistory("openai"); len(old) != 0 {
+		t.Errorf("旧名称仍有历史: %+v", old)
+	}
+	if _, err := svc.RollbackAPIConfig(testActor, "openai", 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("回滚旧名称 err = %v", err)
+	}
+	after, err := svc.RollbackAPIConfig(testActor, "gpt", 1)
+	if err != nil || after.Name != "gpt" || after.Description != "v1" {
+		t.Fatalf("回滚改名前的版本: %+v, err = %v", after, err)
+	}
+
+	// 目标名称留有已删除API的历史时拒绝改名
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "legacy", BaseURL: "https://legacy.example.com"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := svc.DeleteAPIConfig(testActor, "legacy"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	store.APIConfigs.Purge("legacy")
+	var verr *service.ValidationError
+	if err := svc.UpdateAPIConfig(testActor, "gpt", &model.APIConfig{Name: "legacy"}, 0); !errors.As(err, &verr) {
+		t.Errorf("改名为有历史的名称 err = %v", err)
+	}
+}
+
+func TestAPIConfigRevisionsConcurrent(t *testing.T) {
+	services, _ := newTestServices(t)
+	svc := services.APIConfig
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: fmt.Sprintf("d%d", i)}, 0)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("并发更新失败: %v", err)
+		}
+	}
+
+	// 每次写入都有对应的历史版本，版本号连续，快照与版本号一致
+	revisions, _ := svc.GetAPIConfigHistory("openai")
+	if len(revisions) != writers+1 {
+		t.Fatalf("历史版本数 = %d, want %d", len(revisions), writers+1)
+	}
+	for i, r := range revisions {
+		var snapshot model.APIConfig
+		json.Unmarshal([]byte(r.Snapshot), &snapshot)
+		if r.Version != writers+1-i || snapshot.Version != r.Version {
+			t.Errorf("第%d个历史版本: version = %d, 快照version = %d", i, r.Version, snapshot.Version)
+		}
+	}
+}
+
+func TestRollbackAPIConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T, svc *service.APIConfigService, store *repository.Store)
+		wantDesc string
+	}{
+		{
+			name:     "回滚已存在的配置",
+			prepare:  func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {},
+			wantDesc: "v1",
+		},
+		{
+			name: "回滚已删除的配置时先恢复",
+			prepare: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				if err := svc.DeleteAPIConfig(testActor, "openai"); err != nil {
+					t.Fatalf("删除失败: %v", err)
+				}
+			},
+			wantDesc: "v1",
+		},
+		{
+			name: "回滚已彻底删除的配置时重新创建",
+			prepare: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				if err := store.APIConfigs.Purge("openai"); err != nil {
+					t.Fatalf("彻底删除失败: %v", err)
+				}
+			},
+			wantDesc: "v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			svc := services.APIConfig
+			if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "v1"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "v2"}, 0); err != nil {
+				t.Fatalf("更新失败: %v", err)
+			}
+			tt.prepare(t, svc, store)
+
+			got, err := svc.RollbackAPIConfig(testActor, "openai", 1)
+			if err != nil {
+				t.Fatalf("回滚失败: %v", err)
+			}
+			if got.Description != tt.wantDesc || got.BaseURL != "https://api.openai.com" {
+				t.Errorf("config = %+v", got)
+			}
+			revisions, _ := svc.GetAPIConfigHistory("openai")
+			if len(revisions) == 0 || revisions[0].Action != service.AuditActionRollback {
+				t.Errorf("最新版本应为rollback: %+v", revisions)
+			}
+		})
+	}
+}
+
+func TestRollbackAPIConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		prepare   func(t *testing.T, svc *service.APIConfigService, store *repository.Store)
+		wantField string
+	}{
+		{
+			name: "历史版本不符合当前校验规则",
+			prepare: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				store.Revisions.Create(&model.APIConfigRevision{
+					APIName:  "openai",
+					Version:  3,
+					Action:   service.AuditActionUpdate,
+					Snapshot: `{"name":"openai","base_url":"ftp://api.openai.com"}`,
+				})
+			},
+			wantField: "base_url",
+		},
+		{
+			name: "重新创建时名称已被保留",
+			prepare: func(t *testing.T, svc *service.APIConfigService, store *repository.Store) {
+				store.APIConfigs.Purge("openai")
+				svc.ReserveNames("openai")
+				store.Revisions.Create(&model.APIConfigRevision{
+					APIName:  "openai",
+					Version:  3,
+					Action:   service.AuditActionUpdate,
+					Snapshot: `{"name":"openai","base_url":"https://api.openai.com"}`,
+				})
+			},
+			wantField: "name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			svc := services.APIConfig
+			if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "v1"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "v2"}, 0); err != nil {
+				t.Fatalf("更新失败: %v", err)
+			}
+			tt.prepare(t, svc, store)
+
+			_, err := svc.RollbackAPIConfig(testActor, "openai", 3)
+			var verr *service.ValidationError
+			if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != tt.wantField {
+				t.Fatalf("err = %v, want %s 校验失败", err, tt.wantField)
+			}
+			// 校验失败时不修改数据库
+			if current, err := store.APIConfigs.FindByName("openai"); err == nil && current.Description != "v2" {
+				t.Errorf("description = %q, want v2", current.Description)
+			}
+			if revisions, _ := svc.GetAPIConfigHistory("openai"); len(revisions) != 3 {
+				t.Errorf("校验失败时不应产生新版本，实际%d个版本", len(revisions))
+			}
+		})
+	}
+}
+
+func TestPatchAPIConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   map[string]interface{}
+		version int    // If-Match中的版本号，0表示不校验
+		wantErr string // 期望的错误信息
+		check   func(t *testing.T, got *model.APIConfig)
+	}{
+		{
+			name:  "可以设为false",
+			patch: map[string]interface{}{"active": false},
+			check: func(t *testing.T, got *model.APIConfig) {
+				if got.Active {
+					t.Error("active应为false")
+				}
+			},
+		},
+		{
+			name:  "null删除字段",
+			patch: map[string]interface{}{"description": nil},
+			check: func(t *testing.T, got *model.APIConfig) {
+				if got.Description != "" {
+					t.Errorf("description = %q", got.Description)
+				}
+			},
+		},
+		{
+			name: "对象递归合并",
+			patch: map[string]interface{}{"rewrite": map[string]interface{}{
+				"request_headers": map[string]interface{}{"set": map[string]interface{}{"X-B": "2", "X-A": nil}},
+			}},
+			check: func(t *testing.T, got *model.APIConfig) {
+				want := map[string]string{"X-B": "2", "X-C": "3"}
+				if !reflect.DeepEqual(got.Rewrite.RequestHeaders.Set, want) {
+					t.Errorf("set = %v, want %v", got.Rewrite.RequestHeaders.Set, want)
+				}
+			},
+		},
+		{
+			name:    "版本号匹配",
+			patch:   map[string]interface{}{"description": "new"},
+			version: 1,
+			check: func(t *testing.T, got *model.APIConfig) {
+				if got.Description != "new" || got.Version != 2 {
+					t.Errorf("description = %q, version = %d", got.Description, got.Version)
+				}
+			},
+		},
+		{
+			name:    "版本号不匹配",
+			patch:   map[string]interface{}{"description": "new"},
+			version: 5,
+			wantErr: service.ErrVersionConflict.Error(),
+		},
+		{
+			name:    "不可修改的字段",
+			patch:   map[string]interface{}{"version": 9},
+			wantErr: "字段不可修改: version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			svc := services.APIConfig
+			err := svc.CreateAPIConfig(testActor, &model.APIConfig{
+				Name:        "openai",
+				BaseURL:     "https://api.openai.com",
+				Description: "old",
+				Rewrite:     model.RewriteRules{RequestHeaders: model.HeaderRewrite{Set: map[string]string{"X-A": "1", "X-C": "3"}}},
+			})
+			if err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+
+			got, err := svc.PatchAPIConfig(testActor, "openai", tt.patch, tt.version)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if current, _ := store.APIConfigs.FindByName("openai"); current.Version != 1 {
+					t.Errorf("失败时不应修改配置，version = %d", current.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("修改失败: %v", err)
+			}
+			tt.check(t, got)
+		})
+	}
+}
+
+func TestUpdateAPIConfigVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		wantErr error
+	}{
+		{"不校验版本号", 0, nil},
+		{"版本号匹配", 2, nil},
+		{"使用过期的版本号", 1, service.ErrVersionConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, _ := newTestServices(t)
+			svc := services.APIConfig
+			if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			// 其他管理员先修改了一次，版本号变为2
+			if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "first"}, 1); err != nil {
+				t.Fatalf("更新失败: %v", err)
+			}
+			err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "second"}, tt.version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindAPIConfigs(t *testing.T) {
+	services, store := newTestServices(t)
+	svc := services.APIConfig
+	for _, c := range []model.APIConfig{
+		{Name: "openai", BaseURL: "https://api.openai.com", Description: "GPT models"},
+		{Name: "claude", BaseURL: "https://api.anthropic.com", Description: "Anthropic"},
+		{Name: "azure-gpt", BaseURL: "https://example.openai.azure.com", Provider: "azure",
+			ProviderOptions: model.ProviderOptions{Azure: &model.AzureOptions{APIVersion: "2024-06-01"}}},
+		{Name: "ollama", BaseURL: "https://ollama.example.com", Provider: "local"},
+		{Name: "retired", BaseURL: "https://retired.example.com"},
+	} {
+		c := c
+		if err := svc.CreateAPIConfig(testActor, &c); err != nil {
+			t.Fatalf("创建%s失败: %v", c.Name, err)
+		}
+	}
+	if err := svc.UpdateAPITestStatus(testActor, "claude", "success", 2000); err != nil {
+		t.Fatalf("更新测试状态失败: %v", err)
+	}
+	if err := svc.UpdateAPITestStatus(testActor, "openai", "fail", 1000); err != nil {
+		t.Fatalf("更新测试状态失败: %v", err)
+	}
+	store.APIConfigs.UpdateFields("ollama", map[string]interface{}{"active": false}, 0)
+	if err := svc.DeleteAPIConfig(testActor, "retired"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	active, inactive := true, false
+	tests := []struct {
+		name      string
+		filter    repository.APIConfigFilter
+		want      []string
+		wantTotal int64
+	}{
+		{"默认按名称排序", repository.APIConfigFilter{}, []string{"azure-gpt", "claude", "ollama", "openai"}, 4},
+		{"按名称或描述搜索不区分大小写", repository.APIConfigFilter{Query: "GPT"}, []string{"azure-gpt", "openai"}, 2},
+		{"按启用状态", repository.APIConfigFilter{Active: &inactive}, []string{"ollama"}, 1},
+		{"按测试状态", repository.APIConfigFilter{TestStatus: "success"}, []string{"claude"}, 1},
+		{"按供应商", repository.APIConfigFilter{Provider: "azure"}, []string{"azure-gpt"}, 1},
+		{"组合条件", repository.APIConfigFilter{Query: "gpt", Active: &active, Provider: "azure"}, []string{"azure-gpt"}, 1},
+		{"只查询已删除的配置", repository.APIConfigFilter{Deleted: true}, []string{"retired"}, 1},
+		{"倒序", repository.APIConfigFilter{Sort: "name", Desc: true}, []string{"openai", "ollama", "claude", "azure-gpt"}, 4},
+		{"未测试的排在最前", repository.APIConfigFilter{Sort: "last_test_time"}, []string{"azure-gpt", "ollama", "openai", "claude"}, 4},
+		{"不在白名单中的排序列按名称排序", repository.APIConfigFilter{Sort: "secret; DROP TABLE api_configs"}, []string{"azure-gpt", "claude", "ollama", "openai"}, 4},
+		{"分页", repository.APIConfigFilter{Limit: 2, Offset: 1}, []string{"claude", "ollama"}, 4},
+		{"负数offset从头开始", repository.APIConfigFilter{Limit: 1, Offset: -1}, []string{"azure-gpt"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, total, err := svc.FindAPIConfigs(tt.filter)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			var names []string
+			for _, c := range configs {
+				names = append(names, c.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) || total != tt.wantTotal {
+				t.Errorf("names = %v, total = %d, want %v, %d", names, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
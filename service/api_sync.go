@@ -0,0 +1,358 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+)
+
+// 同步模式
+const (
+	SyncModeCreate = "create" // 只创建数据库中不存在的API
+	SyncModeUpsert = "upsert" // 创建不存在的API并更新已存在的API
+	SyncModeMirror = "mirror" // 以配置文件为准，额外删除配置文件中没有的API
+)
+
+// ErrSyncNoAPIs 配置文件中没有声明apis时拒绝以mirror模式同步
+var ErrSyncNoAPIs = errors.New("配置文件中没有声明apis，mirror模式不会删除所有API")
+
+// 同步动作
+const (
+	SyncActionCreate    = "create"
+	SyncActionUpdate    = "update"
+	SyncActionDelete    = "delete"
+	SyncActionUnchanged = "unchanged"
+	SyncActionSkip      = "skip"
+	SyncActionError     = "error"
+)
+
+// SyncChange 单个API的同步变更
+type SyncChange struct {
+	Name     string       `json:"name"`
+	Action   string       `json:"action"`
+	Changes  []string     `json:"changes,omitempty"`  // 字段级变更说明，如 base_url: "a" -> "b"
+	Error    string       `json:"error,omitempty"`    // 校验或写入失败的原因
+	Fields   []FieldError `json:"fields,omitempty"`   // 校验失败的字段
+	Warnings []string     `json:"warnings,omitempty"` // 配置文件中被忽略的字段
+}
+
+// invalidChange 校验失败的条目，字段级错误单独列出
+func invalidChange(name string, err error) SyncChange {
+	change := SyncChange{Name: name, Action: SyncActionError, Error: err.Error()}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		change.Fields = verr.Fields
+	}
+	return change
+}
+
+// SyncResult 同步结果
+type SyncResult struct {
+	Mode    string       `json:"mode"`
+	DryRun  bool         `json:"dry_run"`
+	Changes []SyncChange `json:"changes"`
+}
+
+// 将配置文件中的apis同步到数据库，dryRun为true时只计算差异不写库
+func (s *APIConfigService) SyncAPIConfigs(actor Actor, apis map[string]config.APIConfig, mode string, dryRun bool) (*SyncResult, error) {
+	// apis被清空或删除多半是误操作，mirror模式下会删除数据库中的所有API
+	if mode == SyncModeMirror && len(apis) == 0 {
+		return nil, ErrSyncNoAPIs
+	}
+	entries := make([]apiConfigEntry, 0, len(apis))
+	warnings := make(map[string][]string)
+	var invalid []SyncChange
+	for name, api := range apis {
+		want, err := apiFromConfig(name, api)
+		if err != nil {
+			invalid = append(invalid, invalidChange(name, err))
+			continue
+		}
+		if ignored := ignoredConfigFields(api); len(ignored) > 0 {
+			warnings[name] = ignored
+		}
+		entries = append(entries, apiConfigEntry{name: name, fields: apiConfigFields(&want)})
+	}
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Name < invalid[j].Name })
+		return &SyncResult{Mode: mode, DryRun: dryRun, Changes: invalid}, fmt.Errorf("%d个API配置校验失败", len(invalid))
+	}
+
+	result, err := s.applyAPIConfigs(actor, entries, mode, dryRun)
+	if result != nil {
+		for i := range result.Changes {
+			result.Changes[i].Warnings = warnings[result.Changes[i].Name]
+		}
+	}
+	return result, err
+}
+
+// apiConfigEntry 待写入的一个API配置，fields只包含需要设置的字段，未包含的字段保持原值
+type apiConfigEntry struct {
+	name   string
+	fields map[string]interface{}
+}
+
+// applyAPIConfigs 按同步模式将一组API配置写入数据库，先全部校验，有校验失败时不写库；
+// 写入失败的条目记录错误后继续处理其余条目
+func (s *APIConfigService) applyAPIConfigs(actor Actor, entries []apiConfigEntry, mode string, dryRun bool) (*SyncResult, error) {
+	if mode == "" {
+		mode = SyncModeCreate
+	}
+	if mode != SyncModeCreate && mode != SyncModeUpsert && mode != SyncModeMirror {
+		return nil, fmt.Errorf("不支持的同步模式: %s", mode)
+	}
+
+	existing, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]model.APIConfig, len(existing))
+	for _, c := range existing {
+		byName[c.Name] = c
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	result := &SyncResult{Mode: mode, DryRun: dryRun, Changes: []SyncChange{}}
+	wanted := make(map[string]bool, len(entries))
+	targets := make([]model.APIConfig, len(entries))
+	invalid := 0
+	for i, entry := range entries {
+		var have *model.APIConfig
+		if c, ok := byName[entry.name]; ok {
+			have = &c
+		}
+		target, err := mergeAPIConfigFields(entry.name, have, entry.fields)
+		if err == nil && wanted[entry.name] {
+			err = fmt.Errorf("API名称重复: %s", entry.name)
+		}
+		if err == nil {
+			err = s.validateAPIConfig(target, false)
+		}
+		if err != nil {
+			invalid++
+			result.Changes = append(result.Changes, invalidChange(entry.name, err))
+			continue
+		}
+		wanted[entry.name] = true
+		targets[i] = *target
+	}
+	if invalid > 0 {
+		return result, fmt.Errorf("%d个API配置校验失败", invalid)
+	}
+
+	failed := 0
+	for i := range targets {
+		want := &targets[i]
+		have, ok := byName[want.Name]
+		if !ok {
+			change := SyncChange{Name: want.Name, Action: SyncActionCreate}
+			if !dryRun {
+				if err := s.createAPIConfigWithFields(actor, want); err != nil {
+					change.Error = err.Error()
+					failed++
+				}
+			}
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+
+		fields, changes := diffAPIConfig(&have, want)
+		switch {
+		case len(changes) == 0:
+			result.Changes = append(result.Changes, SyncChange{Name: want.Name, Action: SyncActionUnchanged})
+		case mode == SyncModeCreate:
+			result.Changes = append(result.Changes, SyncChange{Name: want.Name, Action: SyncActionSkip, Changes: changes})
+		default:
+			change := SyncChange{Name: want.Name, Action: SyncActionUpdate, Changes: changes}
+			if !dryRun {
+				if err := s.updateAPIConfigFields(actor, want.Name, fields); err != nil {
+					change.Error = err.Error()
+					failed++
+				}
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	if mode == SyncModeMirror {
+		for _, c := range existing {
+			if wanted[c.Name] {
+				continue
+			}
+			change := SyncChange{Name: c.Name, Action: SyncActionDelete}
+			if !dryRun {
+				if err := s.DeleteAPIConfig(actor, c.Name); err != nil {
+					change.Error = err.Error()
+					failed++
+				}
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	if failed > 0 {
+		return result, fmt.Errorf("%d个API配置写入失败", failed)
+	}
+	return result, nil
+}
+
+// createAPIConfigWithFields 创建API配置，active列有默认值，创建时false会被忽略，需要单独写入
+func (s *APIConfigService) createAPIConfigWithFields(actor Actor, config *model.APIConfig) error {
+	active := config.Active
+	if err := s.CreateAPIConfig(actor, config); err != nil {
+		return err
+	}
+	if !active {
+		return s.updateAPIConfigFields(actor, config.Name, map[string]interface{}{"active": false})
+	}
+	return nil
+}
+
+// mergeAPIConfigFields 在现有配置（可以为nil）的基础上覆盖fields，得到期望的配置
+func mergeAPIConfigFields(name string, have *model.APIConfig, fields map[string]interface{}) (*model.APIConfig, error) {
+	doc := map[string]interface{}{"active": true}
+	if have != nil {
+		doc, _ = auditSnapshot(have)
+	}
+	for key, value := range fields {
+		doc[key] = value
+	}
+	doc["name"] = name
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var target model.APIConfig
+	if err := json.Unmarshal(data, &target); err != nil {
+		return nil, fmt.Errorf("参数格式错误: %w", err)
+	}
+	return &target, nil
+}
+
+// 配置文件中auth_type支持的取值
+const (
+	configAuthBearer = "bearer" // Authorization: Bearer <auth_value>
+	configAuthBasic  = "basic"  // Authorization: Basic base64(<auth_value>)，auth_value为user:password
+)
+
+// apiFromConfig 将配置文件中的API定义转换为数据库模型，auth_type和auth_value转换为Authorization请求头，
+// 优先级低于headers和rewrite.request_headers.set中显式设置的请求头
+func apiFromConfig(name string, api config.APIConfig) (model.APIConfig, error) {
+	active := true
+	if api.Active != nil {
+		active = *api.Active
+	}
+	auth, err := configAuthHeader(api.AuthType, api.AuthValue)
+	if err != nil {
+		verr := &ValidationError{}
+		verr.add("auth_type", "%s", err.Error())
+		return model.APIConfig{}, verr
+	}
+	rewrite := api.Rewrite
+	if len(api.Headers) > 0 || auth != "" {
+		set := make(map[string]string, len(api.Headers)+len(rewrite.RequestHeaders.Set)+1)
+		if auth != "" {
+			set["Authorization"] = auth
+		}
+		for k, v := range api.Headers {
+			set[k] = v
+		}
+		for k, v := range rewrite.RequestHeaders.Set {
+			set[k] = v
+		}
+		rewrite.RequestHeaders.Set = set
+	}
+	return model.APIConfig{
+		Name:            name,
+		BaseURL:         api.BaseURL,
+		Description:     api.Description,
+		Provider:        api.Provider,
+		Active:          active,
+		AllowInternal:   api.AllowInternal,
+		AccessRules:     api.AccessRules,
+		RequestPolicy:   api.RequestPolicy,
+		Rewrite:         rewrite,
+		ProviderOptions: api.ProviderOptions,
+		Secret:          api.Secret,
+		MaxBodySize:     api.MaxBodySize,
+	}, nil
+}
+
+// configAuthHeader 按auth_type生成Authorization请求头的值，auth_type为空时返回空字符串
+func configAuthHeader(authType, authValue string) (string, error) {
+	switch strings.ToLower(authType) {
+	case "":
+		if authValue != "" {
+			return "", errors.New("设置auth_value时需同时设置auth_type")
+		}
+		return "", nil
+	case configAuthBearer:
+		if authValue == "" {
+			return "", errors.New("auth_value不能为空")
+		}
+		return "Bearer " + authValue, nil
+	case configAuthBasic:
+		if !strings.Contains(authValue, ":") {
+			return "", errors.New("auth_value需为user:password格式")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(authValue)), nil
+	default:
+		return "", fmt.Errorf("不支持的auth_type: %s，可选bearer/basic", authType)
+	}
+}
+
+// ignoredConfigFields 返回配置文件中已不再支持、同步时被忽略的字段
+func ignoredConfigFields(api config.APIConfig) []string {
+	var ignored []string
+	if api.Timeout != 0 {
+		ignored = append(ignored, "timeout已不再支持，同步时被忽略")
+	}
+	if api.RateLimit != 0 {
+		ignored = append(ignored, "rate_limit已不再支持，请使用全局的rate_limit配置")
+	}
+	return ignored
+}
+
+// diffAPIConfig 比较数据库中的配置和期望配置的可编辑字段，返回需要更新的列和变更说明，凭据字段不输出明文
+func diffAPIConfig(have, want *model.APIConfig) (map[string]interface{}, []string) {
+	haveFields, wantFields := apiConfigFields(have), apiConfigFields(want)
+	keys := make([]string, 0, len(wantFields))
+	for key := range wantFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make(map[string]interface{})
+	var changes []string
+	for _, key := range keys {
+		// 按JSON表示比较，空列表和nil视为相同
+		haveJSON, _ := json.Marshal(haveFields[key])
+		wantJSON, _ := json.Marshal(wantFields[key])
+		if string(haveJSON) == string(wantJSON) || apiConfigSecretFields[key] && sameSecret(haveFields[key], wantFields[key]) {
+			continue
+		}
+		fields[key] = wantFields[key]
+		if apiConfigSecretFields[key] {
+			changes = append(changes, key+": (已修改)")
+		} else {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, haveJSON, wantJSON))
+		}
+	}
+	return fields, changes
+}
+
+// sameSecret 比较两个凭据的明文，加密时使用随机nonce，密文不同不代表内容不同
+func sameSecret(a, b interface{}) bool {
+	as, _ := a.(string)
+	bs, _ := b.(string)
+	ap, errA := OpenSecret(as)
+	bp, errB := OpenSecret(bs)
+	return errA == nil && errB == nil && ap == bp
+}
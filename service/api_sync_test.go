@@ -0,0 +1,206 @@
+package service_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+)
+
+func TestSyncAPIConfigs(t *testing.T) {
+	inactive := false
+	apis := map[string]config.APIConfig{
+		"openai": {BaseURL: "https://api.openai.com/v1"},
+		"claude": {BaseURL: "https://api.anthropic.com", Description: "new", Active: &inactive},
+	}
+	tests := []struct {
+		name        string
+		mode        string
+		dryRun      bool
+		wantActions map[string]string
+		wantNames   []string // 同步后数据库中的API
+		wantDesc    string   // 同步后claude的描述
+	}{
+		{
+			name:        "create只创建不存在的API",
+			mode:        service.SyncModeCreate,
+			wantActions: map[string]string{"openai": service.SyncActionCreate, "claude": service.SyncActionSkip},
+			wantNames:   []string{"claude", "legacy", "openai"},
+			wantDesc:    "old",
+		},
+		{
+			name:        "upsert更新已存在的API",
+			mode:        service.SyncModeUpsert,
+			wantActions: map[string]string{"openai": service.SyncActionCreate, "claude": service.SyncActionUpdate},
+			wantNames:   []string{"claude", "legacy", "openai"},
+			wantDesc:    "new",
+		},
+		{
+			name:        "mirror删除配置文件中没有的API",
+			mode:        service.SyncModeMirror,
+			wantActions: map[string]string{"openai": service.SyncActionCreate, "claude": service.SyncActionUpdate, "legacy": service.SyncActionDelete},
+			wantNames:   []string{"claude", "openai"},
+			wantDesc:    "new",
+		},
+		{
+			name:        "dry_run只计算差异",
+			mode:        service.SyncModeMirror,
+			dryRun:      true,
+			wantActions: map[string]string{"openai": service.SyncActionCreate, "claude": service.SyncActionUpdate, "legacy": service.SyncActionDelete},
+			wantNames:   []string{"claude", "legacy"},
+			wantDesc:    "old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			svc := services.APIConfig
+			for _, c := range []model.APIConfig{
+				{Name: "claude", BaseURL: "https://api.anthropic.com", Description: "old"},
+				{Name: "legacy", BaseURL: "https://legacy.example.com"},
+			} {
+				c := c
+				if err := svc.CreateAPIConfig(testActor, &c); err != nil {
+					t.Fatalf("创建API配置失败: %v", err)
+				}
+			}
+
+			result, err := svc.SyncAPIConfigs(testActor, apis, tt.mode, tt.dryRun)
+			if err != nil {
+				t.Fatalf("同步失败: %v", err)
+			}
+			actions := make(map[string]string)
+			for _, change := range result.Changes {
+				actions[change.Name] = change.Action
+			}
+			if !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", actions, tt.wantActions)
+			}
+
+			configs, _ := store.APIConfigs.FindAll()
+			var names []string
+			for _, c := range configs {
+				names = append(names, c.Name)
+			}
+			if !sameNames(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+			claude, err := store.APIConfigs.FindByName("claude")
+			if err != nil {
+				t.Fatalf("查询claude失败: %v", err)
+			}
+			if claude.Description != tt.wantDesc {
+				t.Errorf("description = %q, want %q", claude.Description, tt.wantDesc)
+			}
+			if tt.wantDesc == "new" && claude.Active {
+				t.Error("active: false 未同步到数据库")
+			}
+		})
+	}
+}
+
+func TestSyncAPIConfigsInvalid(t *testing.T) {
+	services, store := newTestServices(t)
+	apis := map[string]config.APIConfig{
+		"openai": {BaseURL: "https://api.openai.com/v1"},
+		"broken": {BaseURL: "ftp://example.com"},
+	}
+	result, err := services.APIConfig.SyncAPIConfigs(testActor, apis, service.SyncModeUpsert, false)
+	if err == nil {
+		t.Fatal("存在校验失败的API时应返回错误")
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Name != "broken" || result.Changes[0].Action != service.SyncActionError {
+		t.Fatalf("changes = %+v", result.Changes)
+	}
+	if len(result.Changes[0].Fields) != 1 || result.Changes[0].Fields[0].Field != "base_url" {
+		t.Errorf("fields = %+v", result.Changes[0].Fields)
+	}
+	// 有校验失败时整体不写库
+	if configs, _ := store.APIConfigs.FindAll(); len(configs) != 0 {
+		t.Errorf("校验失败时不应写库，实际有%d个API", len(configs))
+	}
+}
+
+func TestSyncAPIConfigsUnknownMode(t *testing.T) {
+	services, _ := newTestServices(t)
+	if _, err := services.APIConfig.SyncAPIConfigs(testActor, nil, "replace", false); err == nil {
+		t.Error("不支持的同步模式应返回错误")
+	}
+}
+
+func TestSyncAPIConfigsAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		api          config.APIConfig
+		wantAuth     string
+		wantErr      bool
+		wantWarnings int
+	}{
+		{"bearer", config.APIConfig{AuthType: "bearer", AuthValue: "sk-upstream"}, "Bearer sk-upstream", false, 0},
+		{"basic", config.APIConfig{AuthType: "Basic", AuthValue: "user:pass"}, "Basic dXNlcjpwYXNz", false, 0},
+		{"headers优先", config.APIConfig{AuthType: "bearer", AuthValue: "sk-upstream", Headers: map[string]string{"Authorization": "Bearer sk-header"}}, "Bearer sk-header", false, 0},
+		{"不支持的auth_type", config.APIConfig{AuthType: "digest", AuthValue: "x"}, "", true, 0},
+		{"缺少auth_type", config.APIConfig{AuthValue: "sk-upstream"}, "", true, 0},
+		{"忽略timeout和rate_limit", config.APIConfig{Timeout: 30, RateLimit: 10}, "", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, store := newTestServices(t)
+			api := tt.api
+			api.BaseURL = "https://api.openai.com"
+			result, err := services.APIConfig.SyncAPIConfigs(testActor, map[string]config.APIConfig{"openai": api}, service.SyncModeCreate, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(result.Changes) != 1 || len(result.Changes[0].Warnings) != tt.wantWarnings {
+				t.Errorf("changes = %+v", result.Changes)
+			}
+			got, err := store.APIConfigs.FindByName("openai")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("校验失败时不应写入数据库")
+				}
+				return
+			}
+			if got.Rewrite.RequestHeaders.Set["Authorization"] != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got.Rewrite.RequestHeaders.Set["Authorization"], tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestSyncAPIConfigsMirrorEmpty(t *testing.T) {
+	services, store := newTestServices(t)
+	if err := services.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatalf("创建API配置失败: %v", err)
+	}
+	for _, apis := range []map[string]config.APIConfig{nil, {}} {
+		if _, err := services.APIConfig.SyncAPIConfigs(testActor, apis, service.SyncModeMirror, false); !errors.Is(err, service.ErrSyncNoAPIs) {
+			t.Errorf("err = %v, want ErrSyncNoAPIs", err)
+		}
+	}
+	if _, err := store.APIConfigs.FindByName("openai"); err != nil {
+		t.Errorf("apis为空时不应删除已有的API: %v", err)
+	}
+}
+
+// sameNames 比较两个名称列表，忽略顺序
+func sameNames(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, name := range got {
+		seen[name]++
+	}
+	for _, name := range want {
+		if seen[name] == 0 {
+			return false
+		}
+		seen[name]--
+	}
+	return true
+}
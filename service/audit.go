@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/util"
+)
+
+// 审计动作
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionDelete   = "delete"
+	AuditActionTest     = "test"
+	AuditActionToggle   = "toggle"
+	AuditActionRestore  = "restore"
+	AuditActionRollback = "rollback"
+)
+
+// 计算差异时忽略的字段，版本号每次修改都会变化，不属于配置内容
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"version":    true,
+}
+
+// Actor 发起操作的管理员
+type Actor struct {
+	Name string
+	IP   string
+}
+
+// SystemActor 系统自动发起的操作，如配置文件同步
+func SystemActor(name string) Actor {
+	return Actor{Name: name}
+}
+
+// AuditService 审计日志
+type AuditService struct {
+	repo repository.AuditLogRepository
+}
+
+// NewAuditService 创建审计日志service
+func NewAuditService(repo repository.AuditLogRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record 记录一次操作，before/after为操作前后的对象，创建时before为nil，删除时after为nil
+func (s *AuditService) Record(actor Actor, action, entity, name string, before, after interface{}) {
+	if s == nil || s.repo == nil {
+		return
+	}
+	beforeMap, beforeJSON := auditSnapshot(before)
+	afterMap, afterJSON := auditSnapshot(after)
+
+	diff := make(map[string]map[string]interface{})
+	for _, key := range diffKeys(beforeMap, afterMap) {
+		diff[key] = map[string]interface{}{"before": beforeMap[key], "after": afterMap[key]}
+	}
+	diffJSON, _ := json.Marshal(diff)
+
+	err := s.repo.Create(&model.AuditLog{
+		Actor:      actor.Name,
+		ClientIP:   actor.IP,
+		Action:     action,
+		Entity:     entity,
+		EntityName: name,
+		Before:     model.JSONText(beforeJSON),
+		After:      model.JSONText(afterJSON),
+		Diff:       model.JSONText(diffJSON),
+	})
+	if err != nil {
+		util.Logger.Warnf("写入审计日志失败: %v", err)
+	}
+}
+
+// 查询审计日志
+func (s *AuditService) Find(filter repository.AuditFilter) ([]model.AuditLog, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.Find(filter)
+}
+
+// auditSnapshot 将对象序列化为JSON，并解析为map用于计算差异
+func auditSnapshot(v interface{}) (map[string]interface{}, string) {
+	if isNil(v) {
+		return map[string]interface{}{}, ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{}, ""
+	}
+	m := make(map[string]interface{})
+	json.Unmarshal(data, &m)
+	return m, string(data)
+}
+
+// changedFields 返回两个对象JSON表示中值不同的字段
+func changedFields(before, after interface{}) []string {
+	beforeMap, _ := auditSnapshot(before)
+	afterMap, _ := auditSnapshot(after)
+	return diffKeys(beforeMap, afterMap)
+}
+
+func diffKeys(a, b map[string]interface{}) []string {
+	var keys []string
+	for k := range a {
+		if !auditIgnoredFields[k] && !reflect.DeepEqual(a[k], b[k]) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok && !auditIgnoredFields[k] && b[k] != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
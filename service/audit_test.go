@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+)
+
+func TestAuditFind(t *testing.T) {
+	services, _ := newTestServices(t)
+	alice := service.Actor{Name: "alice", IP: "10.0.0.1"}
+	bob := service.Actor{Name: "bob", IP: "10.0.0.2"}
+	start := time.Now()
+	svc := services.APIConfig
+	steps := []func() error{
+		func() error {
+			return svc.CreateAPIConfig(alice, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"})
+		},
+		func() error {
+			return svc.CreateAPIConfig(bob, &model.APIConfig{Name: "claude", BaseURL: "https://api.anthropic.com"})
+		},
+		func() error {
+			return svc.UpdateAPIConfig(alice, "openai", &model.APIConfig{Description: "changed"}, 0)
+		},
+		func() error {
+			_, err := svc.PatchAPIConfig(alice, "openai", map[string]interface{}{"active": false}, 0)
+			return err
+		},
+		func() error { return svc.DeleteAPIConfig(bob, "claude") },
+		func() error {
+			_, err := services.Auth.CreateUser(bob, "carol", "carol-password", model.RoleViewer)
+			return err
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("第%d步失败: %v", i+1, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		filter     repository.AuditFilter
+		wantTotal  int64
+		wantFirst  string // 第一条（最新）记录的动作
+		wantLength int
+	}{
+		{"不过滤按时间倒序", repository.AuditFilter{}, 6, service.AuditActionCreate, 6},
+		{"按操作者", repository.AuditFilter{Actor: "alice"}, 3, service.AuditActionToggle, 3},
+		{"按动作", repository.AuditFilter{Action: service.AuditActionCreate}, 3, service.AuditActionCreate, 3},
+		{"按实体类型", repository.AuditFilter{Entity: "admin_user"}, 1, service.AuditActionCreate, 1},
+		{"按实体名称", repository.AuditFilter{EntityName: "claude"}, 2, service.AuditActionDelete, 2},
+		{"组合条件", repository.AuditFilter{Actor: "alice", Action: service.AuditActionUpdate}, 1, service.AuditActionUpdate, 1},
+		{"起始时间之后没有记录", repository.AuditFilter{Since: time.Now().Add(time.Minute)}, 0, "", 0},
+		{"截止时间之前没有记录", repository.AuditFilter{Until: start.Add(-time.Minute)}, 0, "", 0},
+		{"分页", repository.AuditFilter{Limit: 2, Offset: 1}, 6, service.AuditActionDelete, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, total, err := services.Audit.Find(tt.filter)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if total != tt.wantTotal || len(logs) != tt.wantLength {
+				t.Fatalf("total = %d, len = %d, want %d, %d", total, len(logs), tt.wantTotal, tt.wantLength)
+			}
+			if len(logs) > 0 && logs[0].Action != tt.wantFirst {
+				t.Errorf("第一条记录的动作 = %s, want %s", logs[0].Action, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	services, _ := newTestServices(t)
+	svc := services.APIConfig
+	if err := svc.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "old"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := svc.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "new"}, 0); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+
+	logs, _, err := services.Audit.Find(repository.AuditFilter{Action: service.AuditActionUpdate})
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("查询失败: %v, %d条", err, len(logs))
+	}
+	log := logs[0]
+	if log.Actor != testActor.Name || log.ClientIP != testActor.IP || log.EntityName != "openai" {
+		t.Errorf("log = %+v", log)
+	}
+	var diff map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(log.Diff), &diff); err != nil {
+		t.Fatalf("解析diff失败: %v", err)
+	}
+	if d := diff["description"]; d["before"] != "old" || d["after"] != "new" {
+		t.Errorf("description diff = %v", d)
+	}
+	// 时间戳不计入差异
+	if _, ok := diff["updated_at"]; ok {
+		t.Errorf("diff不应包含updated_at: %v", diff)
+	}
+}
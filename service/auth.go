@@ -0,0 +1,367 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 审计日志中管理员账号的实体类型
+const auditEntityAdminUser = "admin_user"
+
+// 静态令牌登录时使用的操作者名称
+const BreakGlassActor = "token"
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrInvalidToken       = errors.New("Token无效")
+	ErrTokenExpired       = errors.New("Token已过期")
+	ErrLoginLocked        = errors.New("登录失败次数过多，请稍后再试")
+	ErrLastAdmin          = errors.New("至少需要保留一个启用的admin账号")
+)
+
+// roleLevels 角色等级，等级高的角色拥有等级低的角色的全部权限
+var roleLevels = map[string]int{
+	model.RoleViewer:   1,
+	model.RoleOperator: 2,
+	model.RoleAdmin:    3,
+}
+
+// ValidRole 判断角色是否有效
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleAllows 判断角色是否满足最低角色要求
+func RoleAllows(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required] && roleLevels[required] > 0
+}
+
+// Principal 已认证的管理员身份
+type Principal struct {
+	UserID     uint   `json:"user_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	SessionID  string `json:"-"`
+	BreakGlass bool   `json:"break_glass"` // 是否通过静态令牌认证
+}
+
+// LoginResult 登录结果
+type LoginResult struct {
+	Token     string           `json:"token"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	User      *model.AdminUser `json:"user"`
+}
+
+// sessionClaims 会话令牌中签名的内容
+type sessionClaims struct {
+	SessionID string `json:"sid"`
+	UserID    uint   `json:"uid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// AuthService 管理员认证与账号管理
+type AuthService struct {
+	users    repository.AdminUserRepository
+	sessions repository.AdminSessionRepository
+	audit    *AuditService
+	// 未配置session_secret时使用的随机密钥，进程重启后会话失效
+	fallbackSecret []byte
+	// 用户不存在时也执行一次bcrypt比较，避免通过响应时间探测用户名
+	dummyHash []byte
+	throttle  *loginThrottle
+}
+
+// NewAuthService 创建认证service
+func NewAuthService(users repository.AdminUserRepository, sessions repository.AdminSessionRepository, audit *AuditService) *AuthService {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return &AuthService{
+		users:          users,
+		sessions:       sessions,
+		audit:          audit,
+		fallbackSecret: secret,
+		dummyHash:      dummyHash,
+		throttle:       newLoginThrottle(),
+	}
+}
+
+// Login 校验用户名密码并签发会话令牌，同一用户名连续失败多次后锁定一段时间
+func (s *AuthService) Login(username, password, clientIP string) (*LoginResult, error) {
+	if s.throttle.locked(username, time.Now()) {
+		return nil, ErrLoginLocked
+	}
+	user, err := s.users.FindByUsername(username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if user == nil {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		s.throttle.fail(username, time.Now())
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil || !user.Active {
+		s.throttle.fail(username, time.Now())
+		return nil, ErrInvalidCredentials
+	}
+	s.throttle.reset(username)
+
+	now := time.Now()
+	session := &model.AdminSession{
+		ID:        randomHex(16),
+		UserID:    user.ID,
+		ClientIP:  clientIP,
+		ExpiresAt: now.Add(sessionTTL()),
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+	s.users.UpdateFields(user.Username, map[string]interface{}{"last_login_at": now})
+	s.sessions.DeleteExpired(now)
+
+	token, err := s.sign(sessionClaims{SessionID: session.ID, UserID: user.ID, ExpiresAt: session.ExpiresAt.Unix()})
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token, ExpiresAt: session.ExpiresAt, User: user}, nil
+}
+
+// Logout 注销会话，静态令牌无需注销
+func (s *AuthService) Logout(p *Principal) error {
+	if p == nil || p.SessionID == "" {
+		return nil
+	}
+	return s.sessions.Delete(p.SessionID)
+}
+
+// Authenticate 校验Bearer令牌：先匹配静态令牌，再校验会话令牌签名、有效期和账号状态
+func (s *AuthService) Authenticate(token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	if cfg := config.Get(); cfg != nil && cfg.Auth.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Auth.Token)) == 1 {
+		return &Principal{Username: BreakGlassActor, Role: model.RoleAdmin, BreakGlass: true}, nil
+	}
+
+	claims, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	session, err := s.sessions.FindByID(claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != claims.UserID || time.Now().After(session.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	user, err := s.users.FindByID(session.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{UserID: user.ID, Username: user.Username, Role: user.Role, SessionID: session.ID}, nil
+}
+
+// sign 生成令牌：base64(claims).base64(HMAC-SHA256)
+func (s *AuthService) sign(claims sessionClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// verify 校验令牌签名并解析内容
+func (s *AuthService) verify(token string) (*sessionClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(encoded)) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+func (s *AuthService) mac(data string) []byte {
+	secret := s.fallbackSecret
+	if cfg := config.Get(); cfg != nil && cfg.Auth.SessionSecret != "" {
+		secret = []byte(cfg.Auth.SessionSecret)
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sessionTTL() time.Duration {
+	if cfg := config.Get(); cfg != nil && cfg.Auth.SessionTTL > 0 {
+		return time.Duration(cfg.Auth.SessionTTL) * time.Minute
+	}
+	return 12 * time.Hour
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 获取所有管理员
+func (s *AuthService) ListUsers() ([]model.AdminUser, error) {
+	return s.users.FindAll()
+}
+
+// 创建管理员
+func (s *AuthService) CreateUser(actor Actor, username, password, role string) (*model.AdminUser, error) {
+	if username == "" || password == "" {
+		return nil, errors.New("用户名和密码不能为空")
+	}
+	if len(password) < 8 {
+		return nil, errors.New("密码长度不能少于8位")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("无效的角色: %s", role)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.AdminUser{Username: username, PasswordHash: string(hash), Role: role, Active: true}
+	if err := s.users.Create(user); err != nil {
+		return nil, err
+	}
+	s.audit.Record(actor, AuditActionCreate, auditEntityAdminUser, username, nil, user)
+	return user, nil
+}
+
+// UserUpdate 管理员账号修改内容，nil字段不修改
+type UserUpdate struct {
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	Active   *bool   `json:"active"`
+}
+
+// 修改管理员，修改密码、角色或禁用账号后注销其所有会话
+func (s *AuthService) UpdateUser(actor Actor, username string, update *UserUpdate) (*model.AdminUser, error) {
+	user, err := s.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if update.Password != nil {
+		if len(*update.Password) < 8 {
+			return nil, errors.New("密码长度不能少于8位")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		fields["password_hash"] = string(hash)
+	}
+	if update.Role != nil {
+		if !ValidRole(*update.Role) {
+			return nil, fmt.Errorf("无效的角色: %s", *update.Role)
+		}
+		fields["role"] = *update.Role
+	}
+	if update.Active != nil {
+		fields["active"] = *update.Active
+	}
+	if len(fields) == 0 {
+		return user, nil
+	}
+	demoted := update.Role != nil && *update.Role != model.RoleAdmin
+	disabled := update.Active != nil && !*update.Active
+	if demoted || disabled {
+		if err := s.checkLastAdmin(user); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.users.UpdateFields(username, fields); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	after, err := s.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(actor, AuditActionUpdate, auditEntityAdminUser, username, user, after)
+	return after, nil
+}
+
+// 删除管理员并注销其所有会话
+func (s *AuthService) DeleteUser(actor Actor, username string) error {
+	user, err := s.users.FindByUsername(username)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLastAdmin(user); err != nil {
+		return err
+	}
+	if err := s.sessions.DeleteByUser(user.ID); err != nil {
+		return err
+	}
+	if err := s.users.Delete(username); err != nil {
+		return err
+	}
+	s.audit.Record(actor, AuditActionDelete, auditEntityAdminUser, username, user, nil)
+	return nil
+}
+
+// checkLastAdmin 禁用、降级或删除启用的admin账号前检查是否还有其他启用的admin，
+// 避免只能通过静态令牌恢复管理
+func (s *AuthService) checkLastAdmin(user *model.AdminUser) error {
+	if user.Role != model.RoleAdmin || !user.Active {
+		return nil
+	}
+	users, err := s.users.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.ID != user.ID && u.Role == model.RoleAdmin && u.Active {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
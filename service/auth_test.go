@@ -0,0 +1,239 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+)
+
+const testPassword = "correct-password"
+
+// newTestAuth 创建认证service和一组管理员
+func newTestAuth(t *testing.T, store *repository.Store, users map[string]string) *service.AuthService {
+	t.Helper()
+	util.InitLogger(&config.LogConfig{Level: "error"})
+	auth := service.New(store).Auth
+	for username, role := range users {
+		if _, err := auth.CreateUser(testActor, username, testPassword, role); err != nil {
+			t.Fatalf("创建管理员失败: %v", err)
+		}
+	}
+	return auth
+}
+
+func TestLogin(t *testing.T) {
+	store := repository.NewMemoryStore()
+	auth := newTestAuth(t, store, map[string]string{"alice": model.RoleAdmin, "bob": model.RoleViewer})
+	store.AdminUsers.UpdateFields("bob", map[string]interface{}{"active": false})
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{"密码正确", "alice", testPassword, nil},
+		{"密码错误", "alice", "wrong-password", service.ErrInvalidCredentials},
+		{"用户不存在", "nobody", testPassword, service.ErrInvalidCredentials},
+		{"账号已禁用", "bob", testPassword, service.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := auth.Login(tt.username, tt.password, "127.0.0.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			p, err := auth.Authenticate(result.Token)
+			if err != nil {
+				t.Fatalf("校验令牌失败: %v", err)
+			}
+			if p.Username != tt.username || p.Role != model.RoleAdmin {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	store := repository.NewMemoryStore()
+	auth := newTestAuth(t, store, map[string]string{"alice": model.RoleAdmin, "bob": model.RoleAdmin})
+
+	tests := []struct {
+		name     string
+		username string
+	}{
+		{"已存在的用户名", "alice"},
+		{"不存在的用户名同样锁定", "nobody"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				if _, err := auth.Login(tt.username, "wrong-password", "127.0.0.1"); !errors.Is(err, service.ErrInvalidCredentials) {
+					t.Fatalf("第%d次失败 err = %v", i+1, err)
+				}
+			}
+			// 锁定期内即使密码正确也拒绝
+			if _, err := auth.Login(tt.username, testPassword, "127.0.0.1"); !errors.Is(err, service.ErrLoginLocked) {
+				t.Errorf("err = %v, want ErrLoginLocked", err)
+			}
+		})
+	}
+	// 锁定只影响对应的用户名
+	if _, err := auth.Login("bob", testPassword, "127.0.0.1"); err != nil {
+		t.Errorf("其他用户登录失败: %v", err)
+	}
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	store := repository.NewMemoryStore()
+	auth := newTestAuth(t, store, map[string]string{"alice": model.RoleAdmin})
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 4; i++ {
+			auth.Login("alice", "wrong-password", "127.0.0.1")
+		}
+		if _, err := auth.Login("alice", testPassword, "127.0.0.1"); err != nil {
+			t.Fatalf("第%d轮登录失败: %v", round+1, err)
+		}
+	}
+}
+
+// expirableSessionRepository 可以模拟会话过期的会话存储
+type expirableSessionRepository struct {
+	repository.AdminSessionRepository
+	expired bool
+}
+
+func (r *expirableSessionRepository) FindByID(id string) (*model.AdminSession, error) {
+	session, err := r.AdminSessionRepository.FindByID(id)
+	if err != nil || !r.expired {
+		return session, err
+	}
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+	return session, nil
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string
+		wantErr error
+	}{
+		{
+			name: "有效会话",
+			change: func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string {
+				return token
+			},
+		},
+		{
+			name: "签名被篡改",
+			change: func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string {
+				payload, _, _ := strings.Cut(token, ".")
+				return payload + ".AAAA"
+			},
+			wantErr: service.ErrInvalidToken,
+		},
+		{
+			name: "已注销",
+			change: func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string {
+				p, err := auth.Authenticate(token)
+				if err != nil {
+					t.Fatalf("校验令牌失败: %v", err)
+				}
+				auth.Logout(p)
+				return token
+			},
+			wantErr: service.ErrInvalidToken,
+		},
+		{
+			name: "修改密码后注销所有会话",
+			change: func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string {
+				password := "another-password"
+				if _, err := auth.UpdateUser(testActor, "alice", &service.UserUpdate{Password: &password}); err != nil {
+					t.Fatalf("修改密码失败: %v", err)
+				}
+				return token
+			},
+			wantErr: service.ErrInvalidToken,
+		},
+		{
+			name: "会话已过期",
+			change: func(t *testing.T, auth *service.AuthService, sessions *expirableSessionRepository, token string) string {
+				sessions.expired = true
+				return token
+			},
+			wantErr: service.ErrTokenExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryStore()
+			sessions := &expirableSessionRepository{AdminSessionRepository: store.AdminSessions}
+			store.AdminSessions = sessions
+			auth := newTestAuth(t, store, map[string]string{"alice": model.RoleAdmin})
+
+			result, err := auth.Login("alice", testPassword, "127.0.0.1")
+			if err != nil {
+				t.Fatalf("登录失败: %v", err)
+			}
+			token := tt.change(t, auth, sessions, result.Token)
+			if _, err := auth.Authenticate(token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLastAdminGuard(t *testing.T) {
+	viewer, inactive := model.RoleViewer, false
+	tests := []struct {
+		name    string
+		admins  int // 启用的admin数量
+		action  func(auth *service.AuthService) error
+		wantErr error
+	}{
+		{"禁用最后一个admin", 1, func(auth *service.AuthService) error {
+			_, err := auth.UpdateUser(testActor, "admin0", &service.UserUpdate{Active: &inactive})
+			return err
+		}, service.ErrLastAdmin},
+		{"降级最后一个admin", 1, func(auth *service.AuthService) error {
+			_, err := auth.UpdateUser(testActor, "admin0", &service.UserUpdate{Role: &viewer})
+			return err
+		}, service.ErrLastAdmin},
+		{"删除最后一个admin", 1, func(auth *service.AuthService) error {
+			return auth.DeleteUser(testActor, "admin0")
+		}, service.ErrLastAdmin},
+		{"还有其他admin时可以禁用", 2, func(auth *service.AuthService) error {
+			_, err := auth.UpdateUser(testActor, "admin0", &service.UserUpdate{Active: &inactive})
+			return err
+		}, nil},
+		{"还有其他admin时可以删除", 2, func(auth *service.AuthService) error {
+			return auth.DeleteUser(testActor, "admin0")
+		}, nil},
+		{"可以禁用非admin账号", 1, func(auth *service.AuthService) error {
+			_, err := auth.UpdateUser(testActor, "viewer", &service.UserUpdate{Active: &inactive})
+			return err
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := map[string]string{"viewer": model.RoleViewer}
+			for i := 0; i < tt.admins; i++ {
+				users["admin"+string(rune('0'+i))] = model.RoleAdmin
+			}
+			auth := newTestAuth(t, repository.NewMemoryStore(), users)
+			if err := tt.action(auth); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"AI-PROXY/model"
+)
+
+// ProviderAzure Azure OpenAI
+const ProviderAzure = "azure"
+
+// azureDeploymentPaths 需要指定部署的OpenAI接口，转发到/openai/deployments/{部署名}下，其余接口转发到/openai下
+var azureDeploymentPaths = []string{
+	"/chat/completions",
+	"/completions",
+	"/embeddings",
+	"/audio/transcriptions",
+	"/audio/translations",
+	"/audio/speech",
+	"/images/generations",
+}
+
+// 部署名只能包含字母、数字、点、下划线和连字符
+var azureDeploymentPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// azureNeedsDeployment 判断OpenAI路径是否需要部署名，已经是Azure格式的路径不需要
+func azureNeedsDeployment(p string) bool {
+	p = strings.TrimPrefix(p, "/v1")
+	for _, prefix := range azureDeploymentPaths {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// azurePath 把OpenAI路径转换为Azure路径，客户端直接使用/openai/开头的Azure路径时原样转发
+func azurePath(opts *model.AzureOptions, p, modelName string) string {
+	if strings.HasPrefix(p, "/openai/") {
+		return p
+	}
+	if azureNeedsDeployment(p) {
+		return "/openai/deployments/" + url.PathEscape(azureDeployment(opts, modelName)) + strings.TrimPrefix(p, "/v1")
+	}
+	return "/openai" + strings.TrimPrefix(p, "/v1")
+}
+
+// azureDeployment 按映射返回模型对应的部署名，没有映射时使用模型名，没有模型时使用默认部署
+func azureDeployment(opts *model.AzureOptions, modelName string) string {
+	if modelName == "" {
+		return opts.DefaultDeployment
+	}
+	if deployment, ok := opts.Deployments[modelName]; ok {
+		return deployment
+	}
+	return modelName
+}
+
+// azureQuery 补充默认的api-version；Realtime等通过查询参数指定模型的接口改为deployment参数
+func azureQuery(opts *model.AzureOptions, values url.Values) {
+	if !values.Has("api-version") && opts.APIVersion != "" {
+		values.Set("api-version", opts.APIVersion)
+	}
+	if modelName := values.Get("model"); modelName != "" && !values.Has("deployment") {
+		values.Set("deployment", azureDeployment(opts, modelName))
+		values.Del("model")
+	}
+}
+
+// validateAzureOptions 校验Azure配置
+func validateAzureOptions(opts *model.AzureOptions, verr *ValidationError) {
+	if opts.APIVersion == "" {
+		verr.add("provider_options.azure.api_version", "不能为空")
+	}
+	for name, deployment := range opts.Deployments {
+		if name == "" || !azureDeploymentPattern.MatchString(deployment) {
+			verr.add("provider_options.azure.deployments", "%s: 部署名只能包含字母、数字、点、下划线和连字符", name)
+		}
+	}
+	if d := opts.DefaultDeployment; d != "" && !azureDeploymentPattern.MatchString(d) {
+		verr.add("provider_options.azure.default_deployment", "部署名只能包含字母、数字、点、下划线和连字符")
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"AI-PROXY/model"
+	"AI-PROXY/util"
+)
+
+// ProviderBedrock AWS Bedrock
+const ProviderBedrock = "bedrock"
+
+// bedrockAnthropicVersion 请求体中未指定anthropic_version时使用的版本
+const bedrockAnthropicVersion = "bedrock-2023-05-31"
+
+// 单条事件流消息的长度上限
+const bedrockMaxMessageSize = 16 << 20
+
+var bedrockRegionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// Bedrock流式异常到Anthropic错误类型的映射，未列出的使用api_error
+var bedrockErrorTypes = map[string]string{
+	"throttlingException":           "rate_limit_error",
+	"validationException":           "invalid_request_error",
+	"accessDeniedException":         "permission_error",
+	"serviceUnavailableException":   "overloaded_error",
+	"modelTimeoutException":         "api_error",
+	"modelStreamErrorException":     "api_error",
+	"internalServerException":       "api_error",
+	"resourceNotFoundException":     "not_found_error",
+	"serviceQuotaExceededException": "rate_limit_error",
+}
+
+// BedrockInvocation 转换后的Bedrock调用
+type BedrockInvocation struct {
+	Path   string // 如 /model/{模型ID}/invoke，模型ID已按AWS规则编码
+	Stream bool   // 是否使用invoke-with-response-stream
+	Body   []byte
+}
+
+// ConvertBedrockRequest 把Anthropic Messages请求转换为Bedrock调用：model和stream移到路径中，
+// 补充anthropic_version，anthropic-beta请求头转为请求体中的anthropic_beta
+func ConvertBedrockRequest(opts *model.BedrockOptions, body []byte, header http.Header) (*BedrockInvocation, error) {
+	var params map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil || params == nil {
+		return nil, errors.New("请求体不是有效的JSON对象")
+	}
+	name, _ := params["model"].(string)
+	if name == "" {
+		return nil, errors.New("缺少model参数")
+	}
+	stream, _ := params["stream"].(bool)
+	delete(params, "model")
+	delete(params, "stream")
+	if _, ok := params["anthropic_version"]; !ok {
+		params["anthropic_version"] = bedrockAnthropicVersion
+	}
+	if _, ok := params["anthropic_beta"]; !ok {
+		var betas []string
+		for _, value := range header.Values("Anthropic-Beta") {
+			for _, beta := range strings.Split(value, ",") {
+				if beta = strings.TrimSpace(beta); beta != "" {
+					betas = append(betas, beta)
+				}
+			}
+		}
+		if len(betas) > 0 {
+			params["anthropic_beta"] = betas
+		}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	modelID := name
+	if id, ok := opts.Models[name]; ok {
+		modelID = id
+	}
+	action := "invoke"
+	if stream {
+		action = "invoke-with-response-stream"
+	}
+	return &BedrockInvocation{
+		Path:   "/model/" + util.AWSEscape(modelID) + "/" + action,
+		Stream: stream,
+		Body:   data,
+	}, nil
+}
+
+// DecodeBedrockStream 解析invoke-with-response-stream返回的AWS事件流，把每个分片转为Anthropic的SSE事件，
+// 事件名为分片中的type；上游返回的异常转为error事件
+func DecodeBedrockStream(r io.Reader, emit func(event string, data []byte) error) error {
+	prelude := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(r, prelude); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		total := binary.BigEndian.Uint32(prelude[0:4])
+		headersLen := binary.BigEndian.Uint32(prelude[4:8])
+		if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+			return errors.New("事件流消息头校验失败")
+		}
+		if total > bedrockMaxMessageSize || uint64(headersLen)+16 > uint64(total) {
+			return fmt.Errorf("事件流消息长度无效: %d", total)
+		}
+		rest := make([]byte, total-12)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return err
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(prelude)
+		crc.Write(rest[:len(rest)-4])
+		if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+			return errors.New("事件流消息校验失败")
+		}
+		headers, err := parseEventStreamHeaders(rest[:headersLen])
+		if err != nil {
+			return err
+		}
+		payload := rest[headersLen : len(rest)-4]
+
+		if headers[":message-type"] != "event" {
+			if err := emit("error", bedrockStreamError(headers, payload)); err != nil {
+				return err
+			}
+			continue
+		}
+		if headers[":event-type"] != "chunk" {
+			continue
+		}
+		var chunk struct {
+			Bytes string `json:"bytes"`
+		}
+		if err := json.Unmarshal(payload, &chunk); err != nil {
+			return fmt.Errorf("解析事件流分片失败: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.Bytes)
+		if err != nil {
+			return fmt.Errorf("解析事件流分片失败: %w", err)
+		}
+		var event struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(data, &event)
+		if err := emit(event.Type, data); err != nil {
+			return err
+		}
+	}
+}
+
+// parseEventStreamHeaders 解析事件流消息头，只保留字符串类型的值
+func parseEventStreamHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	// 各类型值的固定长度，-1表示2字节长度前缀加内容
+	sizes := map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 6: -1, 7: -1, 8: 8, 9: 16}
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 2+nameLen {
+			return nil, errors.New("事件流消息头格式错误")
+		}
+		name := string(data[1 : 1+nameLen])
+		valueType := data[1+nameLen]
+		data = data[2+nameLen:]
+		size, ok := sizes[valueType]
+		if !ok {
+			return nil, fmt.Errorf("未知的事件流消息头类型: %d", valueType)
+		}
+		if size == -1 {
+			if len(data) < 2 {
+				return nil, errors.New("事件流消息头格式错误")
+			}
+			size = int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+		}
+		if len(data) < size {
+			return nil, errors.New("事件流消息头格式错误")
+		}
+		if valueType == 7 {
+			headers[name] = string(data[:size])
+		}
+		data = data[size:]
+	}
+	return headers, nil
+}
+
+// bedrockStreamError 把事件流中的异常转为Anthropic格式的错误事件
+func bedrockStreamError(headers map[string]string, payload []byte) []byte {
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(payload, &body)
+	exception := headers[":exception-type"]
+	if exception == "" {
+		exception = headers[":error-code"]
+	}
+	errType, ok := bedrockErrorTypes[exception]
+	if !ok {
+		errType = "api_error"
+	}
+	if body.Message == "" {
+		body.Message = exception
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": errType, "message": body.Message},
+	})
+	return data
+}
+
+// validateBedrockOptions 校验Bedrock配置
+func validateBedrockOptions(opts *model.BedrockOptions, verr *ValidationError) {
+	if !bedrockRegionPattern.MatchString(opts.Region) {
+		verr.add("provider_options.bedrock.region", "区域格式无效，如us-east-1")
+	}
+	if opts.AccessKeyID == "" {
+		verr.add("provider_options.bedrock.access_key_id", "不能为空")
+	}
+	for name, id := range opts.Models {
+		if name == "" || id == "" {
+			verr.add("provider_options.bedrock.models", "模型名和模型ID不能为空")
+		}
+	}
+}
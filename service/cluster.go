@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+)
+
+// 变更日志中的实体类型
+const EntityAPIConfig = "api_config"
+
+// 超过该时间没有心跳的实例会从列表中清理
+const instanceExpire = time.Hour
+
+// InstanceStatus 单个实例的配置版本状态
+type InstanceStatus struct {
+	model.Instance
+	Alive  bool `json:"alive"`   // 最近是否有心跳
+	InSync bool `json:"in_sync"` // 是否已应用最新配置版本
+}
+
+// ClusterStatus 集群配置版本状态
+type ClusterStatus struct {
+	InstanceID    string           `json:"instance_id"` // 当前实例
+	Version       uint             `json:"version"`     // 当前实例应用到的版本
+	LatestVersion uint             `json:"latest_version"`
+	Instances     []InstanceStatus `json:"instances"`
+}
+
+// ClusterService 多实例配置同步：轮询变更日志失效本地缓存，并上报心跳
+type ClusterService struct {
+	instanceID string
+	hostname   string
+	startedAt  time.Time
+	changes    repository.ConfigChangeRepository
+	instances  repository.InstanceRepository
+	apiConfig  *APIConfigService
+
+	mu       sync.Mutex
+	version  uint
+	interval time.Duration
+}
+
+// NewClusterService 创建多实例配置同步service
+func NewClusterService(instanceID string, changes repository.ConfigChangeRepository, instances repository.InstanceRepository, apiConfig *APIConfigService) *ClusterService {
+	hostname, _ := os.Hostname()
+	return &ClusterService{
+		instanceID: instanceID,
+		hostname:   hostname,
+		startedAt:  time.Now(),
+		changes:    changes,
+		instances:  instances,
+		apiConfig:  apiConfig,
+		interval:   2 * time.Second,
+	}
+}
+
+// newInstanceID 生成实例ID：主机名-进程号-随机数
+func newInstanceID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%04x", hostname, os.Getpid(), rand.Intn(0x10000))
+}
+
+// InstanceID 当前实例ID
+func (s *ClusterService) InstanceID() string {
+	return s.instanceID
+}
+
+// Init 记录启动时的最新版本，启动时缓存已全量加载，之前的变更无需重放
+func (s *ClusterService) Init() error {
+	latest, err := s.changes.LatestID()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.version = latest
+	s.mu.Unlock()
+	return s.heartbeat()
+}
+
+// Poll 拉取新的配置变更并失效对应缓存，然后上报心跳
+func (s *ClusterService) Poll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		changes, err := s.changes.FindAfter(s.version, 500)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			if c.Entity == EntityAPIConfig {
+				s.apiConfig.cache.invalidate(c.Name)
+			}
+			s.version = c.ID
+		}
+		if len(changes) < 500 {
+			break
+		}
+	}
+	return s.heartbeatLocked()
+}
+
+func (s *ClusterService) heartbeat() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heartbeatLocked()
+}
+
+func (s *ClusterService) heartbeatLocked() error {
+	return s.instances.Upsert(&model.Instance{
+		InstanceID: s.instanceID,
+		Hostname:   s.hostname,
+		Version:    s.version,
+		StartedAt:  s.startedAt,
+		LastSeen:   time.Now(),
+	})
+}
+
+// Start 定时轮询配置变更，stop关闭后退出
+func (s *ClusterService) Start(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Poll(); err != nil && onError != nil {
+				onError(err)
+			}
+			if time.Since(lastCleanup) > instanceExpire {
+				s.instances.DeleteSeenBefore(time.Now().Add(-instanceExpire))
+				lastCleanup = time.Now()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Status 获取集群中各实例的配置版本
+func (s *ClusterService) Status() (*ClusterStatus, error) {
+	latest, err := s.changes.LatestID()
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.instances.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	version, interval := s.version, s.interval
+	s.mu.Unlock()
+
+	status := &ClusterStatus{
+		InstanceID:    s.instanceID,
+		Version:       version,
+		LatestVersion: latest,
+		Instances:     make([]InstanceStatus, 0, len(instances)),
+	}
+	for _, i := range instances {
+		status.Instances = append(status.Instances, InstanceStatus{
+			Instance: i,
+			Alive:    time.Since(i.LastSeen) < 3*interval,
+			InSync:   i.Version >= latest,
+		})
+	}
+	return status, nil
+}
+
+// recordChange 失效本地缓存并写入变更日志，写日志失败时其他实例依靠定时刷新兜底
+func (s *APIConfigService) recordChange(action string, names ...string) {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		s.cache.invalidate(name)
+		if s.changes == nil {
+			continue
+		}
+		s.changes.Append(&model.ConfigChange{
+			Entity:   EntityAPIConfig,
+			Name:     name,
+			Action:   action,
+			Instance: s.instanceID,
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"testing"
+
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+)
+
+func TestClusterPoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		poll     bool   // 其他实例修改后是否轮询变更日志
+		wantDesc string // 当前实例读到的描述
+	}{
+		{"轮询前使用本地缓存", false, "old"},
+		{"轮询后失效缓存读到新配置", true, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 两个实例共用同一个存储
+			local, store := newTestServices(t)
+			remote := service.New(store)
+			if err := local.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com", Description: "old"}); err != nil {
+				t.Fatalf("创建失败: %v", err)
+			}
+			if err := local.Cluster.Init(); err != nil {
+				t.Fatalf("初始化失败: %v", err)
+			}
+			if _, err := local.APIConfig.GetAPIConfigByName("openai"); err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+
+			if err := remote.APIConfig.UpdateAPIConfig(testActor, "openai", &model.APIConfig{Description: "new"}, 0); err != nil {
+				t.Fatalf("更新失败: %v", err)
+			}
+			if tt.poll {
+				if err := local.Cluster.Poll(); err != nil {
+					t.Fatalf("轮询失败: %v", err)
+				}
+			}
+			got, err := local.APIConfig.GetAPIConfigByName("openai")
+			if err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+			if got.Description != tt.wantDesc {
+				t.Errorf("description = %q, want %q", got.Description, tt.wantDesc)
+			}
+		})
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+	local, store := newTestServices(t)
+	remote := service.New(store)
+	for _, s := range []*service.Services{local, remote} {
+		if err := s.Cluster.Init(); err != nil {
+			t.Fatalf("初始化失败: %v", err)
+		}
+	}
+	if err := remote.APIConfig.CreateAPIConfig(testActor, &model.APIConfig{Name: "openai", BaseURL: "https://api.openai.com"}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+
+	inSync := func() map[string]bool {
+		status, err := local.Cluster.Status()
+		if err != nil {
+			t.Fatalf("查询状态失败: %v", err)
+		}
+		if status.LatestVersion != 1 {
+			t.Errorf("latest_version = %d, want 1", status.LatestVersion)
+		}
+		result := make(map[string]bool)
+		for _, i := range status.Instances {
+			result[i.InstanceID] = i.InSync
+		}
+		return result
+	}
+
+	// 变更日志只在轮询时应用，写入的实例同样需要轮询后才上报新版本
+	got := inSync()
+	if len(got) != 2 || got[local.Cluster.InstanceID()] || got[remote.Cluster.InstanceID()] {
+		t.Errorf("轮询前 in_sync = %v", got)
+	}
+	if err := local.Cluster.Poll(); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	got = inSync()
+	if !got[local.Cluster.InstanceID()] || got[remote.Cluster.InstanceID()] {
+		t.Errorf("本实例轮询后 in_sync = %v", got)
+	}
+}
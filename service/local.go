@@ -0,0 +1,461 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+// ProviderLocal 本地或自建的模型服务，如Ollama、llama.cpp、vLLM
+const ProviderLocal = "local"
+
+// 本地模型服务的上游接口类型
+const (
+	LocalAPIOpenAI = "openai" // OpenAI兼容接口
+	LocalAPIOllama = "ollama" // Ollama原生接口
+)
+
+// 需要转换为Ollama原生接口的OpenAI接口
+const (
+	ollamaChatPath   = "/v1/chat/completions"
+	ollamaModelsPath = "/v1/models"
+)
+
+// Ollama单行响应的长度上限
+const ollamaMaxLineSize = 16 << 20
+
+// ModelInfo OpenAI格式的模型信息，API为汇总列表中提供该模型的API名称
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	API     string `json:"api,omitempty"`
+}
+
+// ModelList OpenAI格式的模型列表
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
+}
+
+// IsOllama 判断API是否为Ollama原生接口
+func IsOllama(config *model.APIConfig) bool {
+	opts := config.ProviderOptions.Local
+	return config.Provider == ProviderLocal && opts != nil && opts.API == LocalAPIOllama
+}
+
+// OllamaTranslates 判断请求是否需要转换为Ollama原生接口，其余请求原样转发到Ollama的OpenAI兼容接口
+func OllamaTranslates(method, p string) bool {
+	return method == http.MethodPost && p == ollamaChatPath || method == http.MethodGet && p == ollamaModelsPath
+}
+
+// LocalModelsPath 返回本地模型服务列出模型的上游路径
+func LocalModelsPath(config *model.APIConfig) string {
+	if IsOllama(config) {
+		return "/api/tags"
+	}
+	return ollamaModelsPath
+}
+
+// ParseLocalModels 解析本地模型服务的模型列表，Ollama的/api/tags转为OpenAI格式
+func ParseLocalModels(config *model.APIConfig, body []byte) ([]ModelInfo, error) {
+	if !IsOllama(config) {
+		var list ModelList
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("解析模型列表失败: %w", err)
+		}
+		return list.Data, nil
+	}
+	var tags struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			ModifiedAt time.Time `json:"modified_at"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("解析模型列表失败: %w", err)
+	}
+	models := make([]ModelInfo, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, ModelInfo{ID: m.Name, Object: "model", Created: m.ModifiedAt.Unix(), OwnedBy: "library"})
+	}
+	return models, nil
+}
+
+// openAIChatRequest OpenAI对话请求中可以转换为Ollama参数的部分
+type openAIChatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Stream        bool            `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	MaxTokens           *int            `json:"max_tokens"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens"`
+	Stop                json.RawMessage `json:"stop"`
+	Seed                *int            `json:"seed"`
+	PresencePenalty     *float64        `json:"presence_penalty"`
+	FrequencyPenalty    *float64        `json:"frequency_penalty"`
+	ResponseFormat      *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+	Tools json.RawMessage `json:"tools"`
+}
+
+type openAIMessage struct {
+	Role      string           `json:"role"`
+	Content   json.RawMessage  `json:"content"`
+	ToolCalls []openAIToolCall `json:"tool_calls"`
+}
+
+type openAIToolCall struct {
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChatResponse /api/chat的响应，流式响应每行一个
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// OllamaChat 转换后的Ollama对话请求
+type OllamaChat struct {
+	Body         []byte
+	Model        string
+	Stream       bool
+	IncludeUsage bool // 流式响应最后是否返回用量
+}
+
+// ConvertOllamaChatRequest 把OpenAI对话请求转换为Ollama的/api/chat请求：采样参数移到options中，
+// 多模态内容中的data URL图片转为images，工具调用的参数由JSON字符串转为对象
+func ConvertOllamaChatRequest(body []byte) (*OllamaChat, error) {
+	var req openAIChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errors.New("请求体不是有效的JSON对象")
+	}
+	if req.Model == "" {
+		return nil, errors.New("缺少model参数")
+	}
+
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg, err := convertOllamaMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	options := make(map[string]interface{})
+	setOption := func(name string, value interface{}, ok bool) {
+		if ok {
+			options[name] = value
+		}
+	}
+	setOption("temperature", req.Temperature, req.Temperature != nil)
+	setOption("top_p", req.TopP, req.TopP != nil)
+	setOption("num_predict", req.MaxTokens, req.MaxTokens != nil)
+	setOption("num_predict", req.MaxCompletionTokens, req.MaxCompletionTokens != nil)
+	setOption("seed", req.Seed, req.Seed != nil)
+	setOption("presence_penalty", req.PresencePenalty, req.PresencePenalty != nil)
+	setOption("frequency_penalty", req.FrequencyPenalty, req.FrequencyPenalty != nil)
+	if len(req.Stop) > 0 && string(req.Stop) != "null" {
+		var stop []string
+		if err := json.Unmarshal(req.Stop, &stop); err != nil {
+			var single string
+			if err := json.Unmarshal(req.Stop, &single); err != nil {
+				return nil, errors.New("stop需为字符串或字符串数组")
+			}
+			stop = []string{single}
+		}
+		options["stop"] = stop
+	}
+
+	out := map[string]interface{}{
+		"model":    req.Model,
+		"messages": messages,
+		"stream":   req.Stream, // Ollama默认流式响应，需要显式指定
+	}
+	if len(options) > 0 {
+		out["options"] = options
+	}
+	if f := req.ResponseFormat; f != nil {
+		switch {
+		case f.Type == "json_object":
+			out["format"] = "json"
+		case f.Type == "json_schema" && f.JSONSchema != nil && len(f.JSONSchema.Schema) > 0:
+			out["format"] = f.JSONSchema.Schema
+		}
+	}
+	if len(req.Tools) > 0 && string(req.Tools) != "null" {
+		out["tools"] = req.Tools
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return &OllamaChat{
+		Body:         data,
+		Model:        req.Model,
+		Stream:       req.Stream,
+		IncludeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+	}, nil
+}
+
+// convertOllamaMessage 转换单条消息，内容为数组时拼接文本部分，图片只支持base64的data URL
+func convertOllamaMessage(m openAIMessage) (ollamaMessage, error) {
+	msg := ollamaMessage{Role: m.Role}
+	if len(m.Content) > 0 && string(m.Content) != "null" {
+		if err := json.Unmarshal(m.Content, &msg.Content); err != nil {
+			var parts []struct {
+				Type     string `json:"type"`
+				Text     string `json:"text"`
+				ImageURL struct {
+					URL string `json:"url"`
+				} `json:"image_url"`
+			}
+			if err := json.Unmarshal(m.Content, &parts); err != nil {
+				return msg, errors.New("消息的content需为字符串或内容数组")
+			}
+			var text []string
+			for _, part := range parts {
+				switch part.Type {
+				case "text":
+					text = append(text, part.Text)
+				case "image_url":
+					_, data, ok := strings.Cut(part.ImageURL.URL, ";base64,")
+					if !ok || !strings.HasPrefix(part.ImageURL.URL, "data:") {
+						return msg, errors.New("Ollama只支持data URL格式的base64图片")
+					}
+					msg.Images = append(msg.Images, data)
+				default:
+					return msg, fmt.Errorf("不支持的内容类型: %s", part.Type)
+				}
+			}
+			msg.Content = strings.Join(text, "\n")
+		}
+	}
+	for _, call := range m.ToolCalls {
+		var tc ollamaToolCall
+		tc.Function.Name = call.Function.Name
+		tc.Function.Arguments = json.RawMessage("{}")
+		if args := strings.TrimSpace(call.Function.Arguments); args != "" {
+			if !json.Valid([]byte(args)) {
+				return msg, fmt.Errorf("工具调用%s的参数不是有效的JSON", call.Function.Name)
+			}
+			tc.Function.Arguments = json.RawMessage(args)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+	return msg, nil
+}
+
+// ConvertOllamaChatResponse 把/api/chat的非流式响应转换为OpenAI的chat.completion
+func ConvertOllamaChatResponse(body []byte, id string) ([]byte, error) {
+	var resp ollamaChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析Ollama响应失败: %w", err)
+	}
+	message := map[string]interface{}{"role": "assistant", "content": resp.Message.Content}
+	if calls := openAIToolCalls(resp.Message.ToolCalls, 0, false); len(calls) > 0 {
+		message["tool_calls"] = calls
+	}
+	return json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-" + id,
+		"object":  "chat.completion",
+		"created": ollamaCreated(resp.CreatedAt),
+		"model":   resp.Model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"finish_reason": ollamaFinishReason(resp),
+		}},
+		"usage": ollamaUsage(resp),
+	})
+}
+
+// DecodeOllamaStream 把/api/chat的NDJSON流式响应转换为OpenAI的chat.completion.chunk，
+// emit的参数为一个SSE事件的data，流结束时发送[DONE]
+func DecodeOllamaStream(r io.Reader, chat *OllamaChat, id string, emit func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), ollamaMaxLineSize)
+	first := true
+	toolCalls := 0 // 已发送的工具调用数，流式响应中工具调用的index和最终的finish_reason依赖它
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var resp ollamaChatResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return fmt.Errorf("解析Ollama流式响应失败: %w", err)
+		}
+		if resp.Error != "" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"error": map[string]string{"type": "api_error", "message": resp.Error},
+			})
+			return emit(data)
+		}
+
+		chunk := func(delta map[string]interface{}, finish interface{}) map[string]interface{} {
+			return map[string]interface{}{
+				"id":      "chatcmpl-" + id,
+				"object":  "chat.completion.chunk",
+				"created": ollamaCreated(resp.CreatedAt),
+				"model":   resp.Model,
+				"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": finish}},
+			}
+		}
+		delta := make(map[string]interface{})
+		if first {
+			delta["role"] = "assistant"
+			first = false
+		}
+		if resp.Message.Content != "" {
+			delta["content"] = resp.Message.Content
+		}
+		if calls := openAIToolCalls(resp.Message.ToolCalls, toolCalls, true); len(calls) > 0 {
+			delta["tool_calls"] = calls
+			toolCalls += len(calls)
+		}
+		if len(delta) > 0 {
+			if err := emitJSON(emit, chunk(delta, nil)); err != nil {
+				return err
+			}
+		}
+		if !resp.Done {
+			continue
+		}
+		finish := ollamaFinishReason(resp)
+		if toolCalls > 0 {
+			finish = "tool_calls"
+		}
+		if err := emitJSON(emit, chunk(map[string]interface{}{}, finish)); err != nil {
+			return err
+		}
+		if chat.IncludeUsage {
+			usage := chunk(nil, nil)
+			usage["choices"] = []interface{}{}
+			usage["usage"] = ollamaUsage(resp)
+			if err := emitJSON(emit, usage); err != nil {
+				return err
+			}
+		}
+		return emit([]byte("[DONE]"))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("Ollama流式响应意外结束")
+}
+
+// OllamaError 提取Ollama错误响应中的信息，无法解析时返回原始内容
+func OllamaError(body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// openAIToolCalls 把Ollama的工具调用转换为OpenAI格式，Ollama不返回调用ID，从start开始按序号生成；
+// 流式响应需要index
+func openAIToolCalls(calls []ollamaToolCall, start int, stream bool) []interface{} {
+	out := make([]interface{}, 0, len(calls))
+	for i := start; i < start+len(calls); i++ {
+		call := calls[i-start]
+		args := string(call.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		tc := map[string]interface{}{
+			"id":       fmt.Sprintf("call_%d", i),
+			"type":     "function",
+			"function": map[string]string{"name": call.Function.Name, "arguments": args},
+		}
+		if stream {
+			tc["index"] = i
+		}
+		out = append(out, tc)
+	}
+	return out
+}
+
+func ollamaFinishReason(resp ollamaChatResponse) string {
+	switch {
+	case len(resp.Message.ToolCalls) > 0:
+		return "tool_calls"
+	case resp.DoneReason == "length":
+		return "length"
+	}
+	return "stop"
+}
+
+func ollamaUsage(resp ollamaChatResponse) map[string]int {
+	return map[string]int{
+		"prompt_tokens":     resp.PromptEvalCount,
+		"completion_tokens": resp.EvalCount,
+		"total_tokens":      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+func ollamaCreated(t time.Time) int64 {
+	if t.IsZero() {
+		return time.Now().Unix()
+	}
+	return t.Unix()
+}
+
+func emitJSON(emit func([]byte) error, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return emit(data)
+}
+
+// validateLocalOptions 校验本地模型服务配置
+func validateLocalOptions(opts *model.LocalOptions, verr *ValidationError) {
+	if opts.API != "" && opts.API != LocalAPIOpenAI && opts.API != LocalAPIOllama {
+		verr.add("provider_options.local.api", "只能为%s或%s", LocalAPIOpenAI, LocalAPIOllama)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// loginFreeFailures 同一用户名连续失败该次数后开始锁定
+	loginFreeFailures = 5
+	// loginBaseLockout 首次锁定的时长，之后每多失败一次翻倍
+	loginBaseLockout = 30 * time.Second
+	// loginMaxLockout 锁定时长上限，超过该时间没有再失败的记录会被清除
+	loginMaxLockout = 15 * time.Minute
+	// loginThrottleMaxEntries 记录数超过该值时清理过期记录，避免随机用户名撑大内存
+	loginThrottleMaxEntries = 10000
+)
+
+// loginFailure 单个用户名的连续登录失败记录
+type loginFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginThrottle 按用户名记录连续登录失败次数，超过次数后按指数退避锁定；
+// 不存在的用户名同样计数，避免通过是否锁定探测用户名。只在本实例内生效
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailure
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{failures: make(map[string]*loginFailure)}
+}
+
+// locked 返回用户名是否处于锁定期
+func (t *loginThrottle) locked(username string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.failures[username]
+	return ok && now.Before(f.lockedUntil)
+}
+
+// fail 记录一次失败，达到次数后设置锁定期
+func (t *loginThrottle) fail(username string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.failures) >= loginThrottleMaxEntries {
+		t.pruneLocked(now)
+	}
+	f, ok := t.failures[username]
+	if !ok || now.Sub(f.lastFailure) > loginMaxLockout {
+		f = &loginFailure{}
+		t.failures[username] = f
+	}
+	f.count++
+	f.lastFailure = now
+	if f.count >= loginFreeFailures {
+		lockout := loginMaxLockout
+		if shift := f.count - loginFreeFailures; shift < 10 {
+			lockout = loginBaseLockout << shift
+		}
+		if lockout > loginMaxLockout {
+			lockout = loginMaxLockout
+		}
+		f.lockedUntil = now.Add(lockout)
+	}
+}
+
+// reset 登录成功后清除失败记录
+func (t *loginThrottle) reset(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, username)
+}
+
+func (t *loginThrottle) pruneLocked(now time.Time) {
+	for username, f := range t.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.lastFailure) > loginMaxLockout {
+			delete(t.failures, username)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"AI-PROXY/model"
+	"AI-PROXY/repository"
+	"AI-PROXY/util"
+)
+
+// 请求日志中路径列的长度
+const requestLogPathSize = 255
+
+// RequestLogService 请求日志，目前记录WebSocket会话的流量统计
+type RequestLogService struct {
+	repo repository.RequestLogRepository
+}
+
+// NewRequestLogService 创建请求日志service
+func NewRequestLogService(repo repository.RequestLogRepository) *RequestLogService {
+	return &RequestLogService{repo: repo}
+}
+
+// Record 保存一条请求日志，写入失败只记录警告，不影响请求本身
+func (s *RequestLogService) Record(log *model.RequestLog) {
+	if s == nil || s.repo == nil {
+		return
+	}
+	if len(log.Path) > requestLogPathSize {
+		log.Path = log.Path[:requestLogPathSize]
+	}
+	if err := s.repo.Create(log); err != nil {
+		util.Logger.Warnf("写入请求日志失败: %v", err)
+	}
+}
+
+// Recent 查询最近的请求日志，apiName为空时查询所有API
+func (s *RequestLogService) Recent(apiName string, limit int) ([]model.RequestLog, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	return s.repo.FindRecent(apiName, limit)
+}
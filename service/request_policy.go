@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"AI-PROXY/config"
+	"AI-PROXY/model"
+)
+
+// PolicyViolation 请求违反参数策略，字段与OpenAI错误格式对应
+type PolicyViolation struct {
+	Status  int
+	Code    string
+	Param   string
+	Message string
+}
+
+func (v *PolicyViolation) Error() string {
+	return v.Message
+}
+
+// ApplyRequestPolicy 对JSON请求体执行参数策略，返回可能被修改的请求体；
+// 请求体为空或策略为空时原样返回
+func ApplyRequestPolicy(policy model.RequestPolicy, body []byte) ([]byte, *PolicyViolation) {
+	if policy.IsEmpty() || len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	var params map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil || params == nil {
+		return nil, &PolicyViolation{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_json",
+			Message: "请求体不是有效的JSON对象",
+		}
+	}
+
+	modified := false
+	for _, key := range policy.Strip {
+		if _, ok := params[key]; ok {
+			delete(params, key)
+			modified = true
+		}
+	}
+	for key, value := range policy.Defaults {
+		if _, ok := params[key]; !ok {
+			params[key] = value
+			modified = true
+		}
+	}
+	for key, value := range policy.Force {
+		params[key] = value
+		modified = true
+	}
+
+	if len(policy.AllowedModels) > 0 {
+		name, _ := params["model"].(string)
+		if !matchAnyGlob(policy.AllowedModels, name) {
+			return nil, &PolicyViolation{
+				Status:  http.StatusForbidden,
+				Code:    "model_not_allowed",
+				Param:   "model",
+				Message: fmt.Sprintf("不允许使用模型 %q，可用模型: %s", name, strings.Join(policy.AllowedModels, ", ")),
+			}
+		}
+	}
+	limits := []struct {
+		param string
+		max   int
+	}{
+		{"max_tokens", policy.MaxTokens},
+		{"max_completion_tokens", policy.MaxCompletionTokens},
+		{"n", policy.MaxN},
+	}
+	for _, limit := range limits {
+		if limit.max <= 0 {
+			continue
+		}
+		value, ok := params[limit.param]
+		if !ok {
+			continue
+		}
+		n, isNumber := value.(json.Number)
+		f, err := n.Float64()
+		if !isNumber || err != nil {
+			return nil, &PolicyViolation{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_type",
+				Param:   limit.param,
+				Message: fmt.Sprintf("%s 必须是数字", limit.param),
+			}
+		}
+		if f > float64(limit.max) {
+			return nil, &PolicyViolation{
+				Status:  http.StatusBadRequest,
+				Code:    "parameter_limit_exceeded",
+				Param:   limit.param,
+				Message: fmt.Sprintf("%s 不能超过 %d", limit.param, limit.max),
+			}
+		}
+	}
+
+	if !modified {
+		return body, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, &PolicyViolation{Status: http.StatusBadRequest, Code: "invalid_json", Message: err.Error()}
+	}
+	return data, nil
+}
+
+// KeyRequestPolicy 返回客户端API Key绑定的参数策略（配置文件的key_policies，按Key的SHA-256匹配），
+// 未绑定时返回空策略
+func KeyRequestPolicy(clientKey string) model.RequestPolicy {
+	cfg := config.Get()
+	if cfg == nil || clientKey == "" || len(cfg.KeyPolicies) == 0 {
+		return model.RequestPolicy{}
+	}
+	sum := sha256.Sum256([]byte(clientKey))
+	hash := hex.EncodeToString(sum[:])
+	for _, p := range cfg.KeyPolicies {
+		if strings.EqualFold(p.KeySHA256, hash) {
+			return p.Policy
+		}
+	}
+	return model.RequestPolicy{}
+}
+
+// RequestModel 返回JSON请求体中的model参数，不是JSON或没有model时返回空字符串
+func RequestModel(body []byte) string {
+	var params struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &params)
+	return params.Model
+}
+
+// MultipartModel 返回multipart/form-data请求体中的model字段，用于音频转写等上传文件的接口，
+// 没有model字段或无法解析时返回空字符串
+func MultipartModel(body io.Reader, contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return ""
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			value, _ := io.ReadAll(io.LimitReader(part, 1024))
+			return strings.TrimSpace(string(value))
+		}
+	}
+}
+
+// matchAnyGlob 判断s是否匹配任一模式，*匹配任意字符（包括/）
+func matchAnyGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// validateRequestPolicy 校验参数策略
+func validateRequestPolicy(policy model.RequestPolicy, verr *ValidationError) {
+	if policy.MaxTokens < 0 {
+		verr.add("request_policy.max_tokens", "不能为负数")
+	}
+	if policy.MaxCompletionTokens < 0 {
+		verr.add("request_policy.max_completion_tokens", "不能为负数")
+	}
+	if policy.MaxN < 0 {
+		verr.add("request_policy.max_n", "不能为负数")
+	}
+	for _, m := range policy.AllowedModels {
+		if strings.TrimSpace(m) == "" {
+			verr.add("request_policy.allowed_models", "不能包含空值")
+			break
+		}
+	}
+	for _, key := range policy.Strip {
+		if key == "" {
+			verr.add("request_policy.strip", "参数名不能为空")
+			break
+		}
+	}
+	for key := range policy.Defaults {
+		if key == "" {
+			verr.add("request_policy.defaults", "参数名不能为空")
+			break
+		}
+	}
+	for key := range policy.Force {
+		if key == "" {
+			verr.add("request_policy.force", "参数名不能为空")
+			break
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"AI-PROXY/model"
+)
+
+// 模板中允许引用的环境变量前缀，避免通过改写规则把服务端的其他环境变量发给上游
+const rewriteEnvPrefix = "AI_PROXY_"
+
+// 模板变量 ${name}
+var templatePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.]+)\}`)
+
+// ProviderGemini Google Gemini API
+const ProviderGemini = "gemini"
+
+// 各供应商内置的改写规则，在API自己的规则之前执行
+var providerRewrites = map[string]model.RewriteRules{
+	// Gemini使用key查询参数认证，将客户端的Bearer令牌转为key参数，客户端已带key时不覆盖
+	ProviderGemini: {
+		RequestHeaders: model.HeaderRewrite{Remove: []string{"Authorization"}},
+		Query:          model.QueryRewrite{Default: map[string]string{"key": "${client_key}"}},
+	},
+	// Azure OpenAI使用api-key头认证，将客户端的Bearer令牌转为api-key头
+	ProviderAzure: {
+		RequestHeaders: model.HeaderRewrite{
+			Remove: []string{"Authorization"},
+			Set:    map[string]string{"api-key": "${client_key}"},
+		},
+	},
+	// Vertex AI使用服务账号换取的访问令牌认证，客户端的API Key不转发给上游
+	ProviderVertex: {
+		RequestHeaders: model.HeaderRewrite{Remove: []string{"Authorization", "x-goog-api-key"}},
+		Query:          model.QueryRewrite{Remove: []string{"key"}},
+	},
+}
+
+// 已编译的正则缓存
+var rewriteRegexps sync.Map
+
+// RewriteContext 改写模板中可以引用的请求信息
+type RewriteContext struct {
+	ClientKey string // 客户端携带的API Key
+	RequestID string
+}
+
+// Rewriter 一个API生效的全部改写规则
+type Rewriter struct {
+	rules  []model.RewriteRules
+	ctx    RewriteContext
+	azure  *model.AzureOptions // provider为azure时按部署映射改写路径和查询参数
+	model  string              // 请求体中的模型名，用于选择Azure部署
+	vertex *vertexTarget       // provider为vertex时改写为项目和区域下的模型路径并使用访问令牌认证
+}
+
+// vertexTarget Vertex请求的项目、区域和访问令牌
+type vertexTarget struct {
+	project  string
+	location string
+	token    string
+}
+
+// NewRewriter 按API配置创建改写器，先执行供应商内置规则，再执行API自己的规则
+func NewRewriter(config *model.APIConfig, ctx RewriteContext) *Rewriter {
+	var rules []model.RewriteRules
+	if preset, ok := providerRewrites[config.Provider]; ok {
+		rules = append(rules, preset)
+	}
+	rules = append(rules, config.Rewrite)
+	r := &Rewriter{rules: rules, ctx: ctx}
+	if config.Provider == ProviderAzure {
+		r.azure = config.ProviderOptions.Azure
+	}
+	return r
+}
+
+// NeedsModel 判断改写路径是否需要请求体中的模型名
+func (r *Rewriter) NeedsModel(p string) bool {
+	return r.azure != nil && azureNeedsDeployment(p)
+}
+
+// ModelMissing 判断需要模型名的路径是否既没有模型名也没有默认部署
+func (r *Rewriter) ModelMissing(p string) bool {
+	return r.NeedsModel(p) && azureDeployment(r.azure, r.model) == ""
+}
+
+// SetModel 设置请求体中的模型名
+func (r *Rewriter) SetModel(name string) {
+	r.model = name
+}
+
+// SetVertex 设置Vertex请求的项目和访问令牌，改写路径时使用项目和区域，改写请求头时设置访问令牌
+func (r *Rewriter) SetVertex(opts *model.VertexOptions, project, token string) {
+	r.vertex = &vertexTarget{project: project, location: opts.Location, token: token}
+}
+
+// Path 改写转发路径
+func (r *Rewriter) Path(p string) string {
+	if r.azure != nil {
+		p = azurePath(r.azure, p, r.model)
+	}
+	if r.vertex != nil {
+		p = vertexPath(r.vertex.project, r.vertex.location, p)
+	}
+	for _, rule := range r.rules {
+		if rule.Path.StripPrefix != "" && strings.HasPrefix(p, rule.Path.StripPrefix) {
+			p = "/" + strings.TrimLeft(strings.TrimPrefix(p, rule.Path.StripPrefix), "/")
+		}
+		for _, rx := range rule.Path.Regex {
+			if re, err := compileRewriteRegexp(rx.Pattern); err == nil {
+				p = re.ReplaceAllString(p, rx.Replacement)
+			}
+		}
+		if rule.Path.AddPrefix != "" {
+			p = strings.TrimRight(rule.Path.AddPrefix, "/") + p
+		}
+	}
+	return p
+}
+
+// Query 改写查询参数，没有查询参数规则时原样返回，保留客户端的参数顺序
+func (r *Rewriter) Query(rawQuery string) string {
+	if !r.hasQueryRules() && r.azure == nil {
+		return rawQuery
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	if r.azure != nil {
+		azureQuery(r.azure, values)
+	}
+	for _, rule := range r.rules {
+		for _, key := range rule.Query.Remove {
+			values.Del(key)
+		}
+		for key, tmpl := range rule.Query.Set {
+			if value := r.expand(tmpl); value != "" {
+				values.Set(key, value)
+			}
+		}
+		for key, tmpl := range rule.Query.Default {
+			if values.Has(key) {
+				continue
+			}
+			if value := r.expand(tmpl); value != "" {
+				values.Set(key, value)
+			}
+		}
+	}
+	return values.Encode()
+}
+
+// RequestHeaders 改写发往上游的请求头
+func (r *Rewriter) RequestHeaders(header http.Header) {
+	for _, rule := range r.rules {
+		r.applyHeaders(rule.RequestHeaders, header)
+	}
+	if r.vertex != nil {
+		header.Set("Authorization", "Bearer "+r.vertex.token)
+	}
+}
+
+// ResponseHeaders 改写返回给客户端的响应头
+func (r *Rewriter) ResponseHeaders(header http.Header) {
+	for _, rule := range r.rules {
+		r.applyHeaders(rule.ResponseHeaders, header)
+	}
+}
+
+func (r *Rewriter) hasQueryRules() bool {
+	for _, rule := range r.rules {
+		if len(rule.Query.Remove) > 0 || len(rule.Query.Set) > 0 || len(rule.Query.Default) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaders 依次删除、设置、追加头，模板展开为空时不设置
+func (r *Rewriter) applyHeaders(rule model.HeaderRewrite, header http.Header) {
+	for _, key := range rule.Remove {
+		header.Del(key)
+	}
+	for key, tmpl := range rule.Set {
+		if value := r.expand(tmpl); value != "" {
+			header.Set(key, value)
+		}
+	}
+	for key, tmpl := range rule.Add {
+		if value := r.expand(tmpl); value != "" {
+			header.Add(key, value)
+		}
+	}
+}
+
+// expand 展开模板变量，模板中任一变量为空时返回空字符串
+func (r *Rewriter) expand(tmpl string) string {
+	empty := false
+	value := templatePattern.ReplaceAllStringFunc(tmpl, func(m string) string {
+		v := r.lookup(templatePattern.FindStringSubmatch(m)[1])
+		if v == "" {
+			empty = true
+		}
+		return v
+	})
+	if empty {
+		return ""
+	}
+	return value
+}
+
+func (r *Rewriter) lookup(name string) string {
+	switch {
+	case name == "client_key":
+		return r.ctx.ClientKey
+	case name == "request_id":
+		return r.ctx.RequestID
+	case strings.HasPrefix(name, "env."+rewriteEnvPrefix):
+		return os.Getenv(strings.TrimPrefix(name, "env."))
+	}
+	return ""
+}
+
+// ClientKey 提取客户端携带的API Key，依次查找Authorization、x-api-key、x-goog-api-key、api-key头和key查询参数
+func ClientKey(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	for _, name := range []string{"x-api-key", "x-goog-api-key", "api-key"} {
+		if key := req.Header.Get(name); key != "" {
+			return key
+		}
+	}
+	return req.URL.Query().Get("key")
+}
+
+func compileRewriteRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := rewriteRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	rewriteRegexps.Store(pattern, re)
+	return re, nil
+}
+
+// validateRewrite 校验改写规则中的正则、路径前缀和模板变量
+func validateRewrite(rules model.RewriteRules, verr *ValidationError) {
+	for i, rx := range rules.Path.Regex {
+		if _, err := regexp.Compile(rx.Pattern); err != nil {
+			verr.add(fmt.Sprintf("rewrite.path.regex[%d].pattern", i), "正则表达式无效: %v", err)
+		}
+	}
+	if p := rules.Path.StripPrefix; p != "" && !strings.HasPrefix(p, "/") {
+		verr.add("rewrite.path.strip_prefix", "需以/开头")
+	}
+	if p := rules.Path.AddPrefix; p != "" && !strings.HasPrefix(p, "/") {
+		verr.add("rewrite.path.add_prefix", "需以/开头")
+	}
+	templates := []struct {
+		field  string
+		values map[string]string
+	}{
+		{"rewrite.request_headers.set", rules.RequestHeaders.Set},
+		{"rewrite.request_headers.add", rules.RequestHeaders.Add},
+		{"rewrite.response_headers.set", rules.ResponseHeaders.Set},
+		{"rewrite.response_headers.add", rules.ResponseHeaders.Add},
+		{"rewrite.query.set", rules.Query.Set},
+		{"rewrite.query.default", rules.Query.Default},
+	}
+	for _, t := range templates {
+		field, values := t.field, t.values
+		for key, tmpl := range values {
+			if key == "" {
+				verr.add(field, "名称不能为空")
+			}
+			for _, m := range templatePattern.FindAllStringSubmatch(tmpl, -1) {
+				name := m[1]
+				if name != "client_key" && name != "request_id" && !strings.HasPrefix(name, "env."+rewriteEnvPrefix) {
+					verr.add(field, "%s: 不支持的模板变量 ${%s}，环境变量需以%s开头", key, name, rewriteEnvPrefix)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"sync"
+
+	"AI-PROXY/config"
+	"AI-PROXY/util"
+)
+
+// 派生凭据加密密钥的盐值，密钥本身来自配置，固定盐值不影响安全性
+var secretKeySalt = []byte("ai-proxy/api-config-secret")
+
+// ErrNoEncryptionKey 未配置凭据加密密钥
+var ErrNoEncryptionKey = errors.New("未配置auth.encryption_key，无法保存凭据")
+
+// 派生密钥开销较大，按配置的密钥缓存
+var (
+	secretKeyMu     sync.Mutex
+	secretKeySource string
+	secretKeyCache  []byte
+)
+
+// secretKey 返回由auth.encryption_key派生的密钥，未配置时返回ErrNoEncryptionKey
+func secretKey() ([]byte, error) {
+	cfg := config.Get()
+	if cfg == nil || cfg.Auth.EncryptionKey == "" {
+		return nil, ErrNoEncryptionKey
+	}
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	if secretKeyCache != nil && secretKeySource == cfg.Auth.EncryptionKey {
+		return secretKeyCache, nil
+	}
+	key, err := util.DeriveKey(cfg.Auth.EncryptionKey, secretKeySalt)
+	if err != nil {
+		return nil, err
+	}
+	secretKeySource, secretKeyCache = cfg.Auth.EncryptionKey, key
+	return key, nil
+}
+
+// sealSecret 加密凭据，空值和已加密的值原样返回
+func sealSecret(value string) (string, error) {
+	if value == "" || util.IsEncrypted(value) {
+		return value, nil
+	}
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	return util.Encrypt(key, value)
+}
+
+// OpenSecret 解密凭据，未加密的值（如测试数据）原样返回
+func OpenSecret(value string) (string, error) {
+	if !util.IsEncrypted(value) {
+		return value, nil
+	}
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	return util.Decrypt(key, value)
+}
@@ -0,0 +1,33 @@
+package service
+
+import "AI-PROXY/repository"
+
+var (
+	// ErrNotFound 记录不存在
+	ErrNotFound = repository.ErrNotFound
+	// ErrVersionConflict 记录已被其他人修改
+	ErrVersionConflict = repository.ErrVersionConflict
+)
+
+// Services 汇总所有service，由main创建后注入controller层
+type Services struct {
+	APIConfig  *APIConfigService
+	Cluster    *ClusterService
+	Auth       *AuthService
+	Audit      *AuditService
+	RequestLog *RequestLogService
+}
+
+// New 基于存储创建所有service
+func New(store *repository.Store) *Services {
+	instanceID := newInstanceID()
+	audit := NewAuditService(store.AuditLogs)
+	apiConfig := NewAPIConfigService(store, audit, instanceID)
+	return &Services{
+		APIConfig:  apiConfig,
+		Cluster:    NewClusterService(instanceID, store.ConfigChanges, store.Instances, apiConfig),
+		Auth:       NewAuthService(store.AdminUsers, store.AdminSessions, audit),
+		Audit:      audit,
+		RequestLog: NewRequestLogService(store.RequestLogs),
+	}
+}
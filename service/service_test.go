@@ -0,0 +1,29 @@
+package service_test
+
+import (
+	"testing"
+
+	"AI-PROXY/config"
+	"AI-PROXY/repository"
+	"AI-PROXY/service"
+	"AI-PROXY/util"
+)
+
+// 测试使用的操作人
+var testActor = service.Actor{Name: "tester", IP: "127.0.0.1"}
+
+// newTestServices 基于内存存储创建所有service
+func newTestServices(t *testing.T) (*service.Services, *repository.Store) {
+	t.Helper()
+	util.InitLogger(&config.LogConfig{Level: "error"})
+	store := repository.NewMemoryStore()
+	return service.New(store), store
+}
+
+// setTestConfig 替换当前配置，测试结束后恢复
+func setTestConfig(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	old := config.Get()
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(old) })
+}
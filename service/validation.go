@@ -0,0 +1,249 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"AI-PROXY/model"
+	"AI-PROXY/util"
+)
+
+// API名称只能包含字母、数字、点、下划线和连字符，需以字母或数字开头，长度与数据库列一致
+var apiNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,49}$`)
+
+// 供应商类型只能包含小写字母、数字和连字符
+var providerPattern = regexp.MustCompile(`^[a-z0-9-]{0,20}$`)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 参数校验错误，列出每个不合法的字段
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "参数校验失败: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// defaultReservedNames 内置路由的第一段路径，创建service时即登记，
+// 保证启动同步、命令行同步等在路由注册之前发生的写入同样不能使用这些名称
+var defaultReservedNames = []string{"admin", "health", "css", "js", "assets", "pages", "favicon.ico", "v1"}
+
+// ReserveNames 登记与管理后台、静态资源等路由冲突的名称，这些名称不能作为API名称，不区分大小写
+func (s *APIConfigService) ReserveNames(names ...string) {
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	if s.reserved == nil {
+		s.reserved = make(map[string]bool)
+	}
+	for _, name := range names {
+		s.reserved[strings.ToLower(name)] = true
+	}
+}
+
+// ReservedNameConflicts 返回数据库中与保留名称冲突的API，通常是新版本新增保留名称前已创建的API，
+// 这些API无法匹配代理路由，也无法再按原名更新或回滚，需要改名
+func (s *APIConfigService) ReservedNameConflicts() ([]string, error) {
+	configs, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, c := range configs {
+		if s.isReserved(c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+	return names, nil
+}
+
+func (s *APIConfigService) isReserved(name string) bool {
+	s.reservedMu.RLock()
+	defer s.reservedMu.RUnlock()
+	return s.reserved[strings.ToLower(name)]
+}
+
+// validateAPIConfig 校验API配置并规范化base_url，创建、更新和批量导入共用；
+// partial为true时只校验非空字段，用于零值表示不修改的更新
+func (s *APIConfigService) validateAPIConfig(config *model.APIConfig, partial bool) error {
+	verr := &ValidationError{}
+
+	switch {
+	case config.Name == "":
+		if !partial {
+			verr.add("name", "不能为空")
+		}
+	case !apiNamePattern.MatchString(config.Name):
+		verr.add("name", "只能包含字母、数字、点、下划线和连字符，以字母或数字开头，最长50个字符")
+	case s.isReserved(config.Name):
+		verr.add("name", "%s 与系统路由冲突，不能作为API名称", config.Name)
+	}
+
+	if config.BaseURL == "" {
+		if !partial {
+			verr.add("base_url", "不能为空")
+		}
+	} else if normalized, err := NormalizeBaseURL(config.BaseURL); err != nil {
+		verr.add("base_url", "%s", err.Error())
+	} else {
+		config.BaseURL = normalized
+		// 提前检查出站策略，便于管理员及时发现问题；域名解析后的地址在代理拨号时检查。
+		// allow_internal只放开地址段限制，主机和端口的允许列表仍然生效。
+		// 部分更新时调用方需先把allow_internal合并为最终值
+		if err := checkBaseURLEgress(normalized, config.AllowInternal); err != nil {
+			if config.AllowInternal {
+				verr.add("base_url", "%s", err.Error())
+			} else {
+				verr.add("base_url", "%s，如确需访问内网请设置allow_internal", err.Error())
+			}
+		}
+	}
+
+	if len([]rune(config.Description)) > 255 {
+		verr.add("description", "不能超过255个字符")
+	}
+	if !providerPattern.MatchString(config.Provider) {
+		verr.add("provider", "只能包含小写字母、数字和连字符，最长20个字符")
+	}
+	if config.MaxBodySize < 0 {
+		verr.add("max_body_size", "不能为负数")
+	}
+	validateAccessRules(config.AccessRules, verr)
+	validateRequestPolicy(config.RequestPolicy, verr)
+	validateRewrite(config.Rewrite, verr)
+	validateProviderOptions(config, partial, verr)
+	if sealed, err := sealSecret(config.Secret); err != nil {
+		verr.add("secret", "%s", err.Error())
+	} else if _, err := OpenSecret(sealed); err != nil {
+		verr.add("secret", "无法使用当前auth.encryption_key解密: %v", err)
+	} else {
+		config.Secret = sealed
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// checkBaseURLEgress 按出站策略检查规范化后的基础url的主机和端口，allowInternal为true时不检查地址段
+func checkBaseURLEgress(baseURL string, allowInternal bool) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	if allowInternal {
+		return util.CheckEgressAllowlist(u.Hostname(), port)
+	}
+	return util.CheckEgressHost(u.Hostname(), port)
+}
+
+// NormalizeBaseURL 校验并规范化上游基础url：未写协议时补https，协议和主机名转为小写，去掉末尾的/；
+// 只允许http/https，不允许携带用户信息、查询参数和片段
+func NormalizeBaseURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("格式错误: %v", err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("只支持http和https协议")
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("缺少主机名")
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("不能包含用户名和密码")
+	}
+	if u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(raw, "?") {
+		return "", fmt.Errorf("不能包含查询参数或片段")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return "", fmt.Errorf("端口无效: %s", port)
+		}
+	}
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	} else if net.ParseIP(host) == nil && strings.ContainsAny(host, " _") {
+		return "", fmt.Errorf("主机名无效: %s", u.Hostname())
+	}
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// validateProviderOptions 校验provider对应的专属配置，partial为true时不要求必填
+func validateProviderOptions(config *model.APIConfig, partial bool, verr *ValidationError) {
+	opts := config.ProviderOptions
+	if opts.Azure != nil {
+		validateAzureOptions(opts.Azure, verr)
+	}
+	if opts.Bedrock != nil {
+		validateBedrockOptions(opts.Bedrock, verr)
+	}
+	if opts.Vertex != nil {
+		validateVertexOptions(opts.Vertex, verr)
+	}
+	if opts.Local != nil {
+		validateLocalOptions(opts.Local, verr)
+	}
+	if config.Provider == ProviderVertex && config.Secret != "" {
+		validateVertexSecret(opts.Vertex, config.Secret, verr)
+	}
+	if partial {
+		return
+	}
+	switch config.Provider {
+	case ProviderAzure:
+		if opts.Azure == nil {
+			verr.add("provider_options.azure", "provider为azure时不能为空")
+		}
+	case ProviderBedrock:
+		if opts.Bedrock == nil {
+			verr.add("provider_options.bedrock", "provider为bedrock时不能为空")
+		}
+		if config.Secret == "" {
+			verr.add("secret", "provider为bedrock时需要填写Secret Access Key")
+		}
+	case ProviderVertex:
+		if opts.Vertex == nil {
+			verr.add("provider_options.vertex", "provider为vertex时不能为空")
+		}
+		if config.Secret == "" {
+			verr.add("secret", "provider为vertex时需要填写服务账号JSON密钥")
+		}
+	}
+}
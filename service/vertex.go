@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"AI-PROXY/model"
+)
+
+// ProviderVertex Google Vertex AI
+const ProviderVertex = "vertex"
+
+const (
+	// vertexDefaultTokenURL 服务账号未指定token_uri时使用的令牌地址
+	vertexDefaultTokenURL = "https://oauth2.googleapis.com/token"
+	vertexScope           = "https://www.googleapis.com/auth/cloud-platform"
+	vertexGrantType       = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// vertexTokenRefreshMargin 令牌剩余有效期不足该时长时提前换取新令牌
+	vertexTokenRefreshMargin = 5 * time.Minute
+	// vertexAssertionLifetime JWT断言的有效期，Google允许的最大值
+	vertexAssertionLifetime = time.Hour
+)
+
+var (
+	vertexLocationPattern = regexp.MustCompile(`^[a-z0-9-]{1,40}$`)
+	vertexProjectPattern  = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	// Gemini API的模型路径，如 /v1beta/models/gemini-pro:generateContent
+	vertexModelPathPattern = regexp.MustCompile(`^/(v1|v1beta)/(models/.+)$`)
+)
+
+// ServiceAccount 服务账号JSON密钥中用到的字段
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// ParseServiceAccount 解析服务账号JSON密钥
+func ParseServiceAccount(data string) (*ServiceAccount, error) {
+	var account ServiceAccount
+	if err := json.Unmarshal([]byte(data), &account); err != nil {
+		return nil, errors.New("不是有效的JSON")
+	}
+	if account.Type != "service_account" {
+		return nil, errors.New("type需为service_account")
+	}
+	if account.ClientEmail == "" {
+		return nil, errors.New("缺少client_email")
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("private_key不是PEM格式")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析private_key失败: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key需为RSA私钥")
+	}
+	account.key = rsaKey
+	return &account, nil
+}
+
+// vertexAccount 缓存的服务账号，secret用于识别未经版本号变化的凭据替换
+type vertexAccount struct {
+	version int
+	secret  string
+	account *ServiceAccount
+}
+
+// 按API名称缓存解析后的服务账号，避免每个请求都解密凭据和解析私钥
+var vertexAccounts sync.Map
+
+// VertexServiceAccount 返回API的服务账号，API的版本或凭据变化后重新解析
+func VertexServiceAccount(apiConfig *model.APIConfig) (*ServiceAccount, error) {
+	if entry, ok := vertexAccounts.Load(apiConfig.Name); ok {
+		cached := entry.(*vertexAccount)
+		if cached.version == apiConfig.Version && cached.secret == apiConfig.Secret {
+			return cached.account, nil
+		}
+	}
+	plain, err := OpenSecret(apiConfig.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("解密凭据失败: %v", err)
+	}
+	account, err := ParseServiceAccount(plain)
+	if err != nil {
+		return nil, err
+	}
+	vertexAccounts.Store(apiConfig.Name, &vertexAccount{version: apiConfig.Version, secret: apiConfig.Secret, account: account})
+	return account, nil
+}
+
+// VertexProject 返回请求使用的项目ID，配置中未指定时使用服务账号所属的项目
+func VertexProject(opts *model.VertexOptions, account *ServiceAccount) string {
+	if opts.ProjectID != "" {
+		return opts.ProjectID
+	}
+	return account.ProjectID
+}
+
+// vertexTokenURL 返回令牌地址，依次使用配置、服务账号中的token_uri和Google默认地址
+func vertexTokenURL(opts *model.VertexOptions, account *ServiceAccount) string {
+	if opts.TokenURL != "" {
+		return opts.TokenURL
+	}
+	if account.TokenURI != "" {
+		return account.TokenURI
+	}
+	return vertexDefaultTokenURL
+}
+
+// vertexPath 把Gemini API的模型路径转换为Vertex的发布方模型路径，v1beta对应Vertex的v1beta1；
+// 客户端直接使用/projects/路径或其他路径时原样转发
+func vertexPath(project, location, p string) string {
+	m := vertexModelPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return p
+	}
+	version := "v1"
+	if m[1] == "v1beta" {
+		version = "v1beta1"
+	}
+	return fmt.Sprintf("/%s/projects/%s/locations/%s/publishers/google/%s",
+		version, url.PathEscape(project), url.PathEscape(location), m[2])
+}
+
+// vertexToken 缓存的访问令牌，mu保证同一服务账号同时只换取一次令牌
+type vertexToken struct {
+	mu     sync.Mutex
+	value  string
+	expiry time.Time
+}
+
+// 按服务账号、私钥和令牌地址缓存访问令牌
+var vertexTokens sync.Map
+
+// VertexAccessToken 返回服务账号的访问令牌，缓存的令牌快过期时使用JWT断言换取新令牌，
+// client用于请求令牌地址，应与转发请求使用相同的出站策略
+func VertexAccessToken(ctx context.Context, client *http.Client, opts *model.VertexOptions, account *ServiceAccount) (string, error) {
+	tokenURL := vertexTokenURL(opts, account)
+	cacheKey := account.ClientEmail + "|" + account.PrivateKeyID + "|" + tokenURL
+	entry, _ := vertexTokens.LoadOrStore(cacheKey, &vertexToken{})
+	token := entry.(*vertexToken)
+
+	token.mu.Lock()
+	defer token.mu.Unlock()
+	if token.value != "" && time.Until(token.expiry) > vertexTokenRefreshMargin {
+		return token.value, nil
+	}
+	value, expiry, err := fetchVertexToken(ctx, client, tokenURL, account)
+	if err != nil {
+		return "", err
+	}
+	token.value, token.expiry = value, expiry
+	return value, nil
+}
+
+// fetchVertexToken 使用服务账号签名的JWT断言向令牌地址换取访问令牌
+func fetchVertexToken(ctx context.Context, client *http.Client, tokenURL string, account *ServiceAccount) (string, time.Time, error) {
+	now := time.Now()
+	assertion, err := signServiceAccountJWT(account, tokenURL, now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	form := url.Values{"grant_type": {vertexGrantType}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("令牌地址返回%d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.AccessToken == "" {
+		return "", time.Time{}, errors.New("令牌地址返回的内容中没有access_token")
+	}
+	if result.ExpiresIn <= 0 {
+		result.ExpiresIn = int64(vertexAssertionLifetime / time.Second)
+	}
+	return result.AccessToken, now.Add(time.Duration(result.ExpiresIn) * time.Second), nil
+}
+
+// signServiceAccountJWT 生成RS256签名的JWT断言，aud为令牌地址
+func signServiceAccountJWT(account *ServiceAccount, audience string, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": account.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": vertexScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(vertexAssertionLifetime).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, account.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("签名JWT失败: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// validateVertexOptions 校验Vertex配置
+func validateVertexOptions(opts *model.VertexOptions, verr *ValidationError) {
+	if !vertexLocationPattern.MatchString(opts.Location) {
+		verr.add("provider_options.vertex.location", "区域格式无效，如us-central1")
+	}
+	if opts.ProjectID != "" && !vertexProjectPattern.MatchString(opts.ProjectID) {
+		verr.add("provider_options.vertex.project_id", "项目ID格式无效")
+	}
+	if opts.TokenURL != "" {
+		if u, err := url.Parse(opts.TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			verr.add("provider_options.vertex.token_url", "需为http或https地址")
+		}
+	}
+}
+
+// validateVertexSecret 校验服务账号JSON密钥，配置中未指定项目ID时服务账号需包含project_id
+func validateVertexSecret(opts *model.VertexOptions, secret string, verr *ValidationError) {
+	plain, err := OpenSecret(secret)
+	if err != nil {
+		// 无法解密的情况由secret的统一校验报告
+		return
+	}
+	account, err := ParseServiceAccount(plain)
+	if err != nil {
+		verr.add("secret", "服务账号JSON密钥无效: %v", err)
+		return
+	}
+	if opts != nil && VertexProject(opts, account) == "" {
+		verr.add("provider_options.vertex.project_id", "服务账号中没有project_id时不能为空")
+	}
+}
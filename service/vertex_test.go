@@ -0,0 +1,57 @@
+package service_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"AI-PROXY/model"
+	"AI-PROXY/service"
+)
+
+// newServiceAccountJSON 生成一个测试用的服务账号JSON密钥
+func newServiceAccountJSON(t *testing.T, keyID string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": keyID,
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "proxy@test-project.iam.gserviceaccount.com",
+	})
+	return string(data)
+}
+
+func TestVertexServiceAccountCache(t *testing.T) {
+	first := newServiceAccountJSON(t, "key-1")
+	apiConfig := &model.APIConfig{Name: "vertex-cache", Provider: service.ProviderVertex, Version: 1, Secret: first}
+
+	a, err := service.VertexServiceAccount(apiConfig)
+	if err != nil {
+		t.Fatalf("解析服务账号失败: %v", err)
+	}
+	b, _ := service.VertexServiceAccount(apiConfig)
+	if a != b {
+		t.Error("同一版本应复用缓存的服务账号")
+	}
+
+	// 更换凭据后版本号加一，重新解析
+	apiConfig.Secret, apiConfig.Version = newServiceAccountJSON(t, "key-2"), 2
+	c, err := service.VertexServiceAccount(apiConfig)
+	if err != nil || c.PrivateKeyID != "key-2" {
+		t.Errorf("更换凭据后的服务账号 = %+v, err = %v", c, err)
+	}
+
+	apiConfig.Secret, apiConfig.Version = "not json", 3
+	if _, err := service.VertexServiceAccount(apiConfig); err == nil {
+		t.Error("无效的凭据应返回错误")
+	}
+}
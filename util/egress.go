@@ -0,0 +1,175 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"AI-PROXY/config"
+)
+
+// 默认禁止访问的地址段：回环、内网、链路本地（含云厂商元数据地址169.254.169.254）、运营商NAT、保留地址等
+var deniedPrefixes = mustParsePrefixes(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// EgressError 出站请求被策略拒绝
+type EgressError struct {
+	Reason string
+}
+
+func (e *EgressError) Error() string {
+	return "出站策略拒绝: " + e.Reason
+}
+
+// IsEgressDenied 判断错误是否由出站策略拒绝导致
+func IsEgressDenied(err error) bool {
+	var eerr *EgressError
+	return errors.As(err, &eerr)
+}
+
+// CheckEgressHost 按当前配置检查上游主机名和端口是否在允许列表中，主机为IP时同时检查地址段
+func CheckEgressHost(host, port string) error {
+	if err := CheckEgressAllowlist(host, port); err != nil {
+		return err
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return CheckEgressIP(ip)
+	}
+	return nil
+}
+
+// CheckEgressAllowlist 只检查主机名和端口的允许列表，不检查地址段，设置了allow_internal的API同样受其约束
+func CheckEgressAllowlist(host, port string) error {
+	policy := egressPolicy()
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if len(policy.AllowedHosts) > 0 && !matchHost(policy.AllowedHosts, host) {
+		return &EgressError{Reason: fmt.Sprintf("主机 %s 不在允许列表中", host)}
+	}
+	if len(policy.AllowedPorts) > 0 {
+		n, _ := strconv.Atoi(port)
+		allowed := false
+		for _, p := range policy.AllowedPorts {
+			if p == n {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &EgressError{Reason: fmt.Sprintf("端口 %s 不在允许列表中", port)}
+		}
+	}
+	return nil
+}
+
+// CheckEgressIP 检查解析后的IP是否属于禁止访问的地址段
+func CheckEgressIP(ip netip.Addr) error {
+	if egressPolicy().AllowPrivate {
+		return nil
+	}
+	ip = ip.Unmap()
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(ip) {
+			return &EgressError{Reason: fmt.Sprintf("禁止访问内网或保留地址 %s", ip)}
+		}
+	}
+	return nil
+}
+
+// NewEgressTransport 创建受出站策略约束的Transport：拨号时解析DNS并逐个检查IP，只连接检查通过的地址，
+// 防止DNS重绑定；不使用环境变量中的代理。exempt为true时只检查主机和端口的允许列表，不限制地址段，
+// 用于明确允许访问内网的API，两类请求必须使用不同的Transport，避免复用对方的连接
+func NewEgressTransport(exempt bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if exempt {
+			if err := CheckEgressAllowlist(host, port); err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if err := CheckEgressHost(host, port); err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			if err := CheckEgressIP(ip); err != nil {
+				lastErr = err
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("无法解析主机: %s", host)
+		}
+		return nil, lastErr
+	}
+	return transport
+}
+
+// egressPolicy 读取当前出站策略，未加载配置时使用默认策略
+func egressPolicy() config.EgressConfig {
+	if cfg := config.Get(); cfg != nil {
+		return cfg.Egress
+	}
+	return config.EgressConfig{}
+}
+
+// matchHost 匹配主机名，*.example.com匹配所有子域名（不含example.com本身）
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		parsed[i] = netip.MustParsePrefix(p)
+	}
+	return parsed
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"AI-PROXY/config"
+)
+
+func TestEgressTransportExempt(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	host, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	prev := config.Get()
+	t.Cleanup(func() { config.Set(prev) })
+	tests := []struct {
+		name       string
+		egress     config.EgressConfig
+		exempt     bool
+		wantDenied bool
+	}{
+		{"默认禁止回环地址", config.EgressConfig{}, false, true},
+		{"豁免时允许回环地址", config.EgressConfig{}, true, false},
+		{"豁免时主机在允许列表中", config.EgressConfig{AllowedHosts: []string{host}}, true, false},
+		{"豁免时仍检查主机允许列表", config.EgressConfig{AllowedHosts: []string{"api.openai.com"}}, true, true},
+		{"豁免时仍检查端口允许列表", config.EgressConfig{AllowedPorts: []int{443}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{Egress: tt.egress})
+			client := &http.Client{Transport: NewEgressTransport(tt.exempt)}
+			resp, err := client.Get("http://" + net.JoinHostPort(host, port))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if IsEgressDenied(err) != tt.wantDenied {
+				t.Errorf("err = %v, wantDenied %v", err, tt.wantDenied)
+			}
+			if !tt.wantDenied && err != nil {
+				t.Errorf("请求失败: %v", err)
+			}
+		})
+	}
+}
@@ -3,36 +3,156 @@ package util
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"AI-PROXY/config"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Logger 应用日志
 var Logger *logrus.Logger
 
-// InitLogger 初始化日志，支持同时输出到控制台和文件
+// AccessLogger 访问日志，未单独配置时与Logger相同
+var AccessLogger *logrus.Logger
+
+var (
+	sinksMu sync.Mutex
+	sinks   []*logSink
+)
+
+// logSink 一个带轮转的日志输出目标
+type logSink struct {
+	file *lumberjack.Logger
+	stop chan struct{}
+}
+
+// InitLogger 初始化日志，支持同时输出到控制台和文件，文件按大小/时间轮转
 func InitLogger(logConfig *config.LogConfig) error {
-	Logger = logrus.New()
-	level, err := logrus.ParseLevel(logConfig.Level)
+	CloseLogger()
+
+	logger, err := newLogger(logConfig)
+	Logger = logger
+	AccessLogger = logger
 	if err != nil {
-		level = logrus.InfoLevel
+		return err
 	}
-	Logger.SetLevel(level)
-	Logger.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
 
-	// 打开日志文件
+	if logConfig.Access != nil {
+		access := *logConfig.Access
+		if access.Level == "" {
+			access.Level = logConfig.Level
+		}
+		accessLogger, err := newLogger(&access)
+		AccessLogger = accessLogger
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLogLevel 动态调整日志级别，用于配置热重载
+func SetLogLevel(logConfig *config.LogConfig) {
+	Logger.SetLevel(parseLevel(logConfig.Level))
+	if AccessLogger != Logger {
+		level := logConfig.Level
+		if logConfig.Access != nil && logConfig.Access.Level != "" {
+			level = logConfig.Access.Level
+		}
+		AccessLogger.SetLevel(parseLevel(level))
+	}
+}
+
+// CloseLogger 关闭所有日志文件并停止定时轮转
+func CloseLogger() {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		close(s.stop)
+		s.file.Close()
+	}
+	sinks = nil
+}
+
+// newLogger 按配置创建一个logger，文件打开失败时退化为只输出到控制台
+func newLogger(logConfig *config.LogConfig) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.SetLevel(parseLevel(logConfig.Level))
+	logger.SetFormatter(newFormatter(logConfig.Format))
+	logger.SetOutput(os.Stdout)
+
+	if logConfig.FilePath == "" {
+		return logger, nil
+	}
+	// 提前创建目录，确保文件可写
+	if err := os.MkdirAll(filepath.Dir(logConfig.FilePath), 0755); err != nil {
+		return logger, err
+	}
 	file, err := os.OpenFile(logConfig.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		Logger.SetOutput(os.Stdout)
-		return err
+		return logger, err
 	}
+	file.Close()
+
+	sink := &logSink{
+		file: &lumberjack.Logger{
+			Filename:   logConfig.FilePath,
+			MaxSize:    logConfig.MaxSize,
+			MaxBackups: logConfig.MaxBackups,
+			MaxAge:     logConfig.MaxAge,
+			Compress:   logConfig.Compress,
+			LocalTime:  true,
+		},
+		stop: make(chan struct{}),
+	}
+	if logConfig.RotateHours > 0 {
+		go sink.rotateEvery(time.Duration(logConfig.RotateHours) * time.Hour)
+	}
+	sinksMu.Lock()
+	sinks = append(sinks, sink)
+	sinksMu.Unlock()
+
 	// 同时输出到控制台和文件
-	mw := io.MultiWriter(os.Stdout, file)
-	Logger.SetOutput(mw)
-	return nil
+	logger.SetOutput(io.MultiWriter(os.Stdout, sink.file))
+	return logger, nil
+}
+
+// rotateEvery 按固定时间间隔轮转日志文件
+func (s *logSink) rotateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.file.Rotate()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func newFormatter(format string) logrus.Formatter {
+	if format == "text" {
+		return &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		}
+	}
+	return &logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02 15:04:05",
+	}
+}
+
+func parseLevel(s string) logrus.Level {
+	level, err := logrus.ParseLevel(s)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
 }
 
 // 记录请求日志
@@ -46,8 +166,39 @@ func LogRequest(apiName, method, path string, statusCode int, responseTime int64
 		"error_message": errorMessage,
 	}
 	if statusCode >= 200 && statusCode < 400 {
-		Logger.WithFields(fields).Info("请求成功")
+		AccessLogger.WithFields(fields).Info("请求成功")
 	} else {
-		Logger.WithFields(fields).Error("请求失败")
+		AccessLogger.WithFields(fields).Error("请求失败")
 	}
 }
+
+// WebSocketSession 一次WebSocket会话的统计，字节数包含帧头，消息数只统计文本和二进制消息
+type WebSocketSession struct {
+	APIName          string
+	Path             string
+	ClientIP         string
+	Duration         int64 // 持续时间（毫秒）
+	ClientBytes      int64 // 客户端发往上游的字节数
+	ClientMessages   int64
+	UpstreamBytes    int64 // 上游发往客户端的字节数
+	UpstreamMessages int64
+	CloseReason      string
+}
+
+// 记录WebSocket会话日志
+func LogWebSocketSession(s WebSocketSession) {
+	AccessLogger.WithFields(logrus.Fields{
+		"api_name":          s.APIName,
+		"method":            "GET",
+		"path":              s.Path,
+		"status_code":       101,
+		"response_time":     s.Duration,
+		"client_ip":         s.ClientIP,
+		"websocket":         true,
+		"client_bytes":      s.ClientBytes,
+		"client_messages":   s.ClientMessages,
+		"upstream_bytes":    s.UpstreamBytes,
+		"upstream_messages": s.UpstreamMessages,
+		"close_reason":      s.CloseReason,
+	}).Info("WebSocket会话结束")
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AI-PROXY/config"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// initTestLogger 初始化日志，测试结束后关闭日志文件并恢复原来的logger
+func initTestLogger(t *testing.T, logConfig *config.LogConfig) {
+	t.Helper()
+	prevLogger, prevAccess := Logger, AccessLogger
+	t.Cleanup(func() {
+		CloseLogger()
+		Logger, AccessLogger = prevLogger, prevAccess
+	})
+	if err := InitLogger(logConfig); err != nil {
+		t.Fatalf("初始化日志失败: %v", err)
+	}
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	return string(data)
+}
+
+func TestInitLoggerAccessFallback(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "proxy.log")
+	initTestLogger(t, &config.LogConfig{Level: "info", FilePath: mainPath})
+
+	if AccessLogger != Logger {
+		t.Fatal("未配置access时访问日志应与应用日志共用")
+	}
+	LogRequest("openai", "POST", "/v1/chat/completions", 200, 12, "")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(readLog(t, mainPath))), &entry); err != nil {
+		t.Fatalf("默认应输出JSON格式: %v", err)
+	}
+	if entry["msg"] != "请求成功" || entry["api_name"] != "openai" {
+		t.Errorf("访问日志 = %v", entry)
+	}
+}
+
+func TestInitLoggerAccessSink(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "proxy.log")
+	accessPath := filepath.Join(dir, "access", "access.log")
+	initTestLogger(t, &config.LogConfig{
+		Level:    "info",
+		FilePath: mainPath,
+		Format:   "json",
+		Access:   &config.LogConfig{FilePath: accessPath, Format: "text"},
+	})
+
+	if AccessLogger == Logger {
+		t.Fatal("配置access后访问日志应单独输出")
+	}
+	// 未设置access.level时沿用应用日志的级别
+	if AccessLogger.GetLevel() != logrus.InfoLevel {
+		t.Errorf("访问日志级别 = %v, want info", AccessLogger.GetLevel())
+	}
+	Logger.Info("应用日志")
+	LogRequest("openai", "POST", "/v1/chat/completions", 502, 12, "上游错误")
+
+	mainLog, accessLog := readLog(t, mainPath), readLog(t, accessPath)
+	if !strings.HasPrefix(mainLog, "{") || strings.Contains(mainLog, "openai") {
+		t.Errorf("应用日志应为JSON且不包含访问日志: %s", mainLog)
+	}
+	if strings.HasPrefix(accessLog, "{") || !strings.Contains(accessLog, "level=error") || !strings.Contains(accessLog, "api_name=openai") {
+		t.Errorf("访问日志应为text格式: %s", accessLog)
+	}
+	if strings.Contains(accessLog, "应用日志") {
+		t.Errorf("访问日志不应包含应用日志: %s", accessLog)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	dir := t.TempDir()
+	logConfig := &config.LogConfig{
+		Level:    "info",
+		FilePath: filepath.Join(dir, "proxy.log"),
+		Access:   &config.LogConfig{FilePath: filepath.Join(dir, "access.log"), Level: "warn"},
+	}
+	initTestLogger(t, logConfig)
+
+	Logger.Debug("调整前")
+	SetLogLevel(&config.LogConfig{Level: "debug", Access: &config.LogConfig{Level: "error"}})
+	Logger.Debug("调整后")
+	if Logger.GetLevel() != logrus.DebugLevel || AccessLogger.GetLevel() != logrus.ErrorLevel {
+		t.Errorf("日志级别 = %v/%v, want debug/error", Logger.GetLevel(), AccessLogger.GetLevel())
+	}
+	mainLog := readLog(t, logConfig.FilePath)
+	if strings.Contains(mainLog, "调整前") || !strings.Contains(mainLog, "调整后") {
+		t.Errorf("应用日志 = %s", mainLog)
+	}
+
+	// access.level为空时访问日志跟随应用日志的级别，无效级别按info处理
+	SetLogLevel(&config.LogConfig{Level: "bogus", Access: &config.LogConfig{}})
+	if Logger.GetLevel() != logrus.InfoLevel || AccessLogger.GetLevel() != logrus.InfoLevel {
+		t.Errorf("日志级别 = %v/%v, want info/info", Logger.GetLevel(), AccessLogger.GetLevel())
+	}
+}
+
+func TestLoggerRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.log")
+	initTestLogger(t, &config.LogConfig{Level: "info", FilePath: path, MaxSize: 1})
+	Logger.SetOutput(sinks[0].file) // 只写文件，避免大量输出到控制台
+
+	line := strings.Repeat("x", 300<<10)
+	for i := 0; i < 4; i++ {
+		Logger.Info(line)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "proxy-*.log"))
+	if len(backups) == 0 {
+		t.Error("超过max_size后应轮转日志文件")
+	}
+}
+
+func TestLoggerRotateEvery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.log")
+	s := &logSink{file: &lumberjack.Logger{Filename: path}, stop: make(chan struct{})}
+	defer s.file.Close()
+	s.file.Write([]byte("before\n"))
+
+	go s.rotateEvery(10 * time.Millisecond)
+	defer close(s.stop)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		backups, _ := filepath.Glob(filepath.Join(dir, "proxy-*.log"))
+		if len(backups) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("到达轮转间隔后应轮转日志文件")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
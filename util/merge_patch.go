@@ -0,0 +1,22 @@
+package util
+
+// MergePatch 按RFC 7396 JSON Merge Patch语义把patch合并到doc：
+// null表示删除字段，对象递归合并，其他值直接替换。doc会被原地修改并返回
+func MergePatch(doc, patch map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		if patchObj, ok := value.(map[string]interface{}); ok {
+			target, _ := doc[key].(map[string]interface{})
+			doc[key] = MergePatch(target, patchObj)
+			continue
+		}
+		doc[key] = value
+	}
+	return doc
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 日志中需要隐藏的凭据请求头
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"X-Api-Key",
+	"Api-Key",
+	"X-Goog-Api-Key",
+	"X-Amz-Security-Token",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// 日志中需要隐藏的凭据查询参数
+var sensitiveQueryParams = []string{"key", "api_key", "api-key", "access_token", "token"}
+
+const redacted = "[REDACTED]"
+
+// RedactHeader 返回隐藏了凭据的请求头副本，用于日志输出
+func RedactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range sensitiveHeaders {
+		if len(out.Values(name)) > 0 {
+			out.Set(name, redacted)
+		}
+	}
+	return out
+}
+
+// RedactQuery 返回隐藏了凭据参数的查询字符串，用于日志输出，无法解析时整体隐藏
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+	changed := false
+	for key := range values {
+		for _, name := range sensitiveQueryParams {
+			if strings.EqualFold(key, name) {
+				values.Set(key, redacted)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return values.Encode()
+}
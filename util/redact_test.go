@@ -0,0 +1,37 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedactHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer sk-secret")
+	h.Set("X-Goog-Api-Key", "gm-secret")
+	h.Set("Content-Type", "application/json")
+	got := RedactHeader(h)
+	if got.Get("Authorization") != redacted || got.Get("X-Goog-Api-Key") != redacted {
+		t.Errorf("凭据未隐藏: %v", got)
+	}
+	if got.Get("Content-Type") != "application/json" {
+		t.Errorf("普通请求头被修改: %v", got)
+	}
+	if h.Get("Authorization") != "Bearer sk-secret" {
+		t.Errorf("不应修改原请求头")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"alt=sse", "alt=sse"},
+		{"alt=sse&key=gm-secret", "alt=sse&key=%5BREDACTED%5D"},
+		{"%zz", redacted},
+	}
+	for _, tt := range tests {
+		if got := RedactQuery(tt.in); got != tt.want {
+			t.Errorf("RedactQuery(%q) = %q, 期望 %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package util
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -25,7 +24,7 @@ func SuccessResponse(c *gin.Context, data interface{}) {
 
 // 错误响应
 func ErrorResponse(c *gin.Context, statusCode int, message string) {
-	fmt.Println("ErrorResponse:", message)
+	Logger.Debugf("错误响应: %d %s", statusCode, message)
 	c.JSON(statusCode, Response{
 		Code:    statusCode,
 		Message: message,
@@ -46,3 +45,19 @@ func UnauthorizedResponse(c *gin.Context, message string) {
 func InternalServerErrorResponse(c *gin.Context, message string) {
 	ErrorResponse(c, http.StatusInternalServerError, message)
 }
+
+// OpenAIErrorResponse 以OpenAI接口的错误格式响应，供代理请求使用，客户端SDK可以直接解析
+func OpenAIErrorResponse(c *gin.Context, statusCode int, errType, code, param, message string) {
+	var paramValue interface{}
+	if param != "" {
+		paramValue = param
+	}
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"param":   paramValue,
+			"code":    code,
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4，参考 https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+// AWSCredentials AWS访问密钥
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // 临时凭据的会话令牌，可为空
+}
+
+// SignV4 使用SigV4签名请求，body为完整请求体。签名覆盖host、x-amz-*和content-type头，
+// 签名后不能再修改这些头、路径、查询参数和请求体
+func SignV4(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			signedHeaders = append(signedHeaders, lower)
+		}
+	}
+	sort.Strings(signedHeaders)
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(sigV4DateFormat), region, service)
+	canonical := canonicalRequest(req, requestHost(req), signedHeaders, payloadHash)
+	signature := sigV4Signature(creds.SecretAccessKey, now, region, service, scope, canonical)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// VerifyV4 校验收到的请求的SigV4签名，secretFor按Access Key ID返回密钥，供本地模拟的上游服务使用
+func VerifyV4(req *http.Request, body []byte, secretFor func(accessKeyID string) (string, bool)) error {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return errors.New("缺少SigV4签名")
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			params[k] = v
+		}
+	}
+	scopeParts := strings.SplitN(params["Credential"], "/", 2)
+	if len(scopeParts) != 2 || params["SignedHeaders"] == "" || params["Signature"] == "" {
+		return errors.New("签名格式错误")
+	}
+	accessKeyID, scope := scopeParts[0], scopeParts[1]
+	fields := strings.Split(scope, "/")
+	if len(fields) != 4 || fields[3] != "aws4_request" {
+		return errors.New("签名范围格式错误")
+	}
+	secret, ok := secretFor(accessKeyID)
+	if !ok {
+		return fmt.Errorf("未知的Access Key ID: %s", accessKeyID)
+	}
+	now, err := time.Parse(sigV4TimeFormat, req.Header.Get("X-Amz-Date"))
+	if err != nil || now.Format(sigV4DateFormat) != fields[0] {
+		return errors.New("X-Amz-Date无效")
+	}
+	payloadHash := sha256Hex(body)
+	if h := req.Header.Get("X-Amz-Content-Sha256"); h != "" && h != payloadHash {
+		return errors.New("请求体摘要不匹配")
+	}
+
+	canonical := canonicalRequest(req, req.Host, strings.Split(params["SignedHeaders"], ";"), payloadHash)
+	expected := sigV4Signature(secret, now, fields[1], fields[2], scope, canonical)
+	if !hmac.Equal([]byte(expected), []byte(params["Signature"])) {
+		return errors.New("签名不匹配")
+	}
+	return nil
+}
+
+// canonicalRequest 构造规范请求
+func canonicalRequest(req *http.Request, host string, signedHeaders []string, payloadHash string) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := host
+		if name != "host" {
+			value = strings.Join(req.Header.Values(name), ",")
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	return strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.RawQuery),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalURI 规范路径：除S3外的服务需要对已编码的路径再编码一次
+func canonicalURI(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = AWSEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery 规范查询参数：按名称和值排序，按AWS规则编码
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	pairs := make([]string, 0, len(values))
+	for key, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, AWSEscape(key)+"="+AWSEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func sigV4Signature(secret string, now time.Time, region, service, scope, canonical string) string {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secret), now.Format(sigV4DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// AWSEscape 按AWS规则编码，只保留字母、数字和-_.~
+func AWSEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
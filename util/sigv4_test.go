@@ -0,0 +1,47 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// AWS SigV4测试套件中的get-vanilla用例
+func TestSigV4Vector(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+	req.Header.Set("X-Amz-Date", "20150830T123600Z")
+	now, _ := time.Parse(sigV4TimeFormat, "20150830T123600Z")
+
+	canonical := canonicalRequest(req, "example.amazonaws.com", []string{"host", "x-amz-date"}, sha256Hex(nil))
+	got := sigV4Signature("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now, "us-east-1", "service", "20150830/us-east-1/service/aws4_request", canonical)
+	if want := "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"; got != want {
+		t.Errorf("签名 = %s, 期望 %s", got, want)
+	}
+}
+
+func TestSignAndVerifyV4(t *testing.T) {
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+	secretFor := func(id string) (string, bool) { return creds.SecretAccessKey, id == creds.AccessKeyID }
+	body := []byte(`{"messages":[]}`)
+
+	req, _ := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke?a=b%20c", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	SignV4(req, body, creds, "us-east-1", "bedrock", time.Now())
+
+	// 模拟服务端收到的请求
+	received := httptest.NewRequest(req.Method, req.URL.RequestURI(), bytes.NewReader(body))
+	received.Host = req.URL.Host
+	received.Header = req.Header.Clone()
+	if err := VerifyV4(received, body, secretFor); err != nil {
+		t.Fatalf("校验签名失败: %v", err)
+	}
+	if err := VerifyV4(received, []byte(`{}`), secretFor); err == nil {
+		t.Errorf("请求体被修改时应校验失败")
+	}
+	received.Header.Set("Content-Type", "text/plain")
+	if err := VerifyV4(received, body, secretFor); err == nil {
+		t.Errorf("签名的请求头被修改时应校验失败")
+	}
+}
@@ -2,12 +2,12 @@
 
 // 加载API配置列表
 window.loadAPIConfigs = function loadAPIConfigs() {
-    fetch('/admin/api-config', {
+    fetch('/admin/api-config?limit=500', {
         headers: { 'Authorization': 'Bearer ' + localStorage.getItem('admin_token') }
     })
         .then(res => res.json())
         .then(data => {
-            renderApiConfigTable(data.data || []);
+            renderApiConfigTable((data.data && data.data.items) || []);
         })
         .catch(err => alert('加载失败: ' + err));
 };